@@ -0,0 +1,223 @@
+// Package client is a typed client of the game server, following the
+// OpenAPI document served at /openapi.json
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is matched by errors of requests about unknown players
+var ErrNotFound = errors.New("not found")
+
+// Player is a player of the league
+type Player struct {
+	Name string
+	Wins int
+}
+
+// StatusError is returned when the server replies with an unexpected status
+type StatusError struct {
+	Method, URL string
+	StatusCode  int
+	Message     string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, e.Message)
+}
+
+// Is reports 404 responses as ErrNotFound
+func (e *StatusError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// Temporary reports whether the request may succeed when sent again
+func (e *StatusError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Client sends requests to a game server. Requests failing with network
+// errors or temporary statuses are retried with an exponential backoff
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the client sending requests, http.DefaultClient by
+// default
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries sets how many times a request is sent again and the delay
+// before the first retry, which doubles with every retry. Three retries
+// starting at 100ms by default
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries, c.backoff = retries, backoff
+	}
+}
+
+// New returns a client of the server at baseURL, like https://host:5000
+func New(baseURL string, options ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("problem parsing base url %q, %v", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("base url %q must be http or https", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		retries:    3,
+		backoff:    100 * time.Millisecond,
+		maxBackoff: 10 * time.Second,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c, nil
+}
+
+// GetScore returns the wins of a player, an error matching ErrNotFound
+// when the player has none
+func (c *Client) GetScore(ctx context.Context, name string) (int, error) {
+	var score int
+	err := c.do(ctx, http.MethodGet, "/players/"+url.PathEscape(name), nil, http.StatusOK, func(body io.Reader) error {
+		content, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		score, err = strconv.Atoi(strings.TrimSpace(string(content)))
+		return err
+	})
+	return score, err
+}
+
+// RecordWin records a win of a player. Every call is sent with its own
+// Idempotency-Key, so retries don't record the win twice
+func (c *Client) RecordWin(ctx context.Context, name string) error {
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return err
+	}
+	header := http.Header{"Idempotency-Key": {key}}
+	return c.do(ctx, http.MethodPost, "/players/"+url.PathEscape(name), header, http.StatusAccepted, nil)
+}
+
+// GetLeague returns the players ordered by wins
+func (c *Client) GetLeague(ctx context.Context) ([]Player, error) {
+	var league []Player
+	err := c.do(ctx, http.MethodGet, "/league", nil, http.StatusOK, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&league)
+	})
+	return league, err
+}
+
+// do sends the request until it gets the expected status, passing the
+// body of that response to decode
+func (c *Client) do(ctx context.Context, method, path string, header http.Header, want int, decode func(io.Reader) error) error {
+	target := strings.TrimSuffix(c.baseURL.String(), "/") + path
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		wait, err := c.send(ctx, method, target, header, want, decode)
+		if err == nil || wait < 0 || attempt >= c.retries {
+			return err
+		}
+
+		if wait < backoff {
+			wait = backoff
+		}
+		if wait > c.maxBackoff {
+			wait = c.maxBackoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%v, giving up: %w", err, ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// send sends the request once. When it fails, wait is negative unless the
+// request may be retried, in which case it's the delay asked by the server
+func (c *Client) send(ctx context.Context, method, target string, header http.Header, want int, decode func(io.Reader) error) (wait time.Duration, err error) {
+	request, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return -1, err
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		if ctx.Err() != nil {
+			return -1, err
+		}
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != want {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		statusErr := &StatusError{
+			Method:     method,
+			URL:        target,
+			StatusCode: response.StatusCode,
+			Message:    strings.TrimSpace(string(message)),
+		}
+		if !statusErr.Temporary() {
+			return -1, statusErr
+		}
+		seconds, _ := strconv.Atoi(response.Header.Get("Retry-After"))
+		return time.Duration(seconds) * time.Second, statusErr
+	}
+
+	if decode != nil {
+		if err := decode(response.Body); err != nil {
+			return -1, fmt.Errorf("problem parsing response of %s %s, %v", method, target, err)
+		}
+	}
+	return 0, nil
+}
+
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("problem generating idempotency key, %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
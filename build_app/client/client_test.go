@@ -0,0 +1,150 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/windnow/edusrv/client"
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	. "github.com/windnow/edusrv/internal/helpers"
+	fs "github.com/windnow/edusrv/internal/infsstore"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("records wins and reads them back", func(t *testing.T) {
+		server, cleanServer := newGameServer(t)
+		defer cleanServer()
+		c := newClient(t, server.URL)
+
+		assertNoError(t, c.RecordWin(ctx, "Pepper"))
+		assertNoError(t, c.RecordWin(ctx, "Pepper"))
+		assertNoError(t, c.RecordWin(ctx, "Cleo Jones"))
+
+		score, err := c.GetScore(ctx, "Pepper")
+		assertNoError(t, err)
+		if score != 2 {
+			t.Errorf("got score %d want %d", score, 2)
+		}
+
+		league, err := c.GetLeague(ctx)
+		assertNoError(t, err)
+		want := []client.Player{{Name: "Pepper", Wins: 2}, {Name: "Cleo Jones", Wins: 1}}
+		if !reflect.DeepEqual(league, want) {
+			t.Errorf("got %v want %v", league, want)
+		}
+	})
+
+	t.Run("reports unknown players", func(t *testing.T) {
+		server, cleanServer := newGameServer(t)
+		defer cleanServer()
+
+		_, err := newClient(t, server.URL).GetScore(ctx, "Apollo")
+		if !errors.Is(err, client.ErrNotFound) {
+			t.Errorf("got error %v want %v", err, client.ErrNotFound)
+		}
+		var statusErr *client.StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+			t.Errorf("got error %#v want a 404 StatusError", err)
+		}
+	})
+
+	t.Run("retries without recording a win twice", func(t *testing.T) {
+		server, cleanServer := newGameServer(t)
+		defer cleanServer()
+		flaky := newFlakyServer(server.Config.Handler, 2)
+		defer flaky.Close()
+
+		c := newClient(t, flaky.URL)
+		assertNoError(t, c.RecordWin(ctx, "Pepper"))
+
+		score, err := c.GetScore(ctx, "Pepper")
+		assertNoError(t, err)
+		if score != 1 {
+			t.Errorf("got score %d want %d", score, 1)
+		}
+	})
+
+	t.Run("gives up after the retries", func(t *testing.T) {
+		server, cleanServer := newGameServer(t)
+		defer cleanServer()
+		flaky := newFlakyServer(server.Config.Handler, 10)
+		defer flaky.Close()
+
+		_, err := newClient(t, flaky.URL).GetLeague(ctx)
+		var statusErr *client.StatusError
+		if !errors.As(err, &statusErr) || !statusErr.Temporary() {
+			t.Errorf("got error %v want a temporary StatusError", err)
+		}
+	})
+
+	t.Run("stops retrying when the context is done", func(t *testing.T) {
+		server, cleanServer := newGameServer(t)
+		defer cleanServer()
+		flaky := newFlakyServer(server.Config.Handler, 10)
+		defer flaky.Close()
+
+		c, err := client.New(flaky.URL, client.WithRetries(10, time.Hour))
+		assertNoError(t, err)
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		_, err = c.GetLeague(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got error %v want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("refuses invalid base urls", func(t *testing.T) {
+		if _, err := client.New("localhost:5000"); err == nil {
+			t.Error("expected an error but didn't get one")
+		}
+	})
+}
+
+func newGameServer(t *testing.T) (*httptest.Server, func()) {
+	t.Helper()
+	database, cleanDatabase := CreateTempFile(t, "")
+	store, err := fs.NewFileSystemPlayerStore(database)
+	assertNoError(t, err)
+
+	server := httptest.NewServer(gs.NewServer(store))
+	return server, func() {
+		server.Close()
+		cleanDatabase()
+	}
+}
+
+// newFlakyServer passes requests to next but replies 503 to the first
+// failures of them, as if the responses were lost on the way back
+func newFlakyServer(next http.Handler, failures int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			next.ServeHTTP(httptest.NewRecorder(), r)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+func newClient(t *testing.T, url string) *client.Client {
+	t.Helper()
+	c, err := client.New(url, client.WithRetries(3, time.Millisecond))
+	assertNoError(t, err)
+	return c
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("didn't expect an error but got one, %v", err)
+	}
+}
@@ -1,12 +1,34 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"google.golang.org/grpc"
+	grpccredentials "google.golang.org/grpc/credentials"
+
+	"github.com/windnow/edusrv/internal/exchange"
 	"github.com/windnow/edusrv/internal/gameserver"
+	"github.com/windnow/edusrv/internal/grpcapi"
 	"github.com/windnow/edusrv/internal/infsstore"
+	"github.com/windnow/edusrv/internal/raft"
+	"github.com/windnow/edusrv/internal/raftstore"
+	"github.com/windnow/edusrv/internal/ratelimit"
+	"github.com/windnow/edusrv/internal/replication"
+	"github.com/windnow/edusrv/internal/tlsconfig"
+	"github.com/windnow/edusrv/internal/tournament"
 )
 
 const (
@@ -14,19 +36,431 @@ const (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		restore(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "raft" {
+		serveRaft(os.Args[2:])
+		return
+	}
+	serve(os.Args[1:])
+}
+
+func serve(args []string) {
+	flags := flag.NewFlagSet("gamelogger", flag.ExitOnError)
+	backupDir := flags.String("backup-dir", "", "directory for snapshots of the database, empty disables backups")
+	backupInterval := flags.Duration("backup-interval", time.Hour, "interval between snapshots")
+	backupCompress := flags.Bool("backup-compress", true, "gzip snapshots")
+	keepHourly := flags.Int("keep-hourly", 24, "number of hourly snapshots to keep")
+	keepDaily := flags.Int("keep-daily", 7, "number of daily snapshots to keep")
+	tieBreakers := flags.String("tie-breakers", "earliest", "comma separated rules ordering tied players: earliest, alphabetical, head-to-head (wins against each other in tournaments)")
+	logFormat := flags.String("log-format", "json", "log format: json or text")
+	logLevel := flags.String("log-level", "info", "minimum log level: debug, info, warn or error")
+	accessLog := flags.Bool("access-log", true, "log every request")
+	rateLimit := flags.Float64("rate-limit", 10, "requests per second allowed for each client, 0 disables the limit")
+	rateBurst := flags.Int("rate-burst", 20, "requests a client may send at once")
+	trustProxy := flags.Bool("trust-proxy", false, "take client addresses from X-Forwarded-For")
+	winCooldown := flags.Duration("win-cooldown", time.Second, "minimum time between wins of a player, 0 disables the cooldown")
+	idempotencyWindow := flags.Duration("idempotency-window", 24*time.Hour, "how long Idempotency-Key headers of recorded wins are remembered")
+	hourlyRetention := flags.Duration("hourly-retention", 7*24*time.Hour, "how long wins are kept per hour for windowed leagues, older ones per day")
+	maxBodyBytes := flags.Int64("max-body-bytes", 1<<20, "maximum size of a request body")
+	tlsCert := flags.String("tls-cert", "", "PEM certificate file, serves HTTPS and HTTP/2 when set with -tls-key")
+	tlsKey := flags.String("tls-key", "", "PEM key file of the certificate")
+	tlsReload := flags.Duration("tls-reload-interval", 10*time.Second, "how often the certificate files are checked for changes")
+	tlsMinVersion := flags.String("tls-min-version", "1.2", "oldest TLS version accepted: 1.0, 1.1, 1.2 or 1.3")
+	tlsDev := flags.Bool("tls-dev", false, "serve HTTPS with a self-signed certificate generated at startup")
+	tlsHosts := flags.String("tls-hosts", "localhost,127.0.0.1", "comma separated names and addresses of the self-signed certificate")
+	webhooksDir := flags.String("webhooks-dir", "", "directory for webhook subscriptions and deliveries, empty disables webhooks")
+	milestones := flags.String("webhook-milestones", "10,50,100,500,1000", "comma separated numbers of wins worth a player.milestone event")
+	achievementsFile := flags.String("achievements-file", "achievements.ndjson", "file keeping the badges awarded to players, empty disables achievements")
+	tournamentsFile := flags.String("tournaments-file", "tournaments.json", "file keeping tournaments, empty disables them")
+	rematchWindow := flags.Duration("rematch-window", 7*24*time.Hour, "how long matchmaking avoids pairing players who met in a tournament")
+	follow := flags.String("follow", "", "base URL of the leader to replicate, empty to lead")
+	replicationLogSize := flags.Int("replication-log-size", replication.DefaultLogSize, "number of changes kept for followers, those further behind take a new snapshot")
+	grpcAddr := flags.String("grpc-addr", ":5001", "address of the gRPC API, empty disables it")
+	shutdownDelay := flags.Duration("shutdown-delay", 5*time.Second, "time between failing readiness and closing the listener on shutdown")
+	flags.Parse(args)
+
+	logger, err := newLogger(*logFormat, *logLevel)
+	if err != nil {
+		log.Fatalf("problem configuring logs, %v", err)
+	}
+	slog.SetDefault(logger)
+
+	rules, err := gameserver.ParseTieBreakers(*tieBreakers)
+	if err != nil {
+		log.Fatalf("problem parsing -tie-breakers, %v", err)
+	}
+
 	db, err := os.OpenFile(dbFileName, os.O_RDWR|os.O_CREATE, 0666)
 
 	if err != nil {
 		log.Fatalf("problem opening %s %v", dbFileName, err)
 	}
 
-	store, err := infsstore.NewFileSystemPlayerStore(db)
+	changes := replication.NewLog(*replicationLogSize)
+	storeOptions := []infsstore.Option{
+		infsstore.WithTieBreakers(rules...),
+		infsstore.WithLogger(logger),
+		infsstore.WithIdempotencyWindow(*idempotencyWindow),
+		infsstore.WithHourlyRetention(*hourlyRetention),
+		infsstore.WithChangeLog(changes),
+	}
+
+	var events gameserver.EventSinks
+	var webhooks *gameserver.Webhooks
+	if *webhooksDir != "" {
+		config := gameserver.WebhookConfig{Dir: *webhooksDir, Logger: logger}
+		for _, m := range strings.Split(*milestones, ",") {
+			wins, err := strconv.Atoi(strings.TrimSpace(m))
+			if err != nil {
+				log.Fatalf("problem parsing -webhook-milestones, %v", err)
+			}
+			config.Milestones = append(config.Milestones, wins)
+		}
+		webhooks, err = gameserver.NewWebhooks(config)
+		if err != nil {
+			log.Fatalf("problem starting webhooks, %v", err)
+		}
+		events = append(events, webhooks)
+	}
+
+	var achievements *gameserver.Achievements
+	if *achievementsFile != "" {
+		achievements, err = gameserver.NewAchievements(gameserver.AchievementsConfig{File: *achievementsFile, Logger: logger})
+		if err != nil {
+			log.Fatalf("problem loading achievements, %v", err)
+		}
+		if webhooks != nil {
+			achievements.Subscribe(webhooks)
+		}
+		events = append(events, achievements)
+	}
+	if len(events) > 0 {
+		storeOptions = append(storeOptions, infsstore.WithEvents(events))
+	}
+
+	// Tournaments record the wins of matches through the server, its store
+	// breaks ties with their head to head record
+	var store *infsstore.FileSystemPlayerStore
+	var server *gameserver.PlayerServer
+	var tournaments *tournament.Manager
+	if *tournamentsFile != "" {
+		tournaments, err = tournament.NewManager(*tournamentsFile, tournament.RecorderFunc(func(name string) error {
+			return server.RecordWin(name)
+		}))
+		if err != nil {
+			log.Fatalf("problem loading tournaments, %v", err)
+		}
+		storeOptions = append(storeOptions, infsstore.WithHeadToHead(tournaments))
+	} else {
+		for _, rule := range rules {
+			if rule == gameserver.HeadToHead {
+				logger.Warn("head-to-head never breaks ties without tournaments, set -tournaments-file")
+			}
+		}
+	}
+
+	store, err = infsstore.NewFileSystemPlayerStore(db, storeOptions...)
 	if err != nil {
 		log.Fatalf("problem creating file system player store, %v", err)
 	}
-	server := gameserver.NewServer(store)
 
-	if err := http.ListenAndServe(":5000", server); err != nil {
+	var backup *infsstore.Backup
+	if *backupDir != "" {
+		backup, err = infsstore.NewBackup(store, infsstore.BackupConfig{
+			Dir:        *backupDir,
+			Interval:   *backupInterval,
+			Compress:   *backupCompress,
+			KeepHourly: *keepHourly,
+			KeepDaily:  *keepDaily,
+		})
+		if err != nil {
+			log.Fatalf("problem starting backups, %v", err)
+		}
+	}
+
+	replicationToken := os.Getenv("GAMELOGGER_REPLICATION_TOKEN")
+	if *follow != "" && replicationToken == "" {
+		log.Fatal("following needs GAMELOGGER_REPLICATION_TOKEN, leaders only serve followers with it")
+	}
+	node := replication.NewNode(replication.Config{
+		Store:  store,
+		Log:    changes,
+		Leader: *follow,
+		Token:  replicationToken,
+		Logger: logger,
+	})
+
+	var serverOptions []gameserver.ServerOption
+	grpcOptions := []grpcapi.Option{grpcapi.WithLeader(node.Leader), grpcapi.WithChanges(changes.Changed)}
+	if tournaments != nil {
+		serverOptions = append(serverOptions, gameserver.WithMatchHistory(tournaments, *rematchWindow))
+	}
+	chat := gameserver.ChatConfig{
+		SigningSecret: os.Getenv("GAMELOGGER_CHAT_SIGNING_SECRET"),
+		Token:         os.Getenv("GAMELOGGER_CHAT_TOKEN"),
+	}
+	if chat.SigningSecret != "" || chat.Token != "" {
+		serverOptions = append(serverOptions, gameserver.WithChatCommands(chat))
+	}
+	if achievements != nil {
+		serverOptions = append(serverOptions, gameserver.WithAchievements(achievements))
+	}
+	if *winCooldown > 0 {
+		cooldown := ratelimit.NewCooldown(*winCooldown, nil)
+		serverOptions = append(serverOptions, gameserver.WithWinCooldown(cooldown))
+		grpcOptions = append(grpcOptions, grpcapi.WithWinCooldown(cooldown))
+	}
+	server = gameserver.NewServer(store, serverOptions...)
+
+	router := http.NewServeMux()
+	adminToken := os.Getenv("GAMELOGGER_ADMIN_TOKEN")
+	admin := exchange.NewHandler(store)
+	router.Handle("/admin/", server.Instrument(gameserver.RequireAdmin(adminToken, admin), admin.Route))
+	if webhooks != nil {
+		server.Metrics().NewCounterFunc("gamelogger_webhook_events_dropped_total", "Number of webhook events dropped before being queued.", func() float64 {
+			return float64(webhooks.Dropped())
+		})
+		router.Handle("/admin/webhooks", server.Instrument(gameserver.RequireAdmin(adminToken, webhooks), webhooks.Route))
+		router.Handle("/admin/webhooks/", server.Instrument(gameserver.RequireAdmin(adminToken, webhooks), webhooks.Route))
+	}
+	if tournaments != nil {
+		handler := tournament.NewHandler(tournaments)
+		router.Handle("/tournaments", server.Instrument(handler, handler.Route))
+		router.Handle("/tournaments/", server.Instrument(handler, handler.Route))
+	}
+	router.Handle("/replication/", server.Instrument(node, node.Route))
+	router.Handle("/", server)
+
+	var handler http.Handler = ratelimit.LimitBody(node.Guard(router), *maxBodyBytes)
+	if *rateLimit > 0 {
+		limiter := ratelimit.NewLimiter(*rateLimit, *rateBurst, nil)
+		apiKeys := strings.Split(os.Getenv("GAMELOGGER_API_KEYS"), ",")
+		handler = ratelimit.NewHandler(handler, limiter, ratelimit.ClientKey(*trustProxy, apiKeys...))
+	}
+	if *accessLog {
+		handler = gameserver.NewLoggingHandler(handler, logger)
+	}
+
+	httpServer := &http.Server{Addr: ":5000", Handler: handler}
+	if *tlsDev || *tlsCert != "" || *tlsKey != "" {
+		minVersion, err := tlsconfig.ParseVersion(*tlsMinVersion)
+		if err != nil {
+			log.Fatalf("problem parsing -tls-min-version, %v", err)
+		}
+		httpServer.TLSConfig, err = tlsconfig.New(tlsconfig.Config{
+			CertFile:       *tlsCert,
+			KeyFile:        *tlsKey,
+			ReloadInterval: *tlsReload,
+			Dev:            *tlsDev,
+			Hosts:          strings.Split(*tlsHosts, ","),
+			MinVersion:     minVersion,
+			Logger:         logger,
+		})
+		if err != nil {
+			log.Fatalf("problem configuring TLS, %v", err)
+		}
+		if *tlsDev {
+			logger.Warn("serving a self-signed certificate, for development only", "hosts", *tlsHosts)
+		}
+	}
+
+	var grpcServer *grpc.Server
+	if *grpcAddr != "" {
+		var credentials []grpc.ServerOption
+		if httpServer.TLSConfig != nil {
+			credentials = append(credentials, grpc.Creds(grpccredentials.NewTLS(httpServer.TLSConfig)))
+		}
+		grpcServer = grpcapi.NewServer(store, grpcOptions...).GRPCServer(credentials...)
+
+		listener, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			log.Fatalf("could not listen on %s %v", *grpcAddr, err)
+		}
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				logger.Error("problem serving gRPC", "error", err)
+			}
+		}()
+	}
+
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+
+		server.Shutdown()
+		time.Sleep(*shutdownDelay)
+		node.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if grpcServer != nil {
+			go grpcServer.GracefulStop()
+		}
+		httpServer.Shutdown(ctx)
+	}()
+
+	if httpServer.TLSConfig != nil {
+		err = httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
 		log.Fatalf("could not listen on port 5000 %v", err)
 	}
+
+	// achievements publish to the webhooks
+	if achievements != nil {
+		if err := achievements.Close(); err != nil {
+			logger.Error("problem closing achievements", "error", err)
+		}
+	}
+	if webhooks != nil {
+		if err := webhooks.Close(); err != nil {
+			logger.Error("problem closing webhooks", "error", err)
+		}
+	}
+	if backup != nil {
+		if err := backup.Close(); err != nil {
+			logger.Error("problem taking the final snapshot", "error", err)
+		}
+	}
+}
+
+// serveRaft serves the game on a store replicated with Raft across the
+// nodes of a cluster, wins are recorded once a majority stored them
+func serveRaft(args []string) {
+	flags := flag.NewFlagSet("raft", flag.ExitOnError)
+	id := flags.String("id", "http://localhost:5000", "base URL peers reach this node at")
+	peers := flags.String("peers", "", "comma separated base URLs of the other nodes")
+	dir := flags.String("dir", "raft", "directory keeping the log and snapshots of the node")
+	addr := flags.String("addr", ":5000", "address to serve HTTP on")
+	electionTimeout := flags.Duration("election-timeout", 300*time.Millisecond, "time without a leader before an election")
+	snapshotThreshold := flags.Int("snapshot-threshold", 1000, "number of entries the log is compacted after")
+	idempotencyWindow := flags.Duration("idempotency-window", 24*time.Hour, "how long Idempotency-Key headers of recorded wins are remembered")
+	logFormat := flags.String("log-format", "json", "log format: json or text")
+	logLevel := flags.String("log-level", "info", "minimum log level: debug, info, warn or error")
+	flags.Parse(args)
+
+	logger, err := newLogger(*logFormat, *logLevel)
+	if err != nil {
+		log.Fatalf("problem configuring logs, %v", err)
+	}
+	slog.SetDefault(logger)
+
+	var peerIDs []string
+	for _, peer := range strings.Split(*peers, ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			peerIDs = append(peerIDs, peer)
+		}
+	}
+	if len(peerIDs) < 2 {
+		log.Fatalf("-peers must list at least 2 other nodes")
+	}
+
+	storage, err := raft.NewFileStorage(*dir)
+	if err != nil {
+		log.Fatalf("problem opening %s, %v", *dir, err)
+	}
+	token := os.Getenv("GAMELOGGER_RAFT_TOKEN")
+	store, err := raftstore.New(raft.Config{
+		ID:                *id,
+		Peers:             peerIDs,
+		Transport:         &raft.HTTPTransport{Client: &http.Client{Timeout: 10 * time.Second}, Token: token},
+		Storage:           storage,
+		ElectionTimeout:   *electionTimeout,
+		SnapshotThreshold: *snapshotThreshold,
+		Logger:            logger,
+	}, raftstore.WithLogger(logger), raftstore.WithIdempotencyWindow(*idempotencyWindow))
+	if err != nil {
+		log.Fatalf("problem starting raft store, %v", err)
+	}
+
+	server := gameserver.NewServer(store)
+	router := http.NewServeMux()
+	admin := exchange.NewHandler(store)
+	router.Handle("/admin/", server.Instrument(gameserver.RequireAdmin(os.Getenv("GAMELOGGER_ADMIN_TOKEN"), admin), admin.Route))
+	peerHandler := raft.NewHTTPHandler(store.Node(), token)
+	router.Handle("/raft/", server.Instrument(peerHandler, peerHandler.Route))
+	router.Handle("/", server)
+
+	httpServer := &http.Server{Addr: *addr, Handler: gameserver.NewLoggingHandler(router, logger)}
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+
+		server.Shutdown()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+	}()
+
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatalf("could not listen on %s %v", *addr, err)
+	}
+	store.Close()
+	if err := storage.Close(); err != nil {
+		logger.Error("problem closing raft storage", "error", err)
+	}
+}
+
+func newLogger(format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+	options := &slog.HandlerOptions{Level: lvl}
+
+	switch format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, options)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, options)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+func restore(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	backupDir := flags.String("backup-dir", "backups", "directory with snapshots of the database")
+	at := flags.String("at", "", "point in time to restore, RFC 3339 (default now)")
+	out := flags.String("o", dbFileName, "file to write the restored database to")
+	flags.Parse(args)
+
+	when := time.Now()
+	if *at != "" {
+		var err error
+		when, err = time.Parse(time.RFC3339, *at)
+		if err != nil {
+			log.Fatalf("problem parsing --at, %v", err)
+		}
+	}
+
+	db, err := infsstore.Restore(*backupDir, when)
+	if err != nil {
+		log.Fatalf("problem restoring database, %v", err)
+	}
+
+	if _, err := os.Stat(*out); err == nil {
+		old := fmt.Sprintf("%s.%s.bak", *out, time.Now().UTC().Format("20060102T150405Z"))
+		if err := os.Rename(*out, old); err != nil {
+			log.Fatalf("problem moving %s aside, %v", *out, err)
+		}
+		log.Printf("previous database moved to %s", old)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("problem creating %s, %v", *out, err)
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(db); err != nil {
+		log.Fatalf("problem writing %s, %v", *out, err)
+	}
+	log.Printf("restored %d players as of %s into %s", len(db.Players), when.Format(time.RFC3339), *out)
 }
@@ -0,0 +1,158 @@
+package exchange
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+)
+
+// Format is a serialisation format of the league dump
+type Format string
+
+// Supported formats
+const (
+	JSON   Format = "json"
+	NDJSON Format = "ndjson"
+	CSV    Format = "csv"
+)
+
+var csvHeader = []string{"name", "wins"}
+
+// ParseFormat returns the format by its name, an empty name means JSON
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case "":
+		return JSON, nil
+	case JSON, NDJSON, CSV:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q", name)
+}
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case NDJSON:
+		return "application/x-ndjson"
+	case CSV:
+		return "text/csv"
+	}
+	return "application/json"
+}
+
+// Export writes the league to w in the given format
+func Export(w io.Writer, f Format, league gs.League) error {
+	switch f {
+	case JSON:
+		if league == nil {
+			league = gs.League{}
+		}
+		return json.NewEncoder(w).Encode(league)
+	case NDJSON:
+		enc := json.NewEncoder(w)
+		for _, p := range league {
+			if err := enc.Encode(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	case CSV:
+		cw := csv.NewWriter(w)
+		cw.Write(csvHeader)
+		for _, p := range league {
+			cw.Write([]string{p.Name, strconv.Itoa(p.Wins)})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown format %q", f)
+}
+
+// Import reads a league in the given format from r. Records are returned as
+// is, checking them for conflicts is the job of Plan
+func Import(r io.Reader, f Format) (gs.League, error) {
+	switch f {
+	case JSON:
+		var league gs.League
+		if err := json.NewDecoder(r).Decode(&league); err != nil {
+			return nil, fmt.Errorf("problem parsing json, %v", err)
+		}
+		return league, nil
+	case NDJSON:
+		return importNDJSON(r)
+	case CSV:
+		return importCSV(r)
+	}
+	return nil, fmt.Errorf("unknown format %q", f)
+}
+
+func importNDJSON(r io.Reader) (gs.League, error) {
+	var league gs.League
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var p gs.Player
+		if err := json.Unmarshal([]byte(text), &p); err != nil {
+			return nil, fmt.Errorf("problem parsing line %d, %v", line, err)
+		}
+		league = append(league, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("problem reading ndjson, %v", err)
+	}
+	return league, nil
+}
+
+func importCSV(r io.Reader) (gs.League, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("problem reading csv header, %v", err)
+	}
+
+	nameCol, winsCol := -1, -1
+	for i, col := range header {
+		switch strings.ToLower(strings.TrimSpace(col)) {
+		case "name":
+			nameCol = i
+		case "wins":
+			winsCol = i
+		}
+	}
+	if nameCol < 0 || winsCol < 0 {
+		return nil, fmt.Errorf("csv header must contain %q and %q columns", "name", "wins")
+	}
+
+	var league gs.League
+	for n := 1; ; n++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("problem reading csv, %v", err)
+		}
+		wins, err := strconv.Atoi(strings.TrimSpace(record[winsCol]))
+		if err != nil {
+			return nil, fmt.Errorf("problem parsing wins in record %d, %v", n, err)
+		}
+		league = append(league, gs.Player{Name: record[nameCol], Wins: wins})
+	}
+	return league, nil
+}
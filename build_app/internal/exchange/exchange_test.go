@@ -0,0 +1,180 @@
+package exchange_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	ex "github.com/windnow/edusrv/internal/exchange"
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	. "github.com/windnow/edusrv/internal/helpers"
+	fs "github.com/windnow/edusrv/internal/infsstore"
+)
+
+func TestExportImport(t *testing.T) {
+	league := []gs.Player{
+		{Name: "Cleo", Wins: 32},
+		{Name: "Chris, Jr.", Wins: 20},
+	}
+
+	for _, format := range []ex.Format{ex.JSON, ex.NDJSON, ex.CSV} {
+		t.Run(string(format), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := ex.Export(buf, format, league)
+			assertNoError(t, err)
+
+			got, err := ex.Import(buf, format)
+			assertNoError(t, err)
+
+			assertLeague(t, got, league)
+		})
+	}
+
+	t.Run("csv with reordered columns", func(t *testing.T) {
+		got, err := ex.Import(strings.NewReader("Wins,Name\n3,Cleo\n"), ex.CSV)
+		assertNoError(t, err)
+		assertLeague(t, got, []gs.Player{{Name: "Cleo", Wins: 3}})
+	})
+
+	t.Run("csv without wins column", func(t *testing.T) {
+		_, err := ex.Import(strings.NewReader("name\nCleo\n"), ex.CSV)
+		if err == nil {
+			t.Error("expected an error but didn't get one")
+		}
+	})
+}
+
+func TestPlan(t *testing.T) {
+	current := []gs.Player{
+		{Name: "Cleo", Wins: 10},
+		{Name: "Chris", Wins: 33},
+	}
+
+	t.Run("merge keeps missing players", func(t *testing.T) {
+		got, report := ex.Plan(current, []gs.Player{{Name: "Chris", Wins: 40}, {Name: "Pepper", Wins: 1}}, ex.Merge)
+
+		assertLeague(t, got, []gs.Player{{Name: "Cleo", Wins: 10}, {Name: "Chris", Wins: 40}, {Name: "Pepper", Wins: 1}})
+		if report.Added != 1 || report.Updated != 1 || report.Removed != 0 {
+			t.Errorf("unexpected report %+v", report)
+		}
+		if len(report.Conflicts) != 1 || report.Conflicts[0].Name != "Chris" {
+			t.Errorf("expected conflict on Chris, got %v", report.Conflicts)
+		}
+	})
+
+	t.Run("replace drops missing players", func(t *testing.T) {
+		got, report := ex.Plan(current, []gs.Player{{Name: "Cleo", Wins: 10}}, ex.Replace)
+
+		assertLeague(t, got, []gs.Player{{Name: "Cleo", Wins: 10}})
+		if report.Unchanged != 1 || report.Removed != 1 || len(report.Conflicts) != 0 {
+			t.Errorf("unexpected report %+v", report)
+		}
+	})
+
+	t.Run("invalid records", func(t *testing.T) {
+		got, report := ex.Plan(current, []gs.Player{{Name: "", Wins: 1}, {Name: "Cleo", Wins: -1}, {Name: "Pepper", Wins: 1}, {Name: "Pepper", Wins: 2}}, ex.Merge)
+
+		if got != nil {
+			t.Errorf("expected no league, got %v", got)
+		}
+		if report.Valid() || len(report.Errors) != 3 {
+			t.Errorf("expected 3 errors, got %v", report.Errors)
+		}
+	})
+}
+
+func TestHandler(t *testing.T) {
+	database, cleanDatabase := CreateTempFile(t, `[
+		{"Name": "Cleo", "Wins": 10},
+		{"Name": "Chris", "Wins": 33}]`)
+	defer cleanDatabase()
+
+	store, err := fs.NewFileSystemPlayerStore(database)
+	assertNoError(t, err)
+	handler := ex.NewHandler(store)
+
+	t.Run("export csv", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/admin/export?format=csv", nil))
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		want := "name,wins\nChris,33\nCleo,10\n"
+		if response.Body.String() != want {
+			t.Errorf("got %q, want %q", response.Body.String(), want)
+		}
+	})
+
+	t.Run("dry run does not change the store", func(t *testing.T) {
+		body := strings.NewReader(`{"Name": "Pepper", "Wins": 5}`)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/admin/import?format=ndjson&dry_run=true", body))
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		report := getReport(t, response)
+		if report.Applied || report.Added != 1 {
+			t.Errorf("unexpected report %+v", report)
+		}
+		if store.GetPlayerScore("Pepper") != 0 {
+			t.Error("dry run changed the store")
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		body := strings.NewReader("name,wins\nPepper,5\n")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/admin/import?format=csv&mode=replace", body))
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		if !getReport(t, response).Applied {
+			t.Error("import was not applied")
+		}
+		assertLeague(t, store.GetLeague(), []gs.Player{{Name: "Pepper", Wins: 5}})
+
+		database.Seek(0, 0)
+		persisted, err := gs.NewLeague(database)
+		assertNoError(t, err)
+		assertLeague(t, persisted, []gs.Player{{Name: "Pepper", Wins: 5}})
+	})
+
+	t.Run("rejects invalid import", func(t *testing.T) {
+		body := strings.NewReader(`[{"Name": "", "Wins": 5}]`)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/admin/import", body))
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertLeague(t, store.GetLeague(), []gs.Player{{Name: "Pepper", Wins: 5}})
+	})
+}
+
+func getReport(t *testing.T, response *httptest.ResponseRecorder) (report ex.Report) {
+	t.Helper()
+	if err := json.NewDecoder(response.Body).Decode(&report); err != nil {
+		t.Fatalf("unable to parse report %q, %v", response.Body, err)
+	}
+	return
+}
+
+func assertLeague(t *testing.T, got, want gs.League) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func assertStatusCode(t *testing.T, got, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("did not correct status code. got %d, want %d", got, want)
+	}
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("didn't expect an error but got one, %v", err)
+	}
+}
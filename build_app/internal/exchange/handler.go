@@ -0,0 +1,118 @@
+package exchange
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	"github.com/windnow/edusrv/internal/metrics"
+)
+
+// Replacer is implemented by stores that can swap their whole league at once
+type Replacer interface {
+	ReplaceLeague(league gs.League) error
+}
+
+// Handler serves /admin/export and /admin/import on top of a PlayerStore
+type Handler struct {
+	store gs.PlayerStore
+	http.Handler
+	route func(r *http.Request) string
+}
+
+// NewHandler ...
+func NewHandler(store gs.PlayerStore) *Handler {
+	h := new(Handler)
+	h.store = store
+
+	router := http.NewServeMux()
+	router.Handle("/admin/export", http.HandlerFunc(h.exportHandler))
+	router.Handle("/admin/import", http.HandlerFunc(h.importHandler))
+
+	h.Handler = router
+	h.route = metrics.MuxRoute(router)
+
+	return h
+}
+
+// Route names the route serving a request, see metrics.MuxRoute
+func (h *Handler) Route(r *http.Request) string {
+	return h.route(r)
+}
+
+func (h *Handler) exportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	format, err := ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Exported to a buffer first, so a failure isn't sent as a truncated 200
+	body := new(bytes.Buffer)
+	if err := Export(body, format, h.store.GetLeague()); err != nil {
+		slog.Error("problem exporting league", "format", format, "error", err)
+		http.Error(w, "problem exporting league", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", format.ContentType())
+	body.WriteTo(w)
+}
+
+func (h *Handler) importHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	format, err := ParseFormat(query.Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mode, err := ParseMode(query.Get("mode"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dryRun, _ := strconv.ParseBool(query.Get("dry_run"))
+
+	incoming, err := Import(r.Body, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	league, report := Plan(h.store.GetLeague(), incoming, mode)
+	report.DryRun = dryRun
+
+	status := http.StatusOK
+	switch {
+	case !report.Valid():
+		status = http.StatusUnprocessableEntity
+	case dryRun:
+	default:
+		replacer, ok := h.store.(Replacer)
+		if !ok {
+			http.Error(w, "store does not support import", http.StatusNotImplemented)
+			return
+		}
+		if err := replacer.ReplaceLeague(league); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		report.Applied = true
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
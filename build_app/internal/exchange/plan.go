@@ -0,0 +1,118 @@
+package exchange
+
+import (
+	"fmt"
+	"strings"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+)
+
+// Mode tells how imported players are combined with the existing league
+type Mode string
+
+// Supported import modes
+const (
+	// Merge keeps players missing from the import and overwrites the
+	// wins of those present in it
+	Merge Mode = "merge"
+	// Replace drops the existing league in favour of the imported one
+	Replace Mode = "replace"
+)
+
+// ParseMode returns the mode by its name, an empty name means Merge
+func ParseMode(name string) (Mode, error) {
+	switch m := Mode(strings.ToLower(name)); m {
+	case "":
+		return Merge, nil
+	case Merge, Replace:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown mode %q", name)
+}
+
+// Issue describes a single problem found in the imported data
+type Issue struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// Report is the result of validating an import against the current league
+type Report struct {
+	Mode      Mode    `json:"mode"`
+	DryRun    bool    `json:"dry_run"`
+	Applied   bool    `json:"applied"`
+	Added     int     `json:"added"`
+	Updated   int     `json:"updated"`
+	Unchanged int     `json:"unchanged"`
+	Removed   int     `json:"removed"`
+	Errors    []Issue `json:"errors"`
+	Conflicts []Issue `json:"conflicts"`
+}
+
+// Valid reports whether the import can be applied
+func (r Report) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Plan computes the league that results from importing incoming into current
+// with the given mode. Records that can't be imported at all (empty names,
+// negative wins, duplicates) are reported as errors, records that overwrite
+// a different value in current are reported as conflicts
+func Plan(current, incoming gs.League, mode Mode) (gs.League, Report) {
+	report := Report{Mode: mode, Errors: []Issue{}, Conflicts: []Issue{}}
+
+	seen := make(map[string]bool, len(incoming))
+	for _, p := range incoming {
+		switch {
+		case strings.TrimSpace(p.Name) == "":
+			report.Errors = append(report.Errors, Issue{p.Name, "empty player name"})
+		case p.Wins < 0:
+			report.Errors = append(report.Errors, Issue{p.Name, fmt.Sprintf("negative wins %d", p.Wins)})
+		case seen[p.Name]:
+			report.Errors = append(report.Errors, Issue{p.Name, "duplicate player"})
+		}
+		seen[p.Name] = true
+	}
+
+	existing := make(map[string]int, len(current))
+	for _, p := range current {
+		existing[p.Name] = p.Wins
+	}
+
+	var result gs.League
+	if mode == Merge {
+		for _, p := range current {
+			if !seen[p.Name] {
+				result = append(result, p)
+			}
+		}
+	}
+
+	for _, p := range incoming {
+		wins, ok := existing[p.Name]
+		switch {
+		case !ok:
+			report.Added++
+		case wins == p.Wins:
+			report.Unchanged++
+		default:
+			report.Updated++
+			report.Conflicts = append(report.Conflicts, Issue{
+				p.Name,
+				fmt.Sprintf("wins %d would be overwritten with %d", wins, p.Wins),
+			})
+		}
+		delete(existing, p.Name)
+	}
+
+	if mode == Replace {
+		report.Removed = len(existing)
+	}
+
+	if !report.Valid() {
+		return nil, report
+	}
+
+	result = append(result, incoming...)
+	return result, report
+}
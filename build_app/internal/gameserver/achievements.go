@@ -0,0 +1,268 @@
+package gameserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AchievementRule awards a badge once to the player of the events it
+// matches
+type AchievementRule struct {
+	ID          string
+	Name        string
+	Description string
+	Match       func(e Event, streak int) bool
+}
+
+// Achievement is a badge awarded to a player
+type Achievement struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	At          time.Time `json:"at"`
+}
+
+func winsRule(id, name string, wins int) AchievementRule {
+	return AchievementRule{
+		ID:          id,
+		Name:        name,
+		Description: fmt.Sprintf("Won %d games", wins),
+		Match: func(e Event, streak int) bool {
+			return e.Type == EventWinRecorded && e.Wins >= wins
+		},
+	}
+}
+
+// DefaultAchievementRules are used unless AchievementsConfig.Rules is set
+var DefaultAchievementRules = []AchievementRule{
+	{
+		ID:          "first-win",
+		Name:        "First win",
+		Description: "Won a game",
+		Match: func(e Event, streak int) bool {
+			return e.Type == EventWinRecorded
+		},
+	},
+	winsRule("wins-10", "Regular", 10),
+	winsRule("wins-50", "Veteran", 50),
+	winsRule("wins-100", "Champion", 100),
+	{
+		ID:          "streak-5",
+		Name:        "On fire",
+		Description: "Won 5 games in a row",
+		Match: func(e Event, streak int) bool {
+			return e.Type == EventWinRecorded && streak >= 5
+		},
+	},
+	{
+		ID:          "dethroned",
+		Name:        "Usurper",
+		Description: "Took first place from the leader",
+		Match: func(e Event, streak int) bool {
+			return e.Type == EventNewLeader && e.PreviousLeader != ""
+		},
+	},
+}
+
+// AchievementsConfig configures Achievements
+type AchievementsConfig struct {
+	// File keeps the awarded badges
+	File   string
+	Rules  []AchievementRule
+	Logger *slog.Logger
+}
+
+// award is a line of the achievements file
+type award struct {
+	Player      string    `json:"player"`
+	Achievement string    `json:"achievement"`
+	At          time.Time `json:"at"`
+}
+
+// Achievements awards badges for the events of a store, it is an
+// EventSink. Streaks count the wins in a row in the whole league, they
+// start again when the server restarts. Badges are persisted and published
+// to the subscribers in the background, stores publish while locked
+type Achievements struct {
+	rules  []AchievementRule
+	logger *slog.Logger
+	file   *os.File
+
+	mu          sync.Mutex
+	awarded     map[string][]award
+	lastWinner  string
+	streak      int
+	subscribers []EventSink
+	queued      []Event
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewAchievements loads the badges awarded so far
+func NewAchievements(config AchievementsConfig) (*Achievements, error) {
+	a := &Achievements{
+		rules:   config.Rules,
+		logger:  config.Logger,
+		awarded: make(map[string][]award),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if a.rules == nil {
+		a.rules = DefaultAchievementRules
+	}
+	if a.logger == nil {
+		a.logger = slog.Default()
+	}
+
+	file, err := os.OpenFile(config.File, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("problem opening achievements %s, %v", config.File, err)
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var aw award
+		if err := json.Unmarshal(scanner.Bytes(), &aw); err != nil {
+			// a torn line left by a crash while appending it
+			a.logger.Warn("skipping achievement record", "file", config.File, "error", err)
+			continue
+		}
+		a.awarded[aw.Player] = append(a.awarded[aw.Player], aw)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("problem reading achievements %s, %v", config.File, err)
+	}
+	a.file = file
+	go a.loop()
+	return a, nil
+}
+
+// Subscribe publishes an EventAchievement to sink for every badge awarded
+func (a *Achievements) Subscribe(sink EventSink) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.subscribers = append(a.subscribers, sink)
+}
+
+// Publish evaluates the rules against the event and queues the badges
+// awarded
+func (a *Achievements) Publish(e Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if e.Type == EventWinRecorded {
+		if e.Player == a.lastWinner {
+			a.streak++
+		} else {
+			a.lastWinner, a.streak = e.Player, 1
+		}
+	}
+
+	for _, rule := range a.rules {
+		if a.has(e.Player, rule.ID) || !rule.Match(e, a.streak) {
+			continue
+		}
+
+		a.awarded[e.Player] = append(a.awarded[e.Player], award{Player: e.Player, Achievement: rule.ID, At: e.At})
+		a.queued = append(a.queued, Event{Type: EventAchievement, At: e.At, Player: e.Player, Wins: e.Wins, Achievement: rule.ID})
+		select {
+		case a.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (a *Achievements) loop() {
+	defer close(a.stopped)
+
+	for {
+		select {
+		case <-a.wake:
+			a.flush()
+		case <-a.done:
+			a.flush()
+			return
+		}
+	}
+}
+
+// flush persists the queued badges and publishes them to the subscribers
+func (a *Achievements) flush() {
+	a.mu.Lock()
+	queued, subscribers := a.queued, a.subscribers
+	a.queued = nil
+	a.mu.Unlock()
+
+	for _, e := range queued {
+		record, err := json.Marshal(award{Player: e.Player, Achievement: e.Achievement, At: e.At})
+		if err == nil {
+			_, err = a.file.Write(append(record, '\n'))
+		}
+		if err != nil {
+			a.logger.Error("problem persisting achievement", "player", e.Player, "achievement", e.Achievement, "error", err)
+		}
+
+		for _, sink := range subscribers {
+			sink.Publish(e)
+		}
+	}
+}
+
+func (a *Achievements) has(player, id string) bool {
+	for _, aw := range a.awarded[player] {
+		if aw.Achievement == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Of returns the badges of a player in the order they were awarded.
+// Badges of rules no longer configured are left out
+func (a *Achievements) Of(player string) []Achievement {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	achievements := []Achievement{}
+	for _, aw := range a.awarded[player] {
+		for _, rule := range a.rules {
+			if rule.ID == aw.Achievement {
+				achievements = append(achievements, Achievement{rule.ID, rule.Name, rule.Description, aw.At})
+			}
+		}
+	}
+	return achievements
+}
+
+// Close persists and publishes the badges queued so far
+func (a *Achievements) Close() error {
+	close(a.done)
+	<-a.stopped
+	return a.file.Close()
+}
+
+// WithAchievements serves the badges of players at
+// /players/{name}/achievements
+func WithAchievements(a *Achievements) ServerOption {
+	return func(p *PlayerServer) {
+		p.achievements = a
+	}
+}
+
+func (p *PlayerServer) showAchievements(w http.ResponseWriter, player string) {
+	if p.achievements == nil {
+		http.Error(w, "achievements are not enabled", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(p.achievements.Of(player))
+}
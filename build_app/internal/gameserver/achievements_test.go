@@ -0,0 +1,152 @@
+package gameserver_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	. "github.com/windnow/edusrv/internal/helpers"
+	fs "github.com/windnow/edusrv/internal/infsstore"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []gs.Event
+}
+
+func (s *recordingSink) Publish(e gs.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+}
+
+// blockingSink blocks publishers until release is closed
+type blockingSink chan struct{}
+
+func (s blockingSink) Publish(e gs.Event) {
+	<-s
+}
+
+func TestAchievements(t *testing.T) {
+	t.Run("awards badges for wins of the store", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, "")
+		defer cleanDatabase()
+		file := filepath.Join(t.TempDir(), "achievements.ndjson")
+
+		achievements := newAchievements(t, file)
+		sink := &recordingSink{}
+		achievements.Subscribe(sink)
+		store, err := fs.NewFileSystemPlayerStore(database, fs.WithEvents(achievements))
+		assertNoError(t, err)
+
+		store.RecordWin("Cleo")
+		for i := 0; i < 10; i++ {
+			store.RecordWin("Chris")
+		}
+
+		assertAchievements(t, achievements.Of("Cleo"), "first-win")
+		assertAchievements(t, achievements.Of("Chris"), "first-win", "dethroned", "streak-5", "wins-10")
+
+		// closing publishes the queued badges
+		achievements.Close()
+		if len(sink.events) != 5 {
+			t.Fatalf("got %d events want 5, %v", len(sink.events), sink.events)
+		}
+		if e := sink.events[3]; e.Type != gs.EventAchievement || e.Player != "Chris" || e.Achievement != "streak-5" {
+			t.Errorf("got event %+v want streak-5 of Chris", e)
+		}
+
+		reloaded := newAchievements(t, file)
+		defer reloaded.Close()
+		assertAchievements(t, reloaded.Of("Chris"), "first-win", "dethroned", "streak-5", "wins-10")
+	})
+
+	t.Run("a streak ends when another player wins", func(t *testing.T) {
+		achievements := newAchievements(t, filepath.Join(t.TempDir(), "achievements.ndjson"))
+		defer achievements.Close()
+
+		wins := map[string]int{}
+		for _, player := range []string{"Chris", "Chris", "Chris", "Chris", "Cleo", "Chris"} {
+			wins[player]++
+			achievements.Publish(gs.Event{Type: gs.EventWinRecorded, Player: player, Wins: wins[player]})
+		}
+
+		assertAchievements(t, achievements.Of("Chris"), "first-win")
+	})
+
+	t.Run("doesn't wait for subscribers", func(t *testing.T) {
+		achievements := newAchievements(t, filepath.Join(t.TempDir(), "achievements.ndjson"))
+		release := make(chan struct{})
+		achievements.Subscribe(blockingSink(release))
+
+		published := make(chan struct{})
+		go func() {
+			achievements.Publish(gs.Event{Type: gs.EventWinRecorded, Player: "Pepper", Wins: 1})
+			achievements.Publish(gs.Event{Type: gs.EventWinRecorded, Player: "Cleo", Wins: 1})
+			close(published)
+		}()
+		select {
+		case <-published:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Publish waited for a blocked subscriber")
+		}
+		assertAchievements(t, achievements.Of("Cleo"), "first-win")
+
+		close(release)
+		achievements.Close()
+	})
+
+	t.Run("GET /players/{name}/achievements", func(t *testing.T) {
+		achievements := newAchievements(t, filepath.Join(t.TempDir(), "achievements.ndjson"))
+		defer achievements.Close()
+		achievements.Publish(gs.Event{Type: gs.EventWinRecorded, Player: "Pepper", Wins: 1})
+
+		server := gs.NewServer(&StubPlayerStore{}, gs.WithAchievements(achievements))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/players/Pepper/achievements", nil))
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertContentType(t, response, "application/json")
+
+		var got []gs.Achievement
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("Unable to parse achievements, %v", err)
+		}
+		assertAchievements(t, got, "first-win")
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/players/Floyd/achievements", nil))
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), "[]\n")
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		server := gs.NewServer(&StubPlayerStore{})
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/players/Pepper/achievements", nil))
+		assertStatusCode(t, response.Code, http.StatusNotFound)
+	})
+}
+
+func newAchievements(t *testing.T, file string) *gs.Achievements {
+	t.Helper()
+	achievements, err := gs.NewAchievements(gs.AchievementsConfig{File: file})
+	assertNoError(t, err)
+	return achievements
+}
+
+func assertAchievements(t testing.TB, got []gs.Achievement, want ...string) {
+	t.Helper()
+	ids := []string{}
+	for _, a := range got {
+		ids = append(ids, a.ID)
+	}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("got achievements %v want %v", ids, want)
+	}
+}
@@ -0,0 +1,117 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// maxBatchSize bounds the number of results in a single request to /wins
+const maxBatchSize = 10000
+
+// WinResult is a single result posted to /wins
+type WinResult struct {
+	Name string `json:"name"`
+}
+
+// WinStatus tells what happened to a result posted to /wins, Status is the
+// code the result would have got from POST /players/{name}
+type WinStatus struct {
+	Name   string `json:"name"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// winsHandler records a batch of wins with a single call to the store. The
+// body is a JSON array of results, or one result per line when sent as
+// application/x-ndjson. Invalid results are skipped and reported in the
+// response, which lists a status per result in the order they were sent
+func (p *PlayerServer) winsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	results, err := decodeWinResults(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	statuses := make([]WinStatus, len(results))
+	names := make([]string, 0, len(results))
+	allowed := make(map[string]bool)
+	for i, result := range results {
+		status := WinStatus{Name: result.Name, Status: http.StatusAccepted}
+		if result.Name == "" {
+			status.Status, status.Error = http.StatusUnprocessableEntity, "missing player name"
+		} else if ok, seen := allowed[result.Name]; !seen {
+			// the cooldown applies to the batch, a tournament may well
+			// have several wins of a player
+			ok := true
+			if p.winCooldown != nil {
+				var wait time.Duration
+				if ok, wait = p.winCooldown.Allow(result.Name); !ok {
+					status.Status, status.Error = http.StatusTooManyRequests, fmt.Sprintf("retry after %s", wait)
+				}
+			}
+			allowed[result.Name] = ok
+		} else if !ok {
+			status.Status, status.Error = http.StatusTooManyRequests, "win cooldown"
+		}
+
+		statuses[i] = status
+		if status.Status == http.StatusAccepted {
+			names = append(names, result.Name)
+		}
+	}
+
+	w.Header().Set("content-type", "application/json")
+	if len(names) > 0 {
+		if err := p.recordWins(names...); err != nil {
+			// none of the wins were recorded
+			p.releaseWins(names...)
+			for i := range statuses {
+				if statuses[i].Status == http.StatusAccepted {
+					statuses[i].Status, statuses[i].Error = http.StatusServiceUnavailable, err.Error()
+				}
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}
+	json.NewEncoder(w).Encode(statuses)
+}
+
+func decodeWinResults(r *http.Request) ([]WinResult, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("content-type"))
+	dec := json.NewDecoder(r.Body)
+
+	var results []WinResult
+	if mediaType == "application/x-ndjson" {
+		for {
+			var result WinResult
+			err := dec.Decode(&result)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("problem parsing result %d, %v", len(results)+1, err)
+			}
+			results = append(results, result)
+			if len(results) > maxBatchSize {
+				break
+			}
+		}
+	} else if err := dec.Decode(&results); err != nil {
+		return nil, fmt.Errorf("problem parsing results, %v", err)
+	}
+
+	if len(results) > maxBatchSize {
+		return nil, fmt.Errorf("too many results, at most %d are accepted", maxBatchSize)
+	}
+	return results, nil
+}
@@ -0,0 +1,131 @@
+package gameserver_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	. "github.com/windnow/edusrv/internal/helpers"
+	fs "github.com/windnow/edusrv/internal/infsstore"
+	"github.com/windnow/edusrv/internal/ratelimit"
+)
+
+func TestBatchWins(t *testing.T) {
+	t.Run("records a JSON array", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		server := gs.NewServer(store)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newBatchWinsRequest("application/json",
+			`[{"name":"Pepper"},{"name":""},{"name":"Cleo"}]`))
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertContentType(t, response, "application/json")
+		assertWinStatuses(t, response, []gs.WinStatus{
+			{Name: "Pepper", Status: http.StatusAccepted},
+			{Name: "", Status: http.StatusUnprocessableEntity, Error: "missing player name"},
+			{Name: "Cleo", Status: http.StatusAccepted},
+		})
+		if !reflect.DeepEqual(store.winCalls, []string{"Pepper", "Cleo"}) {
+			t.Errorf("got wins %v want %v", store.winCalls, []string{"Pepper", "Cleo"})
+		}
+	})
+
+	t.Run("records NDJSON", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		server := gs.NewServer(store)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newBatchWinsRequest("application/x-ndjson",
+			"{\"name\":\"Pepper\"}\n{\"name\":\"Pepper\"}\n"))
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		if len(store.winCalls) != 2 {
+			t.Errorf("got %d wins want %d", len(store.winCalls), 2)
+		}
+	})
+
+	t.Run("refuses a malformed body", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		server := gs.NewServer(store)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newBatchWinsRequest("application/json", `[{"name":"Pepper"},`))
+
+		assertStatusCode(t, response.Code, http.StatusBadRequest)
+		if len(store.winCalls) != 0 {
+			t.Errorf("got %d wins want none", len(store.winCalls))
+		}
+	})
+
+	t.Run("applies the cooldown once per player", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		clock := &fakeClock{time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)}
+		server := gs.NewServer(store, gs.WithWinCooldown(ratelimit.NewCooldown(time.Minute, clock)))
+		server.ServeHTTP(httptest.NewRecorder(), newPostWinRequest("Cleo"))
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newBatchWinsRequest("application/json",
+			`[{"name":"Pepper"},{"name":"Cleo"},{"name":"Pepper"}]`))
+
+		assertWinStatuses(t, response, []gs.WinStatus{
+			{Name: "Pepper", Status: http.StatusAccepted},
+			{Name: "Cleo", Status: http.StatusTooManyRequests, Error: "retry after 1m0s"},
+			{Name: "Pepper", Status: http.StatusAccepted},
+		})
+	})
+
+	t.Run("only accepts POST", func(t *testing.T) {
+		server := gs.NewServer(&StubPlayerStore{})
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/wins", nil))
+
+		assertStatusCode(t, response.Code, http.StatusMethodNotAllowed)
+	})
+}
+
+func TestFileSystemStoreRecordWins(t *testing.T) {
+	database, cleanDatabase := CreateTempFile(t, `{"version": 2, "players": []}`)
+	defer cleanDatabase()
+
+	clock := &fakeClock{time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)}
+	store, err := fs.NewFileSystemPlayerStore(database, fs.WithClock(clock.Now))
+	assertNoError(t, err)
+	store.RecordWins([]string{"Cleo", "Chris", "Cleo"})
+
+	database.Seek(0, 0)
+	content, _ := ioutil.ReadAll(database)
+	want := `{"version": 2, "players": []}{"win":"Cleo","at":"2026-10-19T10:00:00Z"}
+{"win":"Chris","at":"2026-10-19T10:00:00Z"}
+{"win":"Cleo","at":"2026-10-19T10:00:00Z"}
+`
+	assertResponseBody(t, string(content), want)
+
+	reopened, err := fs.NewFileSystemPlayerStore(database)
+	assertNoError(t, err)
+	assertLeague(t, reopened.GetLeague(), []gs.Player{{"Cleo", 2}, {"Chris", 1}})
+}
+
+func newBatchWinsRequest(contentType, body string) *http.Request {
+	request, _ := http.NewRequest(http.MethodPost, "/wins", strings.NewReader(body))
+	request.Header.Set("content-type", contentType)
+	return request
+}
+
+func assertWinStatuses(t *testing.T, response *httptest.ResponseRecorder, want []gs.WinStatus) {
+	t.Helper()
+	var got []gs.WinStatus
+	if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+		t.Fatalf("Unable to parse response %q, %v", response.Body, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
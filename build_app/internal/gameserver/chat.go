@@ -0,0 +1,201 @@
+package gameserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of signed slash commands
+const (
+	ChatSignatureHeader = "X-Slack-Signature"
+	ChatTimestampHeader = "X-Slack-Request-Timestamp"
+)
+
+const (
+	maxChatClockSkew = 5 * time.Minute
+	maxChatBody      = 64 * 1024
+	defaultChatTop   = 5
+	maxChatTop       = 25
+)
+
+// ChatConfig verifies slash commands: Slack style commands are signed with
+// SigningSecret, Mattermost style ones carry Token. One of them is required
+type ChatConfig struct {
+	SigningSecret string
+	Token         string
+}
+
+// ChatReply is the response to a slash command
+type ChatReply struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// WithChatCommands serves slash commands at /chat/command:
+//
+//	/game win Cleo
+//	/game score Cleo
+//	/game league top 5
+//
+// A command named after a subcommand, like /win Cleo, runs it directly
+func WithChatCommands(config ChatConfig) ServerOption {
+	return func(p *PlayerServer) {
+		p.chat = &config
+	}
+}
+
+// SignChatCommand returns the signature of a slash command body
+func SignChatCommand(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *PlayerServer) chatHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxChatBody))
+	if err != nil {
+		http.Error(w, "problem reading command", http.StatusBadRequest)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "problem parsing command", http.StatusBadRequest)
+		return
+	}
+	if err := p.verifyChatCommand(r.Header, body, form); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	reply := p.runChatCommand(form.Get("command"), form.Get("text"))
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(reply)
+}
+
+func (p *PlayerServer) verifyChatCommand(header http.Header, body []byte, form url.Values) error {
+	if p.chat.SigningSecret != "" {
+		timestamp := header.Get(ChatTimestampHeader)
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("missing request timestamp")
+		}
+		if skew := time.Since(time.Unix(seconds, 0)); skew > maxChatClockSkew || skew < -maxChatClockSkew {
+			return fmt.Errorf("stale request timestamp")
+		}
+		want := SignChatCommand(p.chat.SigningSecret, timestamp, body)
+		if !hmac.Equal([]byte(header.Get(ChatSignatureHeader)), []byte(want)) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	}
+
+	if p.chat.Token != "" && subtle.ConstantTimeCompare([]byte(form.Get("token")), []byte(p.chat.Token)) == 1 {
+		return nil
+	}
+	return fmt.Errorf("invalid token")
+}
+
+func (p *PlayerServer) runChatCommand(command, text string) ChatReply {
+	args := strings.Fields(text)
+	sub := strings.TrimPrefix(command, "/")
+	prefix := command
+	switch sub {
+	case "win", "score", "league":
+		prefix = ""
+	default:
+		if len(args) == 0 {
+			return chatHelp(prefix)
+		}
+		sub, args = strings.ToLower(args[0]), args[1:]
+	}
+	name := strings.Join(args, " ")
+
+	switch sub {
+	case "win":
+		if name == "" {
+			return chatHelp(prefix)
+		}
+		if p.winCooldown != nil {
+			if ok, wait := p.winCooldown.Allow(name); !ok {
+				return ChatReply{"ephemeral", fmt.Sprintf("Too soon, try again in %s.", wait.Round(time.Second))}
+			}
+		}
+		if err := p.recordWins(name); err != nil {
+			p.releaseWins(name)
+			return ChatReply{"ephemeral", fmt.Sprintf("Couldn't record the win, %v.", err)}
+		}
+		return ChatReply{"in_channel", fmt.Sprintf("Recorded a win for *%s*, %s now.", name, plural(p.store.GetPlayerScore(name), "win"))}
+
+	case "score":
+		if name == "" {
+			return chatHelp(prefix)
+		}
+		rank, ok := p.store.GetPlayerRank(name, CompetitionRank)
+		if !ok {
+			return ChatReply{"ephemeral", fmt.Sprintf("*%s* has no wins yet.", name)}
+		}
+		return ChatReply{"ephemeral", fmt.Sprintf("*%s* has %s, rank %d.", rank.Name, plural(rank.Wins, "win"), rank.Rank)}
+
+	case "league":
+		n := defaultChatTop
+		if len(args) == 2 && strings.ToLower(args[0]) == "top" {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 || n > maxChatTop {
+				return ChatReply{"ephemeral", fmt.Sprintf("Ask for the top 1 to %d players.", maxChatTop)}
+			}
+		} else if len(args) != 0 {
+			return chatHelp(prefix)
+		}
+		return ChatReply{"in_channel", formatChatLeague(p.store.GetLeague(), n)}
+	}
+	return chatHelp(prefix)
+}
+
+func formatChatLeague(league League, n int) string {
+	if len(league) == 0 {
+		return "Nobody has won yet."
+	}
+	if len(league) > n {
+		league = league[:n]
+	}
+
+	var b strings.Builder
+	b.WriteString("*League*")
+	for _, r := range league.Ranks(CompetitionRank) {
+		fmt.Fprintf(&b, "\n%d. %s, %s", r.Rank, r.Name, plural(r.Wins, "win"))
+	}
+	return b.String()
+}
+
+// chatHelp lists the subcommands after the prefix, the name of the slash
+// command unless it is named after a subcommand
+func chatHelp(prefix string) ChatReply {
+	if prefix != "" {
+		prefix += " "
+	}
+	return ChatReply{"ephemeral", fmt.Sprintf("Usage:\n`/%[1]swin <player>` records a win\n`/%[1]sscore <player>` shows the wins of a player\n`/%[1]sleague top <n>` shows the best players", strings.TrimPrefix(prefix, "/"))}
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
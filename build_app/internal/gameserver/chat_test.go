@@ -0,0 +1,128 @@
+package gameserver_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+)
+
+const chatSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+func TestChatCommands(t *testing.T) {
+	newServer := func() (*gs.PlayerServer, *StubPlayerStore) {
+		store := &StubPlayerStore{
+			scores: map[string]int{"Cleo": 32, "Chris": 20, "Tiest": 20},
+			league: []gs.Player{{"Cleo", 32}, {"Chris", 20}, {"Tiest", 20}, {"Pepper", 1}},
+		}
+		return gs.NewServer(store, gs.WithChatCommands(gs.ChatConfig{SigningSecret: chatSecret})), store
+	}
+
+	cases := []struct {
+		command, text string
+		want          gs.ChatReply
+	}{
+		{"/game", "score Chris", gs.ChatReply{ResponseType: "ephemeral", Text: "*Chris* has 20 wins, rank 2."}},
+		{"/score", "Apollo", gs.ChatReply{ResponseType: "ephemeral", Text: "*Apollo* has no wins yet."}},
+		{"/game", "league top 3", gs.ChatReply{ResponseType: "in_channel", Text: "*League*\n1. Cleo, 32 wins\n2. Chris, 20 wins\n2. Tiest, 20 wins"}},
+		{"/league", "", gs.ChatReply{ResponseType: "in_channel", Text: "*League*\n1. Cleo, 32 wins\n2. Chris, 20 wins\n2. Tiest, 20 wins\n4. Pepper, 1 win"}},
+		{"/game", "league top 100", gs.ChatReply{ResponseType: "ephemeral", Text: "Ask for the top 1 to 25 players."}},
+		{"/game", "lose Cleo", gs.ChatReply{ResponseType: "ephemeral", Text: "Usage:\n`/game win <player>` records a win\n`/game score <player>` shows the wins of a player\n`/game league top <n>` shows the best players"}},
+	}
+	for _, c := range cases {
+		t.Run(c.command+" "+c.text, func(t *testing.T) {
+			server, _ := newServer()
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newChatRequest(c.command, c.text, time.Now()))
+
+			assertStatusCode(t, response.Code, http.StatusOK)
+			assertChatReply(t, response, c.want)
+		})
+	}
+
+	t.Run("records wins", func(t *testing.T) {
+		server, store := newServer()
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newChatRequest("/win", "Cleo", time.Now()))
+
+		assertChatReply(t, response, gs.ChatReply{ResponseType: "in_channel", Text: "Recorded a win for *Cleo*, 32 wins now."})
+		if len(store.winCalls) != 1 || store.winCalls[0] != "Cleo" {
+			t.Errorf("got wins %v want [Cleo]", store.winCalls)
+		}
+	})
+
+	t.Run("refuses bad signatures", func(t *testing.T) {
+		server, store := newServer()
+		request := newChatRequest("/win", "Cleo", time.Now())
+		request.Header.Set(gs.ChatSignatureHeader, "v0=00")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		if len(store.winCalls) != 0 {
+			t.Errorf("got wins %v want none", store.winCalls)
+		}
+	})
+
+	t.Run("refuses replayed requests", func(t *testing.T) {
+		server, _ := newServer()
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newChatRequest("/win", "Cleo", time.Now().Add(-time.Hour)))
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("accepts tokens", func(t *testing.T) {
+		server := gs.NewServer(&StubPlayerStore{}, gs.WithChatCommands(gs.ChatConfig{Token: "xyz"}))
+		form := url.Values{"command": {"/win"}, "text": {"Cleo"}}
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newFormRequest(form))
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+
+		form.Set("token", "xyz")
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newFormRequest(form))
+		assertStatusCode(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		server := gs.NewServer(&StubPlayerStore{})
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newChatRequest("/win", "Cleo", time.Now()))
+
+		assertStatusCode(t, response.Code, http.StatusNotFound)
+	})
+}
+
+func newChatRequest(command, text string, at time.Time) *http.Request {
+	form := url.Values{"command": {command}, "text": {text}, "user_name": {"cleo"}}
+	request := newFormRequest(form)
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	request.Header.Set(gs.ChatTimestampHeader, timestamp)
+	request.Header.Set(gs.ChatSignatureHeader, gs.SignChatCommand(chatSecret, timestamp, []byte(form.Encode())))
+	return request
+}
+
+func newFormRequest(form url.Values) *http.Request {
+	request := httptest.NewRequest(http.MethodPost, "/chat/command", strings.NewReader(form.Encode()))
+	request.Header.Set("content-type", "application/x-www-form-urlencoded")
+	return request
+}
+
+func assertChatReply(t *testing.T, response *httptest.ResponseRecorder, want gs.ChatReply) {
+	t.Helper()
+	var got gs.ChatReply
+	if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+		t.Fatalf("Unable to parse reply %q, %v", response.Body, err)
+	}
+	if got != want {
+		t.Errorf("got %#v want %#v", got, want)
+	}
+}
@@ -0,0 +1,206 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SchemaVersion is the version of the database envelope written by this build
+const SchemaVersion = 2
+
+// ErrNewerSchema is returned for databases written by a newer build
+var ErrNewerSchema = errors.New("database schema is newer than supported")
+
+// ErrLimitExceeded is returned when a database doesn't fit into Limits
+var ErrLimitExceeded = errors.New("database exceeds limits")
+
+// Database is the versioned on-disk envelope of the league. Since version 2
+// the envelope may be followed by Delta records, one per line
+type Database struct {
+	Version int              `json:"version"`
+	Players League           `json:"players"`
+	Keys    []IdempotencyKey `json:"idempotency_keys,omitempty"`
+	Buckets []WinBucket      `json:"buckets,omitempty"`
+	// DailyBuckets hold the wins of days no longer kept in hourly Buckets
+	DailyBuckets []WinBucket `json:"daily_buckets,omitempty"`
+}
+
+// IdempotencyKey remembers the win recorded with an Idempotency-Key
+type IdempotencyKey struct {
+	Key  string    `json:"key"`
+	Name string    `json:"name"`
+	At   time.Time `json:"at"`
+}
+
+// Delta is a small change appended to the database instead of rewriting it.
+// Wins carry the time they were recorded at, those recorded with an
+// Idempotency-Key carry the key as well
+type Delta struct {
+	Win string     `json:"win"`
+	Key string     `json:"key,omitempty"`
+	At  *time.Time `json:"at,omitempty"`
+}
+
+// ChangeLog is passed the changes of a store in the order they are made,
+// while no other change can be made, see the replication package
+type ChangeLog interface {
+	// Wins is passed the deltas of recorded wins
+	Wins(ds []Delta)
+	// Reset tells that the whole database was replaced
+	Reset()
+}
+
+// Limits bound the memory used while decoding a database, zero means no limit
+type Limits struct {
+	MaxPlayers    int
+	MaxNameLength int
+}
+
+// ReadDatabase decodes a database from rdr applying the deltas that follow
+// it. Legacy databases holding a bare array of players are returned with
+// Version 0
+func ReadDatabase(rdr io.Reader) (Database, error) {
+	dec := json.NewDecoder(rdr)
+	db, err := DecodeDatabase(dec, Limits{})
+	if err != nil {
+		return db, err
+	}
+
+	index := make(map[string]int, len(db.Players))
+	for i, p := range db.Players {
+		index[p.Name] = i
+	}
+	_, err = DecodeDeltas(dec, func(d Delta) error {
+		if i, ok := index[d.Win]; ok {
+			db.Players[i].Wins++
+		} else {
+			index[d.Win] = len(db.Players)
+			db.Players = append(db.Players, Player{Name: d.Win, Wins: 1})
+		}
+		return nil
+	})
+	return db, err
+}
+
+// DecodeDatabase reads the database envelope from dec token by token, so only
+// the players themselves are kept in memory
+func DecodeDatabase(dec *json.Decoder, limits Limits) (Database, error) {
+	var db Database
+
+	tok, err := dec.Token()
+	if err != nil {
+		return db, fmt.Errorf("problem parsing league, %v", err)
+	}
+
+	switch tok {
+	case json.Delim('['):
+		db.Players, err = decodePlayers(dec, limits)
+		return db, err
+	case json.Delim('{'):
+	default:
+		return db, fmt.Errorf("problem parsing league, unexpected %v", tok)
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return db, fmt.Errorf("problem parsing league, %v", err)
+		}
+
+		switch tok {
+		case "version":
+			err = dec.Decode(&db.Version)
+		case "players":
+			err = expectDelim(dec, '[')
+			if err == nil {
+				db.Players, err = decodePlayers(dec, limits)
+			}
+		case "idempotency_keys":
+			err = dec.Decode(&db.Keys)
+		case "buckets":
+			err = dec.Decode(&db.Buckets)
+		case "daily_buckets":
+			err = dec.Decode(&db.DailyBuckets)
+		default:
+			err = dec.Decode(&json.RawMessage{})
+		}
+		if err != nil {
+			return db, fmt.Errorf("problem parsing league, %v", err)
+		}
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return db, fmt.Errorf("problem parsing league, %v", err)
+	}
+	if db.Version < 1 {
+		return db, fmt.Errorf("problem parsing league, invalid schema version %d", db.Version)
+	}
+	return db, nil
+}
+
+// decodePlayers reads players up to the closing bracket of the array
+func decodePlayers(dec *json.Decoder, limits Limits) (League, error) {
+	league := League{}
+	for dec.More() {
+		var p Player
+		if err := dec.Decode(&p); err != nil {
+			return nil, fmt.Errorf("problem parsing player, %v", err)
+		}
+		if err := limits.Check(len(league), p.Name); err != nil {
+			return nil, err
+		}
+		league = append(league, p)
+	}
+
+	if err := expectDelim(dec, ']'); err != nil {
+		return nil, fmt.Errorf("problem parsing league, %v", err)
+	}
+	return league, nil
+}
+
+// DecodeDeltas calls apply for each delta remaining in dec. It returns the
+// input offset just past the last complete delta, which lets callers drop a
+// delta torn by a crash: in that case the error wraps io.ErrUnexpectedEOF
+func DecodeDeltas(dec *json.Decoder, apply func(Delta) error) (int64, error) {
+	offset := dec.InputOffset()
+	for {
+		var d Delta
+		err := dec.Decode(&d)
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, fmt.Errorf("problem parsing delta at offset %d, %w", offset, err)
+		}
+		if err := apply(d); err != nil {
+			return offset, err
+		}
+		offset = dec.InputOffset()
+	}
+}
+
+// Check returns ErrLimitExceeded when adding a player with the given name to
+// a league of the given size doesn't fit the limits
+func (l Limits) Check(size int, name string) error {
+	if l.MaxPlayers > 0 && size >= l.MaxPlayers {
+		return fmt.Errorf("%w: more than %d players", ErrLimitExceeded, l.MaxPlayers)
+	}
+	if l.MaxNameLength > 0 && len(name) > l.MaxNameLength {
+		return fmt.Errorf("%w: name longer than %d bytes", ErrLimitExceeded, l.MaxNameLength)
+	}
+	return nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("expected %v, got %v", want, tok)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package gameserver
+
+import "time"
+
+// EventType names something that happened in the league
+type EventType string
+
+// Events published by stores and webhooks
+const (
+	EventWinRecorded EventType = "win.recorded"
+	EventNewLeader   EventType = "leader.changed"
+	EventMilestone   EventType = "player.milestone"
+	EventAchievement EventType = "achievement.awarded"
+)
+
+// EventTypes lists the known events
+var EventTypes = []EventType{EventWinRecorded, EventNewLeader, EventMilestone, EventAchievement}
+
+// Event is something that happened in the league. Wins are those of the
+// player after the event
+type Event struct {
+	Type           EventType `json:"type"`
+	At             time.Time `json:"at"`
+	Player         string    `json:"player"`
+	Wins           int       `json:"wins"`
+	PreviousLeader string    `json:"previous_leader,omitempty"`
+	Achievement    string    `json:"achievement,omitempty"`
+}
+
+// EventSink receives the events of a store. Publish is called while the
+// store is locked, so it must be quick and must not call the store
+type EventSink interface {
+	Publish(e Event)
+}
+
+// EventSinks publishes events to each of the sinks in turn
+type EventSinks []EventSink
+
+// Publish ...
+func (s EventSinks) Publish(e Event) {
+	for _, sink := range s {
+		sink.Publish(e)
+	}
+}
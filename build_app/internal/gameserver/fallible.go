@@ -0,0 +1,52 @@
+package gameserver
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// FallibleStore is implemented by stores whose writes may fail, like one
+// replicated across nodes that can't reach a majority. The server records
+// wins with it instead of RecordWin and RecordWins and answers 503 to the
+// wins that failed
+type FallibleStore interface {
+	// TryRecordWins records the wins at once, or none of them
+	TryRecordWins(names []string) error
+	// TryRecordWinOnce is RecordWinOnce of an IdempotentStore, failing when
+	// the win can't be recorded. It is only called on IdempotentStores
+	TryRecordWinOnce(name, key string) (recordedFor string, recorded bool, err error)
+}
+
+// recordWins records the wins with the store, only a FallibleStore fails
+func (p *PlayerServer) recordWins(names ...string) error {
+	if p.fallible != nil {
+		return p.fallible.TryRecordWins(names)
+	}
+	if len(names) == 1 {
+		p.store.RecordWin(names[0])
+	} else {
+		p.store.RecordWins(names)
+	}
+	return nil
+}
+
+// RecordWin records a win of a match played elsewhere, like in a
+// tournament, through the instrumented store. The win cooldown doesn't
+// apply, only a FallibleStore fails
+func (p *PlayerServer) RecordWin(name string) error {
+	return p.recordWins(name)
+}
+
+// recordWinOnce records a win with an idempotency key, only a FallibleStore
+// fails
+func (p *PlayerServer) recordWinOnce(name, key string) (string, bool, error) {
+	if p.fallible != nil {
+		return p.fallible.TryRecordWinOnce(name, key)
+	}
+	recordedFor, recorded := p.idempotent.RecordWinOnce(name, key)
+	return recordedFor, recorded, nil
+}
+
+func storeUnavailable(w http.ResponseWriter, err error) {
+	http.Error(w, fmt.Sprintf("problem recording win, %v", err), http.StatusServiceUnavailable)
+}
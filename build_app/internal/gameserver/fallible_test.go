@@ -0,0 +1,87 @@
+package gameserver_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	"github.com/windnow/edusrv/internal/ratelimit"
+)
+
+// StubFallibleStore fails every write while err is set
+type StubFallibleStore struct {
+	StubPlayerStore
+	err error
+}
+
+func (s *StubFallibleStore) TryRecordWins(names []string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.RecordWins(names)
+	return nil
+}
+
+func (s *StubFallibleStore) TryRecordWinOnce(name, key string) (string, bool, error) {
+	if s.err != nil {
+		return "", false, s.err
+	}
+	s.RecordWin(name)
+	return name, true, nil
+}
+
+func TestFallibleStore(t *testing.T) {
+	store := &StubFallibleStore{err: errors.New("no raft leader")}
+	server := gs.NewServer(store)
+
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, newPostWinRequest("Pepper"))
+	assertStatusCode(t, response.Code, http.StatusServiceUnavailable)
+
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, newBatchWinsRequest("application/json", `[{"name": "Pepper"}, {"name": ""}]`))
+	assertStatusCode(t, response.Code, http.StatusServiceUnavailable)
+	assertResponseBody(t, response.Body.String(),
+		`[{"name":"Pepper","status":503,"error":"no raft leader"},{"name":"","status":422,"error":"missing player name"}]`+"\n")
+
+	if err := server.RecordWin("Pepper"); err == nil {
+		t.Error("expected an error recording a win with a failing store")
+	}
+	if len(store.winCalls) != 0 {
+		t.Errorf("got wins %v recorded by a failing store", store.winCalls)
+	}
+
+	store.err = nil
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, newPostWinRequest("Pepper"))
+	assertStatusCode(t, response.Code, http.StatusAccepted)
+	if len(store.winCalls) != 1 || store.winCalls[0] != "Pepper" {
+		t.Errorf("got wins %v want [Pepper]", store.winCalls)
+	}
+}
+
+func TestFallibleStoreReleasesCooldown(t *testing.T) {
+	store := &StubFallibleStore{err: errors.New("no raft leader")}
+	clock := &fakeClock{time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)}
+	server := gs.NewServer(store, gs.WithWinCooldown(ratelimit.NewCooldown(time.Minute, clock)))
+
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, newPostWinRequest("Pepper"))
+	assertStatusCode(t, response.Code, http.StatusServiceUnavailable)
+
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, newBatchWinsRequest("application/json", `[{"name": "Pepper"}]`))
+	assertStatusCode(t, response.Code, http.StatusServiceUnavailable)
+
+	store.err = nil
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, newPostWinRequest("Pepper"))
+	assertStatusCode(t, response.Code, http.StatusAccepted)
+
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, newPostWinRequest("Pepper"))
+	assertStatusCode(t, response.Code, http.StatusTooManyRequests)
+}
@@ -0,0 +1,273 @@
+package gameserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/windnow/edusrv/internal/graphql"
+)
+
+const (
+	defaultGraphQLDepth      = 8
+	defaultGraphQLComplexity = 1000
+	defaultLeaguePage        = 10
+	maxLeaguePage            = 100
+)
+
+// WithGraphQLLimits bounds the depth and the complexity of GraphQL
+// queries, see graphql.Schema
+func WithGraphQLLimits(maxDepth, maxComplexity int) ServerOption {
+	return func(p *PlayerServer) {
+		p.graphQLDepth, p.graphQLComplexity = maxDepth, maxComplexity
+	}
+}
+
+// graphPlayer is the source of the Player object
+type graphPlayer struct {
+	name string
+	wins int
+}
+
+// newGraphQLSchema exposes the store as
+//
+//	type Query {
+//	  player(name: String!): Player
+//	  league(first: Int = 10, after: String, sort: LeagueSort = WINS): PlayerConnection!
+//	}
+//	type Mutation {
+//	  recordWin(name: String!): Player!
+//	}
+//	type Player { name: String!  wins: Int!  rank(mode: RankMode = COMPETITION): Int! }
+//	type PlayerConnection { totalCount: Int!  edges: [PlayerEdge!]!  nodes: [Player!]!  pageInfo: PageInfo! }
+//	type PlayerEdge { cursor: String!  node: Player! }
+//	type PageInfo { hasNextPage: Boolean!  endCursor: String }
+//	enum LeagueSort { WINS NAME }
+//	enum RankMode { COMPETITION DENSE }
+func (p *PlayerServer) newGraphQLSchema() *graphql.Schema {
+	// the whole page counts for every player in it, a little more than
+	// the fields of the connection itself cost
+	page := func(args map[string]interface{}) int {
+		if first := leaguePage(args); first > 1 {
+			return first
+		}
+		return 1
+	}
+	source := func(params graphql.ResolveParams) graphPlayer {
+		return params.Source.(graphPlayer)
+	}
+
+	return &graphql.Schema{
+		Query:         "Query",
+		Mutation:      "Mutation",
+		MaxDepth:      p.graphQLDepth,
+		MaxComplexity: p.graphQLComplexity,
+		Enums: map[string][]string{
+			"LeagueSort": {"WINS", "NAME"},
+			"RankMode":   {"COMPETITION", "DENSE"},
+		},
+		Objects: map[string]*graphql.Object{
+			"Query": {Fields: map[string]*graphql.Field{
+				"player": {
+					Type: "Player",
+					Args: map[string]*graphql.Arg{"name": {Type: "String!"}},
+					Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+						rank, ok := p.store.GetPlayerRank(params.Args["name"].(string), CompetitionRank)
+						if !ok {
+							return nil, nil
+						}
+						return graphPlayer{rank.Name, rank.Wins}, nil
+					},
+				},
+				"league": {
+					Type: "PlayerConnection!",
+					Args: map[string]*graphql.Arg{
+						"first": {Type: "Int", Default: defaultLeaguePage},
+						"after": {Type: "String"},
+						"sort":  {Type: "LeagueSort", Default: "WINS"},
+					},
+					Resolve: p.resolveLeague,
+					Cost:    page,
+				},
+			}},
+			"Mutation": {Fields: map[string]*graphql.Field{
+				"recordWin": {
+					Type: "Player!",
+					Args: map[string]*graphql.Arg{"name": {Type: "String!"}},
+					Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+						name := params.Args["name"].(string)
+						if name == "" {
+							return nil, fmt.Errorf("missing player name")
+						}
+						if p.winCooldown != nil {
+							if ok, wait := p.winCooldown.Allow(name); !ok {
+								return nil, fmt.Errorf("win cooldown, retry after %s", wait)
+							}
+						}
+						if err := p.recordWins(name); err != nil {
+							p.releaseWins(name)
+							return nil, fmt.Errorf("problem recording win, %v", err)
+						}
+						return graphPlayer{name, p.store.GetPlayerScore(name)}, nil
+					},
+				},
+			}},
+			"Player": {Fields: map[string]*graphql.Field{
+				"name": {Type: "String!", Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					return source(params).name, nil
+				}},
+				"wins": {Type: "Int!", Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					return source(params).wins, nil
+				}},
+				"rank": {
+					Type: "Int!",
+					Args: map[string]*graphql.Arg{"mode": {Type: "RankMode", Default: "COMPETITION"}},
+					Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+						// an explicit null means the default like a missing mode
+						mode := CompetitionRank
+						if name, ok := params.Args["mode"].(string); ok {
+							var err error
+							if mode, err = ParseRankMode(strings.ToLower(name)); err != nil {
+								return nil, err
+							}
+						}
+						rank, ok := p.store.GetPlayerRank(source(params).name, mode)
+						if !ok {
+							return nil, nil
+						}
+						return rank.Rank, nil
+					},
+				},
+			}},
+			"PlayerConnection": {Fields: map[string]*graphql.Field{
+				"totalCount": {Type: "Int!"},
+				"edges":      {Type: "[PlayerEdge!]!"},
+				"nodes":      {Type: "[Player!]!"},
+				"pageInfo":   {Type: "PageInfo!"},
+			}},
+			"PlayerEdge": {Fields: map[string]*graphql.Field{
+				"cursor": {Type: "String!"},
+				"node":   {Type: "Player!"},
+			}},
+			"PageInfo": {Fields: map[string]*graphql.Field{
+				"hasNextPage": {Type: "Boolean!"},
+				"endCursor":   {Type: "String"},
+			}},
+		},
+	}
+}
+
+// leaguePage is the size of the league page asked for, the default one
+// when first is null
+func leaguePage(args map[string]interface{}) int {
+	if first, ok := args["first"].(int); ok {
+		return first
+	}
+	return defaultLeaguePage
+}
+
+// resolveLeague returns a page of the league, cursors being positions in
+// the sorted league
+func (p *PlayerServer) resolveLeague(params graphql.ResolveParams) (interface{}, error) {
+	first := leaguePage(params.Args)
+	if first < 0 || first > maxLeaguePage {
+		return nil, fmt.Errorf("first must be a number from 0 to %d", maxLeaguePage)
+	}
+
+	league := p.store.GetLeague()
+	if params.Args["sort"] == "NAME" {
+		league = append(League{}, league...)
+		sort.SliceStable(league, func(i, j int) bool {
+			return league[i].Name < league[j].Name
+		})
+	}
+
+	start := 0
+	if after, ok := params.Args["after"].(string); ok {
+		position, err := decodeCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		start = position + 1
+	}
+	if start > len(league) {
+		start = len(league)
+	}
+	end := start + first
+	if end > len(league) {
+		end = len(league)
+	}
+
+	edges := make([]interface{}, 0, end-start)
+	nodes := make([]interface{}, 0, end-start)
+	var endCursor interface{}
+	for i, player := range league[start:end] {
+		cursor := encodeCursor(start + i)
+		node := graphPlayer{player.Name, player.Wins}
+		edges = append(edges, map[string]interface{}{"cursor": cursor, "node": node})
+		nodes = append(nodes, node)
+		endCursor = cursor
+	}
+
+	return map[string]interface{}{
+		"totalCount": len(league),
+		"edges":      edges,
+		"nodes":      nodes,
+		"pageInfo": map[string]interface{}{
+			"hasNextPage": end < len(league),
+			"endCursor":   endCursor,
+		},
+	}, nil
+}
+
+func encodeCursor(position int) string {
+	return base64.StdEncoding.EncodeToString([]byte("position:" + strconv.Itoa(position)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	b, err := base64.StdEncoding.DecodeString(cursor)
+	if err == nil {
+		if position, err := strconv.Atoi(strings.TrimPrefix(string(b), "position:")); err == nil && position >= 0 {
+			return position, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid cursor %q", cursor)
+}
+
+// graphQLHandler serves POST requests with a JSON body and GET requests
+// with the query in the URL, which can't run mutations
+func (p *PlayerServer) graphQLHandler(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Query, req.OperationName = query.Get("query"), query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				http.Error(w, fmt.Sprintf("problem parsing variables, %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("problem parsing request, %v", err), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := p.graphQL.Execute(r.Context(), req, r.Method == http.MethodGet)
+
+	w.Header().Set("content-type", "application/json")
+	if resp.Data == nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
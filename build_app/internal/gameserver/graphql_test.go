@@ -0,0 +1,154 @@
+package gameserver_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	"github.com/windnow/edusrv/internal/graphql"
+)
+
+func TestGraphQL(t *testing.T) {
+	newServer := func(options ...gs.ServerOption) (*gs.PlayerServer, *StubPlayerStore) {
+		store := &StubPlayerStore{
+			scores: map[string]int{"Cleo": 32, "Chris": 20, "Tiest": 20},
+			league: []gs.Player{{"Cleo", 32}, {"Chris", 20}, {"Tiest", 20}},
+		}
+		return gs.NewServer(store, options...), store
+	}
+
+	t.Run("player with ranks", func(t *testing.T) {
+		server, _ := newServer()
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGraphQLRequest(t, graphql.Request{
+			Query: `query($name: String!) {
+				player(name: $name) { name wins rank dense: rank(mode: DENSE) }
+				nobody: player(name: "Apollo") { name }
+			}`,
+			Variables: map[string]interface{}{"name": "Tiest"},
+		}))
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertContentType(t, response, "application/json")
+		assertResponseBody(t, response.Body.String(),
+			`{"data":{"player":{"name":"Tiest","wins":20,"rank":2,"dense":2},"nobody":null}}`+"\n")
+	})
+
+	t.Run("pages through the league", func(t *testing.T) {
+		server, _ := newServer()
+		query := `query($after: String) {
+			league(first: 2, after: $after, sort: NAME) {
+				totalCount nodes { name } pageInfo { hasNextPage endCursor }
+			}
+		}`
+
+		var page struct {
+			Data struct {
+				League struct {
+					TotalCount int
+					Nodes      []struct{ Name string }
+					PageInfo   struct {
+						HasNextPage bool
+						EndCursor   string
+					}
+				}
+			}
+		}
+		var names []string
+		variables := map[string]interface{}{}
+		for {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newGraphQLRequest(t, graphql.Request{Query: query, Variables: variables}))
+			assertStatusCode(t, response.Code, http.StatusOK)
+			if err := json.NewDecoder(response.Body).Decode(&page); err != nil {
+				t.Fatalf("Unable to parse response, %v", err)
+			}
+
+			for _, node := range page.Data.League.Nodes {
+				names = append(names, node.Name)
+			}
+			if !page.Data.League.PageInfo.HasNextPage {
+				break
+			}
+			variables["after"] = page.Data.League.PageInfo.EndCursor
+		}
+
+		if page.Data.League.TotalCount != 3 {
+			t.Errorf("got totalCount %d want %d", page.Data.League.TotalCount, 3)
+		}
+		assertResponseBody(t, fmt.Sprint(names), "[Chris Cleo Tiest]")
+	})
+
+	t.Run("takes null arguments for their defaults", func(t *testing.T) {
+		server, _ := newServer()
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGraphQLRequest(t, graphql.Request{
+			Query: `{
+				league(first: null, sort: null) { totalCount }
+				player(name: "Tiest") { rank(mode: null) }
+			}`,
+		}))
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(),
+			`{"data":{"league":{"totalCount":3},"player":{"rank":2}}}`+"\n")
+	})
+
+	t.Run("records wins", func(t *testing.T) {
+		server, store := newServer()
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGraphQLRequest(t, graphql.Request{
+			Query: `mutation { recordWin(name: "Pepper") { name } }`,
+		}))
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), `{"data":{"recordWin":{"name":"Pepper"}}}`+"\n")
+		if len(store.winCalls) != 1 || store.winCalls[0] != "Pepper" {
+			t.Errorf("got wins %v want [Pepper]", store.winCalls)
+		}
+	})
+
+	t.Run("refuses mutations over GET", func(t *testing.T) {
+		server, store := newServer()
+		query := url.Values{"query": {`mutation { recordWin(name: "Pepper") { name } }`}}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/graphql?"+query.Encode(), nil))
+
+		assertStatusCode(t, response.Code, http.StatusBadRequest)
+		if len(store.winCalls) != 0 {
+			t.Errorf("got wins %v want none", store.winCalls)
+		}
+	})
+
+	t.Run("answers queries over GET", func(t *testing.T) {
+		server, _ := newServer()
+		query := url.Values{"query": {`{ league(first: 1) { nodes { name } } }`}}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/graphql?"+query.Encode(), nil))
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertResponseBody(t, response.Body.String(), `{"data":{"league":{"nodes":[{"name":"Cleo"}]}}}`+"\n")
+	})
+
+	t.Run("limits complexity", func(t *testing.T) {
+		server, _ := newServer(gs.WithGraphQLLimits(5, 50))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newGraphQLRequest(t, graphql.Request{
+			Query: `{ league(first: 100) { edges { cursor node { name wins rank } } } }`,
+		}))
+
+		assertStatusCode(t, response.Code, http.StatusBadRequest)
+	})
+}
+
+func newGraphQLRequest(t *testing.T, req graphql.Request) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(req)
+	assertNoError(t, err)
+	return httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+}
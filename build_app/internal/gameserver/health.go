@@ -0,0 +1,45 @@
+package gameserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const readinessTimeout = 2 * time.Second
+
+// Checker is implemented by stores that can tell whether they are able to
+// serve requests
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// Shutdown marks the server as not ready, so it stops getting new traffic
+// while the requests in flight are finished
+func (p *PlayerServer) Shutdown() {
+	p.shuttingDown.Store(true)
+}
+
+func (p *PlayerServer) healthHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "ok")
+}
+
+func (p *PlayerServer) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if p.shuttingDown.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	if p.checker != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		if err := p.checker.Check(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	fmt.Fprint(w, "ok")
+}
@@ -0,0 +1,126 @@
+package gameserver_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	. "github.com/windnow/edusrv/internal/helpers"
+	fs "github.com/windnow/edusrv/internal/infsstore"
+)
+
+type StubCheckedStore struct {
+	StubPlayerStore
+	err error
+}
+
+func (s *StubCheckedStore) Check(ctx context.Context) error {
+	return s.err
+}
+
+func TestHealth(t *testing.T) {
+	t.Run("healthz", func(t *testing.T) {
+		server := gs.NewServer(&StubCheckedStore{err: errors.New("broken")})
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newHealthRequest("/healthz"))
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("ready without a checker", func(t *testing.T) {
+		server := gs.NewServer(&StubPlayerStore{})
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newHealthRequest("/readyz"))
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("not ready when the check fails", func(t *testing.T) {
+		server := gs.NewServer(&StubCheckedStore{err: errors.New("broken")})
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newHealthRequest("/readyz"))
+
+		assertStatusCode(t, response.Code, http.StatusServiceUnavailable)
+		assertResponseBody(t, response.Body.String(), "broken\n")
+	})
+
+	t.Run("not ready during shutdown", func(t *testing.T) {
+		server := gs.NewServer(&StubCheckedStore{})
+		server.Shutdown()
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newHealthRequest("/readyz"))
+		assertStatusCode(t, response.Code, http.StatusServiceUnavailable)
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newHealthRequest("/healthz"))
+		assertStatusCode(t, response.Code, http.StatusOK)
+	})
+}
+
+func TestFileSystemStoreCheck(t *testing.T) {
+	t.Run("ready", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, "")
+		defer cleanDatabase()
+		store, err := fs.NewFileSystemPlayerStore(database, fs.WithMinFreeSpace(0))
+		assertNoError(t, err)
+
+		assertNoError(t, store.Check(context.Background()))
+	})
+
+	t.Run("closed file", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, "")
+		defer cleanDatabase()
+		store, err := fs.NewFileSystemPlayerStore(database, fs.WithMinFreeSpace(0))
+		assertNoError(t, err)
+
+		database.Close()
+		if err := store.Check(context.Background()); err == nil {
+			t.Error("expected an error but didn't get one")
+		}
+	})
+
+	t.Run("disk full", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, "")
+		defer cleanDatabase()
+		store, err := fs.NewFileSystemPlayerStore(database, fs.WithMinFreeSpace(1<<62))
+		assertNoError(t, err)
+
+		if err := store.Check(context.Background()); err == nil {
+			t.Error("expected an error but didn't get one")
+		}
+	})
+}
+
+func newHealthRequest(path string) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	return req
+}
+
+func TestRequireAdmin(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	cases := []struct {
+		name, token, header string
+		want                int
+	}{
+		{"disabled without a token", "", "Bearer ", http.StatusForbidden},
+		{"refuses requests without the token", "secret", "", http.StatusUnauthorized},
+		{"refuses another token", "secret", "Bearer guess", http.StatusUnauthorized},
+		{"passes requests with the token", "secret", "Bearer secret", http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/admin/import", nil)
+			if c.header != "" {
+				request.Header.Set("Authorization", c.header)
+			}
+			response := httptest.NewRecorder()
+			gs.RequireAdmin(c.token, next).ServeHTTP(response, request)
+
+			assertStatusCode(t, response.Code, c.want)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package gameserver
+
+import (
+	"net/http"
+)
+
+// Headers of idempotent requests
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	errIdempotencyUnsupported = "idempotency keys are not supported by the store"
+)
+
+// MaxIdempotencyKeyLength is the longest idempotency key accepted, stores
+// keep the keys for a while
+const MaxIdempotencyKeyLength = 255
+
+// IdempotentStore is implemented by stores that remember the keys wins were
+// recorded with for a while, so retried requests don't count twice
+type IdempotentStore interface {
+	// LookupWinKey returns the player a win was recorded for with key
+	LookupWinKey(key string) (name string, ok bool)
+	// RecordWinOnce records a win for name unless one was recorded with
+	// key already, returning the player the key was used for
+	RecordWinOnce(name, key string) (recordedFor string, recorded bool)
+}
+
+// processIdempotentWin records a win at most once per key, replaying the
+// original response to retries
+func (p *PlayerServer) processIdempotentWin(w http.ResponseWriter, player, key string) {
+	if p.idempotent == nil {
+		http.Error(w, errIdempotencyUnsupported, http.StatusNotImplemented)
+		return
+	}
+	if len(key) > MaxIdempotencyKeyLength {
+		http.Error(w, "idempotency key is too long", http.StatusBadRequest)
+		return
+	}
+
+	if name, ok := p.idempotent.LookupWinKey(key); ok {
+		p.replayWin(w, player, name)
+		return
+	}
+
+	if !p.allowWin(w, player) {
+		return
+	}
+
+	name, recorded, err := p.recordWinOnce(player, key)
+	if err != nil {
+		p.releaseWins(player)
+		storeUnavailable(w, err)
+		return
+	}
+	if !recorded {
+		p.releaseWins(player)
+		p.replayWin(w, player, name)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (p *PlayerServer) replayWin(w http.ResponseWriter, player, recordedFor string) {
+	if player != recordedFor {
+		http.Error(w, "idempotency key was used for another player", http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,134 @@
+package gameserver_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	. "github.com/windnow/edusrv/internal/helpers"
+	fs "github.com/windnow/edusrv/internal/infsstore"
+)
+
+func TestIdempotentWins(t *testing.T) {
+	t.Run("records a win once per key", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, "")
+		defer cleanDatabase()
+		store, err := fs.NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+		server := gs.NewServer(store)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newIdempotentWinRequest("Pepper", "game-1"))
+		assertStatusCode(t, response.Code, http.StatusAccepted)
+		assertResponseBody(t, response.Header().Get(gs.IdempotentReplayedHeader), "")
+
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, newIdempotentWinRequest("Pepper", "game-1"))
+		assertStatusCode(t, response.Code, http.StatusAccepted)
+		assertResponseBody(t, response.Header().Get(gs.IdempotentReplayedHeader), "true")
+
+		server.ServeHTTP(httptest.NewRecorder(), newIdempotentWinRequest("Pepper", "game-2"))
+		assertScoreEquals(t, store.GetPlayerScore("Pepper"), 2)
+	})
+
+	t.Run("refuses a key used for another player", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, "")
+		defer cleanDatabase()
+		store, err := fs.NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+		server := gs.NewServer(store)
+
+		server.ServeHTTP(httptest.NewRecorder(), newIdempotentWinRequest("Pepper", "game-1"))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newIdempotentWinRequest("Cleo", "game-1"))
+
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+		assertScoreEquals(t, store.GetPlayerScore("Cleo"), 0)
+	})
+
+	t.Run("needs a store remembering keys", func(t *testing.T) {
+		store := &StubPlayerStore{}
+		server := gs.NewServer(store)
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, newIdempotentWinRequest("Pepper", "game-1"))
+
+		assertStatusCode(t, response.Code, http.StatusNotImplemented)
+		if len(store.winCalls) != 0 {
+			t.Errorf("got %d calls to RecordWin want none", len(store.winCalls))
+		}
+	})
+}
+
+func TestFileSystemStoreIdempotencyKeys(t *testing.T) {
+	clock := &fakeClock{time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)}
+	open := func(t *testing.T, database *os.File) *fs.FileSystemPlayerStore {
+		store, err := fs.NewFileSystemPlayerStore(database,
+			fs.WithIdempotencyWindow(time.Hour), fs.WithClock(clock.Now))
+		assertNoError(t, err)
+		return store
+	}
+
+	t.Run("remembers keys across restarts", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, "")
+		defer cleanDatabase()
+
+		open(t, database).RecordWinOnce("Pepper", "game-1")
+
+		reopened := open(t, database)
+		name, ok := reopened.LookupWinKey("game-1")
+		if !ok || name != "Pepper" {
+			t.Errorf("got %q, %v want %q, true", name, ok, "Pepper")
+		}
+		if _, recorded := reopened.RecordWinOnce("Pepper", "game-1"); recorded {
+			t.Error("recorded the same key twice")
+		}
+		assertScoreEquals(t, reopened.GetPlayerScore("Pepper"), 1)
+	})
+
+	t.Run("keeps keys when compacting", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, "")
+		defer cleanDatabase()
+
+		store := open(t, database)
+		store.RecordWinOnce("Pepper", "game-1")
+		store.ReplaceLeague(store.GetLeague())
+
+		database.Seek(0, 0)
+		content, _ := ioutil.ReadAll(database)
+		if !strings.Contains(string(content), `"idempotency_keys":[{"key":"game-1","name":"Pepper"`) {
+			t.Errorf("keys missing from %s", content)
+		}
+		if _, ok := open(t, database).LookupWinKey("game-1"); !ok {
+			t.Error("forgot the key")
+		}
+	})
+
+	t.Run("forgets keys after the window", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, "")
+		defer cleanDatabase()
+
+		store := open(t, database)
+		store.RecordWinOnce("Pepper", "game-1")
+		clock.now = clock.now.Add(time.Hour)
+
+		if _, ok := store.LookupWinKey("game-1"); ok {
+			t.Error("still remembers the key")
+		}
+		if _, recorded := store.RecordWinOnce("Pepper", "game-1"); !recorded {
+			t.Error("didn't record the win")
+		}
+		assertScoreEquals(t, store.GetPlayerScore("Pepper"), 2)
+	})
+}
+
+func newIdempotentWinRequest(name, key string) *http.Request {
+	request := newPostWinRequest(name)
+	request.Header.Set(gs.IdempotencyKeyHeader, key)
+	return request
+}
@@ -0,0 +1,134 @@
+package gameserver
+
+import (
+	"time"
+
+	"github.com/windnow/edusrv/internal/metrics"
+)
+
+// StoreStats describe the size of a store
+type StoreStats struct {
+	Players     int
+	FileSize    int64
+	WriteErrors uint64
+}
+
+// StatsReporter is implemented by stores that can report their size cheaply
+type StatsReporter interface {
+	Stats() StoreStats
+}
+
+// instrumentedStore observes the latency of store operations
+type instrumentedStore struct {
+	PlayerStore
+	latency *metrics.HistogramVec
+	wins    *metrics.Counter
+}
+
+func instrumentStore(store PlayerStore, reg *metrics.Registry) PlayerStore {
+	s := &instrumentedStore{
+		PlayerStore: store,
+		latency: reg.NewHistogramVec("gamelogger_store_operation_duration_seconds",
+			"Latency of player store operations.",
+			metrics.DefBuckets, "operation"),
+		wins: reg.NewCounter("gamelogger_wins_recorded_total",
+			"Number of wins recorded since the start."),
+	}
+
+	if stats, ok := store.(StatsReporter); ok {
+		reg.NewGaugeFunc("gamelogger_players", "Number of players in the league.", func() float64 {
+			return float64(stats.Stats().Players)
+		})
+		reg.NewGaugeFunc("gamelogger_db_file_size_bytes", "Size of the database file.", func() float64 {
+			return float64(stats.Stats().FileSize)
+		})
+		reg.NewCounterFunc("gamelogger_store_write_errors_total", "Number of failed writes to the database.", func() float64 {
+			return float64(stats.Stats().WriteErrors)
+		})
+	}
+
+	return s
+}
+
+func (s *instrumentedStore) observe(operation string, start time.Time) {
+	s.latency.With(operation).Observe(time.Since(start).Seconds())
+}
+
+func (s *instrumentedStore) GetPlayerScore(name string) int {
+	defer s.observe("get_player_score", time.Now())
+	return s.PlayerStore.GetPlayerScore(name)
+}
+
+func (s *instrumentedStore) RecordWin(name string) {
+	defer s.observe("record_win", time.Now())
+	s.PlayerStore.RecordWin(name)
+	s.wins.Inc()
+}
+
+func (s *instrumentedStore) RecordWins(names []string) {
+	defer s.observe("record_wins", time.Now())
+	s.PlayerStore.RecordWins(names)
+	s.wins.Add(float64(len(names)))
+}
+
+func (s *instrumentedStore) GetLeague() League {
+	defer s.observe("get_league", time.Now())
+	return s.PlayerStore.GetLeague()
+}
+
+func (s *instrumentedStore) GetPlayerRank(name string, mode RankMode) (Rank, bool) {
+	defer s.observe("get_player_rank", time.Now())
+	return s.PlayerStore.GetPlayerRank(name, mode)
+}
+
+func (s *instrumentedStore) GetLeagueAround(name string, n int, mode RankMode) ([]Rank, bool) {
+	defer s.observe("get_league_around", time.Now())
+	return s.PlayerStore.GetLeagueAround(name, n, mode)
+}
+
+// LookupWinKey must only be called when the instrumented store is an
+// IdempotentStore
+func (s *instrumentedStore) LookupWinKey(key string) (string, bool) {
+	defer s.observe("lookup_win_key", time.Now())
+	return s.PlayerStore.(IdempotentStore).LookupWinKey(key)
+}
+
+// RecordWinOnce must only be called when the instrumented store is an
+// IdempotentStore
+func (s *instrumentedStore) RecordWinOnce(name, key string) (string, bool) {
+	defer s.observe("record_win_once", time.Now())
+	recordedFor, recorded := s.PlayerStore.(IdempotentStore).RecordWinOnce(name, key)
+	if recorded {
+		s.wins.Inc()
+	}
+	return recordedFor, recorded
+}
+
+// TryRecordWins must only be called when the instrumented store is a
+// FallibleStore
+func (s *instrumentedStore) TryRecordWins(names []string) error {
+	defer s.observe("record_wins", time.Now())
+	if err := s.PlayerStore.(FallibleStore).TryRecordWins(names); err != nil {
+		return err
+	}
+	s.wins.Add(float64(len(names)))
+	return nil
+}
+
+// TryRecordWinOnce must only be called when the instrumented store is a
+// FallibleStore
+func (s *instrumentedStore) TryRecordWinOnce(name, key string) (string, bool, error) {
+	defer s.observe("record_win_once", time.Now())
+	recordedFor, recorded, err := s.PlayerStore.(FallibleStore).TryRecordWinOnce(name, key)
+	if recorded {
+		s.wins.Inc()
+	}
+	return recordedFor, recorded, err
+}
+
+// GetLeagueBetween must only be called when the instrumented store is a
+// WindowedStore
+func (s *instrumentedStore) GetLeagueBetween(from, to time.Time) League {
+	defer s.observe("get_league_between", time.Now())
+	return s.PlayerStore.(WindowedStore).GetLeagueBetween(from, to)
+}
@@ -1,7 +1,6 @@
 package gameserver
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 )
@@ -21,11 +20,13 @@ func (l League) Find(name string) *Player {
 
 // NewLeague ...
 func NewLeague(rdr io.Reader) (League, error) {
-	var league []Player
-	err := json.NewDecoder(rdr).Decode(&league)
+	db, err := ReadDatabase(rdr)
 	if err != nil {
-		err = fmt.Errorf("problem parsing league, %v", err)
+		return db.Players, err
+	}
+	if db.Version > SchemaVersion {
+		return nil, fmt.Errorf("%w: version %d, supported %d", ErrNewerSchema, db.Version, SchemaVersion)
 	}
 
-	return league, err
+	return db.Players, nil
 }
@@ -0,0 +1,116 @@
+package gameserver_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	. "github.com/windnow/edusrv/internal/helpers"
+	fs "github.com/windnow/edusrv/internal/infsstore"
+)
+
+type accessLogEntry struct {
+	Msg       string `json:"msg"`
+	RequestID string `json:"request_id"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Status    int    `json:"status"`
+	Bytes     int64  `json:"bytes"`
+	Latency   int64  `json:"latency"`
+}
+
+func TestLoggingHandler(t *testing.T) {
+	store := &StubPlayerStore{scores: map[string]int{"Pepper": 20}}
+
+	newHandler := func() (http.Handler, *bytes.Buffer) {
+		logs := &bytes.Buffer{}
+		logger := slog.New(slog.NewJSONHandler(logs, nil))
+		return gs.NewLoggingHandler(gs.NewServer(store), logger), logs
+	}
+
+	t.Run("logs the request", func(t *testing.T) {
+		handler, logs := newHandler()
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, newGetScoreRequest("Pepper"))
+
+		entry := getAccessLogEntry(t, logs)
+		if entry.Msg != "request" || entry.Method != http.MethodGet || entry.Path != "/players/Pepper" {
+			t.Errorf("unexpected entry %+v", entry)
+		}
+		assertStatusCode(t, entry.Status, http.StatusOK)
+		if entry.Bytes != 2 {
+			t.Errorf("got %d bytes logged, want 2", entry.Bytes)
+		}
+		if entry.RequestID == "" || entry.RequestID != response.Header().Get(gs.RequestIDHeader) {
+			t.Errorf("got request id %q in log and %q in response", entry.RequestID, response.Header().Get(gs.RequestIDHeader))
+		}
+	})
+
+	t.Run("logs status set by the handler", func(t *testing.T) {
+		handler, logs := newHandler()
+		handler.ServeHTTP(httptest.NewRecorder(), newGetScoreRequest("Apollo"))
+
+		assertStatusCode(t, getAccessLogEntry(t, logs).Status, http.StatusNotFound)
+	})
+
+	t.Run("propagates request id", func(t *testing.T) {
+		handler, logs := newHandler()
+		request := newGetScoreRequest("Pepper")
+		request.Header.Set(gs.RequestIDHeader, "abc-123")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+
+		assertResponseBody(t, response.Header().Get(gs.RequestIDHeader), "abc-123")
+		assertResponseBody(t, getAccessLogEntry(t, logs).RequestID, "abc-123")
+	})
+
+	t.Run("passes request id to handlers", func(t *testing.T) {
+		var got string
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = gs.RequestID(r.Context())
+		})
+		logger := slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))
+		response := httptest.NewRecorder()
+		gs.NewLoggingHandler(next, logger).ServeHTTP(response, newLeagueRequest())
+
+		if got == "" || got != response.Header().Get(gs.RequestIDHeader) {
+			t.Errorf("got request id %q, response has %q", got, response.Header().Get(gs.RequestIDHeader))
+		}
+	})
+}
+
+func getAccessLogEntry(t *testing.T, logs *bytes.Buffer) (entry accessLogEntry) {
+	t.Helper()
+	if err := json.NewDecoder(logs).Decode(&entry); err != nil {
+		t.Fatalf("unable to parse log entry %q, %v", logs, err)
+	}
+	return
+}
+
+func TestFileSystemStoreLogsPersistenceErrors(t *testing.T) {
+	database, cleanDatabase := CreateTempFile(t, "")
+	defer cleanDatabase()
+
+	logs := &bytes.Buffer{}
+	store, err := fs.NewFileSystemPlayerStore(database, fs.WithLogger(slog.New(slog.NewJSONHandler(logs, nil))))
+	assertNoError(t, err)
+
+	database.Close()
+	store.RecordWin("Pepper")
+
+	var entry struct {
+		Level  string `json:"level"`
+		Msg    string `json:"msg"`
+		Player string `json:"player"`
+	}
+	if err := json.NewDecoder(logs).Decode(&entry); err != nil {
+		t.Fatalf("unable to parse log entry %q, %v", logs, err)
+	}
+	if entry.Level != "ERROR" || entry.Player != "Pepper" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+}
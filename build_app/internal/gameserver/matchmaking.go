@@ -0,0 +1,183 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxMatchmakingPlayers = 100
+	// rematchCost outweighs any difference of wins between players
+	rematchCost = 1 << 40
+)
+
+// MatchHistory is implemented by what knows the games players played
+type MatchHistory interface {
+	// PlayedSince returns the pairs of players who met since the given time
+	PlayedSince(since time.Time) [][2]string
+}
+
+// WithMatchHistory avoids pairing players who met within the window
+func WithMatchHistory(history MatchHistory, window time.Duration) ServerOption {
+	return func(p *PlayerServer) {
+		p.matchHistory, p.rematchWindow = history, window
+	}
+}
+
+// Pairing is a game suggested between two players, the better rated first
+type Pairing struct {
+	Players [2]string `json:"players"`
+	Ratings [2]int    `json:"ratings"`
+	Rematch bool      `json:"rematch,omitempty"`
+}
+
+// Matchmaking is a set of games suggested for players
+type Matchmaking struct {
+	Seed     int64     `json:"seed"`
+	Pairings []Pairing `json:"pairings"`
+	Bye      string    `json:"bye,omitempty"`
+}
+
+// SuggestPairings pairs the players keeping the differences of their
+// ratings small and pairing players who met recently only when there's no
+// other way. Players are paired greedily by rating, then pairs swap players
+// while it makes the games more even. The seed orders players with the
+// same rating, so the same seed gives the same pairings. With an odd number
+// of players the one hardest to pair sits out
+func SuggestPairings(players []string, ratings map[string]int, met func(a, b string) bool, seed int64) Matchmaking {
+	order := append([]string(nil), players...)
+	rnd := rand.New(rand.NewSource(seed))
+	rnd.Shuffle(len(order), func(i, j int) {
+		order[i], order[j] = order[j], order[i]
+	})
+	sort.SliceStable(order, func(i, j int) bool {
+		return ratings[order[i]] > ratings[order[j]]
+	})
+	if len(order)%2 == 1 {
+		order = append(order, "")
+	}
+
+	cost := func(a, b string) int {
+		if a == "" || b == "" {
+			return 0
+		}
+		gap := ratings[a] - ratings[b]
+		if gap < 0 {
+			gap = -gap
+		}
+		if met(a, b) {
+			gap += rematchCost
+		}
+		return gap
+	}
+
+	var pairs [][2]string
+	paired := make([]bool, len(order))
+	for i, a := range order {
+		if paired[i] {
+			continue
+		}
+		best := -1
+		for j := i + 1; j < len(order); j++ {
+			if !paired[j] && (best < 0 || cost(a, order[j]) < cost(a, order[best])) {
+				best = j
+			}
+		}
+		paired[i], paired[best] = true, true
+		pairs = append(pairs, [2]string{a, order[best]})
+	}
+
+	for improved := true; improved; {
+		improved = false
+		for i := range pairs {
+			for j := i + 1; j < len(pairs); j++ {
+				a, b, c, d := pairs[i][0], pairs[i][1], pairs[j][0], pairs[j][1]
+				current := cost(a, b) + cost(c, d)
+				if alt := cost(a, c) + cost(b, d); alt < current {
+					pairs[i], pairs[j], current, improved = [2]string{a, c}, [2]string{b, d}, alt, true
+				}
+				if alt := cost(a, d) + cost(b, c); alt < current {
+					pairs[i], pairs[j], improved = [2]string{a, d}, [2]string{b, c}, true
+				}
+			}
+		}
+	}
+
+	m := Matchmaking{Seed: seed, Pairings: []Pairing{}}
+	for _, pair := range pairs {
+		a, b := pair[0], pair[1]
+		if a == "" || b == "" {
+			m.Bye = a + b
+			continue
+		}
+		if ratings[b] > ratings[a] {
+			a, b = b, a
+		}
+		m.Pairings = append(m.Pairings, Pairing{
+			Players: [2]string{a, b},
+			Ratings: [2]int{ratings[a], ratings[b]},
+			Rematch: met(a, b),
+		})
+	}
+	return m
+}
+
+// matchmakingHandler suggests games for the players listed in the players
+// parameter, rated by their wins. The seed defaults to the current day, so
+// suggestions stay the same through the day
+func (p *PlayerServer) matchmakingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	var players []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(query.Get("players"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		players = append(players, name)
+	}
+	if len(players) < 2 || len(players) > maxMatchmakingPlayers {
+		http.Error(w, fmt.Sprintf("players must list from 2 to %d players", maxMatchmakingPlayers), http.StatusBadRequest)
+		return
+	}
+
+	now := p.now().UTC()
+	seed := now.Unix() / int64(24*time.Hour/time.Second)
+	if param := query.Get("seed"); param != "" {
+		var err error
+		if seed, err = strconv.ParseInt(param, 10, 64); err != nil {
+			http.Error(w, "seed must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ratings := make(map[string]int, len(players))
+	for _, name := range players {
+		ratings[name] = p.store.GetPlayerScore(name)
+	}
+	met := make(map[[2]string]bool)
+	if p.matchHistory != nil {
+		for _, pair := range p.matchHistory.PlayedSince(now.Add(-p.rematchWindow)) {
+			met[pair] = true
+			met[[2]string{pair[1], pair[0]}] = true
+		}
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(SuggestPairings(players, ratings, func(a, b string) bool {
+		return met[[2]string{a, b}]
+	}, seed))
+}
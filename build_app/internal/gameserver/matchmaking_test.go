@@ -0,0 +1,124 @@
+package gameserver_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+)
+
+type StubMatchHistory struct {
+	pairs [][2]string
+	since time.Time
+}
+
+func (s *StubMatchHistory) PlayedSince(since time.Time) [][2]string {
+	s.since = since
+	return s.pairs
+}
+
+func TestSuggestPairings(t *testing.T) {
+	ratings := map[string]int{"Cleo": 10, "Chris": 9, "Pepper": 5, "Floyd": 4, "Ann": 0}
+	never := func(a, b string) bool { return false }
+
+	t.Run("pairs close ratings", func(t *testing.T) {
+		got := gs.SuggestPairings([]string{"Floyd", "Cleo", "Pepper", "Chris"}, ratings, never, 1)
+		assertPairings(t, got, [][2]string{{"Cleo", "Chris"}, {"Pepper", "Floyd"}})
+	})
+
+	t.Run("avoids recent rematches", func(t *testing.T) {
+		met := func(a, b string) bool {
+			return a == "Cleo" && b == "Chris" || a == "Chris" && b == "Cleo"
+		}
+		got := gs.SuggestPairings([]string{"Floyd", "Cleo", "Pepper", "Chris"}, ratings, met, 1)
+		assertPairings(t, got, [][2]string{{"Cleo", "Pepper"}, {"Chris", "Floyd"}})
+	})
+
+	t.Run("rematch when there's no other way", func(t *testing.T) {
+		got := gs.SuggestPairings([]string{"Cleo", "Chris"}, ratings, func(a, b string) bool { return true }, 1)
+		if len(got.Pairings) != 1 || !got.Pairings[0].Rematch {
+			t.Errorf("got %+v want a rematch", got)
+		}
+	})
+
+	t.Run("bye", func(t *testing.T) {
+		got := gs.SuggestPairings([]string{"Cleo", "Chris", "Pepper", "Floyd", "Ann"}, ratings, never, 1)
+		assertPairings(t, got, [][2]string{{"Cleo", "Chris"}, {"Pepper", "Floyd"}})
+		if got.Bye != "Ann" {
+			t.Errorf("got bye %q want Ann", got.Bye)
+		}
+	})
+
+	t.Run("seeded ties", func(t *testing.T) {
+		players := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+		first := gs.SuggestPairings(players, map[string]int{}, never, 42)
+		again := gs.SuggestPairings(players, map[string]int{}, never, 42)
+		if !reflect.DeepEqual(first, again) {
+			t.Errorf("got %v and %v with the same seed", first, again)
+		}
+	})
+}
+
+func TestMatchmaking(t *testing.T) {
+	store := &StubPlayerStore{scores: map[string]int{"Cleo": 10, "Chris": 9, "Pepper": 5}}
+	history := &StubMatchHistory{pairs: [][2]string{{"Chris", "Cleo"}}}
+	clock := &fakeClock{time.Date(2026, 10, 19, 20, 0, 0, 0, time.UTC)}
+	server := gs.NewServer(store, gs.WithClock(clock.Now), gs.WithMatchHistory(history, 24*time.Hour))
+
+	t.Run("suggests pairings", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/matchmaking?players=Cleo,Chris,Pepper,Floyd", nil))
+		assertStatusCode(t, response.Code, http.StatusOK)
+		assertContentType(t, response, jsonContentType)
+
+		var got gs.Matchmaking
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("Unable to parse pairings, %v", err)
+		}
+		assertPairings(t, got, [][2]string{{"Cleo", "Pepper"}, {"Chris", "Floyd"}})
+		if got.Pairings[0].Ratings != [2]int{10, 5} {
+			t.Errorf("got ratings %v want [10 5]", got.Pairings[0].Ratings)
+		}
+		if want := time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC); !history.since.Equal(want) {
+			t.Errorf("asked for games since %v want %v", history.since, want)
+		}
+		if want := clock.now.Unix() / 86400; got.Seed != want {
+			t.Errorf("got seed %d want the day %d", got.Seed, want)
+		}
+	})
+
+	t.Run("seed", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/matchmaking?players=Cleo,Chris&seed=7", nil))
+		assertStatusCode(t, response.Code, http.StatusOK)
+
+		var got gs.Matchmaking
+		json.NewDecoder(response.Body).Decode(&got)
+		if got.Seed != 7 {
+			t.Errorf("got seed %d want 7", got.Seed)
+		}
+	})
+
+	for _, query := range []string{"", "players=Cleo", "players=Cleo,Cleo", "players=Cleo,Chris&seed=x"} {
+		t.Run("rejects "+query, func(t *testing.T) {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/matchmaking?"+query, nil))
+			assertStatusCode(t, response.Code, http.StatusBadRequest)
+		})
+	}
+}
+
+func assertPairings(t testing.TB, got gs.Matchmaking, want [][2]string) {
+	t.Helper()
+	var players [][2]string
+	for _, p := range got.Pairings {
+		players = append(players, p.Players)
+	}
+	if !reflect.DeepEqual(players, want) {
+		t.Errorf("got pairings %v want %v", players, want)
+	}
+}
@@ -0,0 +1,61 @@
+package gameserver_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	. "github.com/windnow/edusrv/internal/helpers"
+	fs "github.com/windnow/edusrv/internal/infsstore"
+)
+
+func TestMetrics(t *testing.T) {
+	database, cleanDatabase := CreateTempFile(t, "")
+	defer cleanDatabase()
+	store, err := fs.NewFileSystemPlayerStore(database)
+	assertNoError(t, err)
+
+	server := httptest.NewServer(gs.NewServer(store))
+	defer server.Close()
+
+	for _, name := range []string{"Pepper", "Pepper", "Cleo"} {
+		response, err := http.Post(server.URL+"/players/"+name, "", nil)
+		assertNoError(t, err)
+		response.Body.Close()
+	}
+	response, err := http.Get(server.URL + "/players/Apollo")
+	assertNoError(t, err)
+	response.Body.Close()
+
+	response, err = http.Get(server.URL + "/metrics")
+	assertNoError(t, err)
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	scrape := string(body)
+
+	assertStatusCode(t, response.StatusCode, http.StatusOK)
+	for _, line := range []string{
+		`http_requests_total{route="/players/",method="POST",status="202"} 3`,
+		`http_requests_total{route="/players/",method="GET",status="404"} 1`,
+		`http_request_duration_seconds_count{route="/players/",status="202"} 3`,
+		`gamelogger_store_operation_duration_seconds_count{operation="record_win"} 3`,
+		`gamelogger_store_operation_duration_seconds_count{operation="get_player_score"} 1`,
+		`gamelogger_wins_recorded_total 3`,
+		`gamelogger_players 2`,
+		`gamelogger_store_write_errors_total 0`,
+	} {
+		if !strings.Contains(scrape, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, scrape)
+		}
+	}
+
+	info, err := database.Stat()
+	assertNoError(t, err)
+	if !strings.Contains(scrape, "gamelogger_db_file_size_bytes "+strconv.FormatInt(info.Size(), 10)+"\n") {
+		t.Errorf("missing file size %d in\n%s", info.Size(), scrape)
+	}
+}
@@ -0,0 +1,16 @@
+package gameserver
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPI describes the routes of PlayerServer, served at /openapi.json
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	w.Write(OpenAPI)
+}
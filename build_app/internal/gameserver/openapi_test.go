@@ -0,0 +1,56 @@
+package gameserver_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+)
+
+type openAPIDocument struct {
+	OpenAPI string `json:"openapi"`
+	Paths   map[string]map[string]struct {
+		OperationID string                     `json:"operationId"`
+		Responses   map[string]json.RawMessage `json:"responses"`
+	} `json:"paths"`
+}
+
+func TestOpenAPI(t *testing.T) {
+	store := &StubPlayerStore{
+		scores: map[string]int{"Pepper": 20},
+		league: []gs.Player{{"Pepper", 20}},
+	}
+	server := gs.NewServer(store)
+
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assertStatusCode(t, response.Code, http.StatusOK)
+	assertContentType(t, response, "application/json")
+
+	var doc openAPIDocument
+	if err := json.NewDecoder(response.Body).Decode(&doc); err != nil {
+		t.Fatalf("Unable to parse the document, %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("got openapi %q want 3.x", doc.OpenAPI)
+	}
+
+	for path, operations := range doc.Paths {
+		for method, operation := range operations {
+			t.Run(operation.OperationID, func(t *testing.T) {
+				target := strings.Replace(path, "{name}", "Pepper", 1)
+				request := httptest.NewRequest(strings.ToUpper(method), target, strings.NewReader("[]"))
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, request)
+
+				if _, ok := operation.Responses[strconv.Itoa(response.Code)]; !ok {
+					t.Errorf("%s %s replied %d, which is not documented", method, path, response.Code)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package gameserver
+
+import "fmt"
+
+// RankMode tells how tied players are ranked
+type RankMode string
+
+// Supported rank modes
+const (
+	// CompetitionRank gives ties the same rank and leaves a gap after them:
+	// 1, 2, 2, 4
+	CompetitionRank RankMode = "competition"
+	// DenseRank gives ties the same rank without gaps: 1, 2, 2, 3
+	DenseRank RankMode = "dense"
+)
+
+// ParseRankMode returns the mode by its name, an empty name means
+// CompetitionRank
+func ParseRankMode(name string) (RankMode, error) {
+	switch m := RankMode(name); m {
+	case "":
+		return CompetitionRank, nil
+	case CompetitionRank, DenseRank:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown rank mode %q", name)
+}
+
+// Rank is the place of a player in the league
+type Rank struct {
+	Name string `json:"name"`
+	Wins int    `json:"wins"`
+	Rank int    `json:"rank"`
+}
+
+// Ranks ranks the players of a league sorted by wins
+func (l League) Ranks(mode RankMode) []Rank {
+	ranks := make([]Rank, len(l))
+	for i, p := range l {
+		rank := i + 1
+		if i > 0 && p.Wins == l[i-1].Wins {
+			rank = ranks[i-1].Rank
+		} else if i > 0 && mode == DenseRank {
+			rank = ranks[i-1].Rank + 1
+		}
+		ranks[i] = Rank{Name: p.Name, Wins: p.Wins, Rank: rank}
+	}
+	return ranks
+}
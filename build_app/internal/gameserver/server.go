@@ -4,7 +4,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/windnow/edusrv/internal/graphql"
+	"github.com/windnow/edusrv/internal/metrics"
+	"github.com/windnow/edusrv/internal/ratelimit"
+)
+
+const (
+	defaultAround = 5
+	maxAround     = 100
 )
 
 // Player ...
@@ -17,40 +29,164 @@ type Player struct {
 type PlayerStore interface {
 	GetPlayerScore(name string) int
 	RecordWin(name string)
+	// RecordWins records the wins at once, persisting them with one write
+	RecordWins(names []string)
 	GetLeague() League
+	GetPlayerRank(name string, mode RankMode) (Rank, bool)
+	GetLeagueAround(name string, n int, mode RankMode) ([]Rank, bool)
 }
 
 // PlayerServer ...
 type PlayerServer struct {
-	store PlayerStore
+	store       PlayerStore
+	checker     Checker
+	idempotent  IdempotentStore
+	fallible    FallibleStore
+	windowed    WindowedStore
+	graphQL     *graphql.Schema
+	metrics     *metrics.Registry
+	httpMetrics *metrics.HTTPMetrics
 	http.Handler
+
+	shuttingDown atomic.Bool
+	winCooldown  *ratelimit.Cooldown
+
+	graphQLDepth, graphQLComplexity int
+	chat                            *ChatConfig
+	achievements                    *Achievements
+	now                             func() time.Time
+	matchHistory                    MatchHistory
+	rematchWindow                   time.Duration
+}
+
+// ServerOption configures a PlayerServer
+type ServerOption func(*PlayerServer)
+
+// WithWinCooldown rejects wins of a player recorded more often than the
+// cooldown allows
+func WithWinCooldown(cooldown *ratelimit.Cooldown) ServerOption {
+	return func(p *PlayerServer) {
+		p.winCooldown = cooldown
+	}
 }
 
 // NewServer ...
-func NewServer(store PlayerStore) *PlayerServer {
+func NewServer(store PlayerStore, options ...ServerOption) *PlayerServer {
 
 	p := new(PlayerServer)
-	p.store = store
+	p.graphQLDepth, p.graphQLComplexity = defaultGraphQLDepth, defaultGraphQLComplexity
+	p.now = time.Now
+	for _, option := range options {
+		option(p)
+	}
+	p.metrics = metrics.NewRegistry()
+	p.httpMetrics = metrics.NewHTTPMetrics(p.metrics)
+	p.store = instrumentStore(store, p.metrics)
+	p.checker, _ = store.(Checker)
+	if _, ok := store.(IdempotentStore); ok {
+		p.idempotent = p.store.(IdempotentStore)
+	}
+	if _, ok := store.(FallibleStore); ok {
+		p.fallible = p.store.(FallibleStore)
+	}
+	if _, ok := store.(WindowedStore); ok {
+		p.windowed = p.store.(WindowedStore)
+	}
+
+	p.graphQL = p.newGraphQLSchema()
 
 	router := http.NewServeMux()
 	router.Handle("/league", http.HandlerFunc(p.leagueHandler))
+	router.Handle("/league/around/", http.HandlerFunc(p.aroundHandler))
 	router.Handle("/players/", http.HandlerFunc(p.playersHandler))
+	router.Handle("/wins", http.HandlerFunc(p.winsHandler))
+	router.Handle("/matchmaking", http.HandlerFunc(p.matchmakingHandler))
+	router.Handle("/graphql", http.HandlerFunc(p.graphQLHandler))
+	if p.chat != nil {
+		router.Handle("/chat/command", http.HandlerFunc(p.chatHandler))
+	}
+	router.Handle("/metrics", p.metrics)
+	router.Handle("/healthz", http.HandlerFunc(p.healthHandler))
+	router.Handle("/readyz", http.HandlerFunc(p.readyHandler))
+	router.Handle("/openapi.json", http.HandlerFunc(openAPIHandler))
 
-	p.Handler = router
+	p.Handler = p.Instrument(router, metrics.MuxRoute(router))
 
 	return p
 }
 
+// Metrics returns the registry served at /metrics, so other parts of the
+// application can add their metrics to it
+func (p *PlayerServer) Metrics() *metrics.Registry {
+	return p.metrics
+}
+
+// Instrument adds requests handled by next to the metrics of the server
+func (p *PlayerServer) Instrument(next http.Handler, route func(r *http.Request) string) http.Handler {
+	return p.httpMetrics.Wrap(next, route)
+}
+
 func (p *PlayerServer) leagueHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, windowed, err := windowRange(r.URL.Query(), p.now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if windowed {
+		p.showWindowedLeague(w, from, to)
+		return
+	}
+
 	w.Header().Set("content-type", "application/json")
 	json.NewEncoder(w).Encode(p.store.GetLeague())
 }
 
+func (p *PlayerServer) aroundHandler(w http.ResponseWriter, r *http.Request) {
+	player := strings.TrimPrefix(r.URL.Path, "/league/around/")
+
+	mode, err := ParseRankMode(r.URL.Query().Get("mode"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n := defaultAround
+	if param := r.URL.Query().Get("n"); param != "" {
+		n, err = strconv.Atoi(param)
+		if err != nil || n < 0 || n > maxAround {
+			http.Error(w, fmt.Sprintf("n must be a number from 0 to %d", maxAround), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ranks, ok := p.store.GetLeagueAround(player, n, mode)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(ranks)
+}
+
 func (p *PlayerServer) playersHandler(w http.ResponseWriter, r *http.Request) {
 	player := strings.TrimPrefix(r.URL.Path, "/players/")
 
+	if name := strings.TrimSuffix(player, "/rank"); name != player && r.Method == http.MethodGet {
+		p.showRank(w, r, name)
+		return
+	}
+	if name := strings.TrimSuffix(player, "/achievements"); name != player && r.Method == http.MethodGet {
+		p.showAchievements(w, name)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodPost:
+		if key := r.Header.Get(IdempotencyKeyHeader); key != "" {
+			p.processIdempotentWin(w, player, key)
+			return
+		}
 		p.processWin(w, player)
 	case http.MethodGet:
 		p.showScore(w, player)
@@ -68,7 +204,54 @@ func (p *PlayerServer) showScore(w http.ResponseWriter, player string) {
 	fmt.Fprint(w, score)
 }
 
+func (p *PlayerServer) showRank(w http.ResponseWriter, r *http.Request, player string) {
+	mode, err := ParseRankMode(r.URL.Query().Get("mode"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rank, ok := p.store.GetPlayerRank(player, mode)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(rank)
+}
+
 func (p *PlayerServer) processWin(w http.ResponseWriter, player string) {
-	p.store.RecordWin(player)
+	if !p.allowWin(w, player) {
+		return
+	}
+
+	if err := p.recordWins(player); err != nil {
+		p.releaseWins(player)
+		storeUnavailable(w, err)
+		return
+	}
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// allowWin checks the cooldown of the player, replying to the client when
+// the win is not allowed
+func (p *PlayerServer) allowWin(w http.ResponseWriter, player string) bool {
+	if p.winCooldown != nil {
+		if ok, wait := p.winCooldown.Allow(player); !ok {
+			ratelimit.TooManyRequests(w, wait)
+			return false
+		}
+	}
+	return true
+}
+
+// releaseWins takes back the cooldown of wins that weren't recorded
+func (p *PlayerServer) releaseWins(players ...string) {
+	if p.winCooldown == nil {
+		return
+	}
+	for _, player := range players {
+		p.winCooldown.Release(player)
+	}
+}
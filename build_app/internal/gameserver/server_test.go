@@ -1,16 +1,22 @@
 package gameserver_test
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	gs "github.com/windnow/edusrv/internal/gameserver"
 	. "github.com/windnow/edusrv/internal/helpers"
 	fs "github.com/windnow/edusrv/internal/infsstore"
+	"github.com/windnow/edusrv/internal/ratelimit"
 )
 
 const jsonContentType = "application/json"
@@ -30,9 +36,39 @@ func (s *StubPlayerStore) RecordWin(name string) {
 	s.winCalls = append(s.winCalls, name)
 }
 
+func (s *StubPlayerStore) RecordWins(names []string) {
+	s.winCalls = append(s.winCalls, names...)
+}
+
 func (s *StubPlayerStore) GetLeague() gs.League {
 	return s.league
 }
+
+func (s *StubPlayerStore) GetPlayerRank(name string, mode gs.RankMode) (gs.Rank, bool) {
+	for _, rank := range gs.League(s.league).Ranks(mode) {
+		if rank.Name == name {
+			return rank, true
+		}
+	}
+	return gs.Rank{}, false
+}
+
+func (s *StubPlayerStore) GetLeagueAround(name string, n int, mode gs.RankMode) ([]gs.Rank, bool) {
+	ranks := gs.League(s.league).Ranks(mode)
+	for i, rank := range ranks {
+		if rank.Name == name {
+			from, to := i-n, i+n+1
+			if from < 0 {
+				from = 0
+			}
+			if to > len(ranks) {
+				to = len(ranks)
+			}
+			return ranks[from:to], true
+		}
+	}
+	return nil, false
+}
 func TestGETPlayers(t *testing.T) {
 	store := &StubPlayerStore{
 		map[string]int{
@@ -101,6 +137,42 @@ func TestStoreWins(t *testing.T) {
 	})
 }
 
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestWinCooldown(t *testing.T) {
+	store := &StubPlayerStore{}
+	clock := &fakeClock{time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)}
+	server := gs.NewServer(store, gs.WithWinCooldown(ratelimit.NewCooldown(time.Minute, clock)))
+
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, newPostWinRequest("Pepper"))
+	assertStatusCode(t, response.Code, http.StatusAccepted)
+
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, newPostWinRequest("Pepper"))
+	assertStatusCode(t, response.Code, http.StatusTooManyRequests)
+	assertResponseBody(t, response.Header().Get("Retry-After"), "60")
+
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, newPostWinRequest("Cleo"))
+	assertStatusCode(t, response.Code, http.StatusAccepted)
+
+	clock.now = clock.now.Add(time.Minute)
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, newPostWinRequest("Pepper"))
+	assertStatusCode(t, response.Code, http.StatusAccepted)
+
+	if len(store.winCalls) != 3 {
+		t.Errorf("got %d calls to RecordWin want %d", len(store.winCalls), 3)
+	}
+}
+
 func TestRecordingWinsAndRetrievingThem(t *testing.T) {
 	database, cleanDatabase := CreateTempFile(t, "[]")
 	defer cleanDatabase()
@@ -263,6 +335,358 @@ func TestFileSystemStore(t *testing.T) {
 	})
 }
 
+func TestRank(t *testing.T) {
+	league := []gs.Player{
+		{"Cleo", 32},
+		{"Chris", 20},
+		{"Tiest", 20},
+		{"Pepper", 14},
+		{"Floyd", 3},
+	}
+	database, cleanDatabase := CreateTempFile(t, "")
+	defer cleanDatabase()
+	fsStore, err := fs.NewFileSystemPlayerStore(database)
+	assertNoError(t, err)
+	assertNoError(t, fsStore.ReplaceLeague(league))
+
+	stores := map[string]gs.PlayerStore{
+		"stub":        &StubPlayerStore{league: league},
+		"file system": fsStore,
+	}
+
+	for name, store := range stores {
+		server := gs.NewServer(store)
+
+		t.Run(name+" competition rank", func(t *testing.T) {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newRankRequest("Pepper", ""))
+
+			assertStatusCode(t, response.Code, http.StatusOK)
+			assertContentType(t, response, jsonContentType)
+			assertRanks(t, getRanksFromResponse(t, response.Body, false), []gs.Rank{{"Pepper", 14, 4}})
+		})
+
+		t.Run(name+" dense rank", func(t *testing.T) {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newRankRequest("Pepper", "dense"))
+
+			assertStatusCode(t, response.Code, http.StatusOK)
+			assertRanks(t, getRanksFromResponse(t, response.Body, false), []gs.Rank{{"Pepper", 14, 3}})
+		})
+
+		t.Run(name+" ties share rank", func(t *testing.T) {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newRankRequest("Tiest", ""))
+
+			assertRanks(t, getRanksFromResponse(t, response.Body, false), []gs.Rank{{"Tiest", 20, 2}})
+		})
+
+		t.Run(name+" rank of missing player", func(t *testing.T) {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newRankRequest("Apollo", ""))
+
+			assertStatusCode(t, response.Code, http.StatusNotFound)
+		})
+
+		t.Run(name+" league around", func(t *testing.T) {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newAroundRequest("Chris", "n=1&mode=dense"))
+
+			assertStatusCode(t, response.Code, http.StatusOK)
+			want := []gs.Rank{
+				{"Cleo", 32, 1},
+				{"Chris", 20, 2},
+				{"Tiest", 20, 2},
+			}
+			assertRanks(t, getRanksFromResponse(t, response.Body, true), want)
+		})
+
+		t.Run(name+" league around the last player", func(t *testing.T) {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newAroundRequest("Floyd", "n=1"))
+
+			want := []gs.Rank{
+				{"Pepper", 14, 4},
+				{"Floyd", 3, 5},
+			}
+			assertRanks(t, getRanksFromResponse(t, response.Body, true), want)
+		})
+
+		t.Run(name+" league around with bad n", func(t *testing.T) {
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, newAroundRequest("Floyd", "n=-1"))
+
+			assertStatusCode(t, response.Code, http.StatusBadRequest)
+		})
+	}
+
+	t.Run("ranks follow wins", func(t *testing.T) {
+		fsStore.RecordWin("Floyd")
+		fsStore.RecordWin("Tiest")
+
+		rank, _ := fsStore.GetPlayerRank("Tiest", gs.CompetitionRank)
+		assertRanks(t, []gs.Rank{rank}, []gs.Rank{{"Tiest", 21, 2}})
+		rank, _ = fsStore.GetPlayerRank("Chris", gs.DenseRank)
+		assertRanks(t, []gs.Rank{rank}, []gs.Rank{{"Chris", 20, 3}})
+	})
+}
+
+type StubHeadToHead map[string]int
+
+func (s StubHeadToHead) HeadToHead(a, b string) int {
+	return s[a+">"+b] - s[b+">"+a]
+}
+
+// TestLeagueOrdering documents the order of tied players in the league
+func TestLeagueOrdering(t *testing.T) {
+	const tied = `[
+		{"Name": "Pepper", "Wins": 10},
+		{"Name": "Cleo", "Wins": 10},
+		{"Name": "Chris", "Wins": 10}]`
+
+	t.Run("ties are ordered by who reached the score first", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, tied)
+		defer cleanDatabase()
+		store, err := fs.NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+
+		store.RecordWin("Chris")
+		store.RecordWin("Pepper")
+		want := []gs.Player{{"Chris", 11}, {"Pepper", 11}, {"Cleo", 10}}
+		assertLeague(t, store.GetLeague(), want)
+		assertLeague(t, store.GetLeague(), want)
+
+		reopened, err := fs.NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+		assertLeague(t, reopened.GetLeague(), want)
+	})
+
+	t.Run("alphabetical", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, tied)
+		defer cleanDatabase()
+		store, err := fs.NewFileSystemPlayerStore(database, fs.WithTieBreakers(gs.Alphabetical))
+		assertNoError(t, err)
+
+		assertLeague(t, store.GetLeague(), []gs.Player{{"Chris", 10}, {"Cleo", 10}, {"Pepper", 10}})
+	})
+
+	t.Run("head to head then earliest", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, tied)
+		defer cleanDatabase()
+		record := StubHeadToHead{"Chris>Pepper": 2, "Pepper>Chris": 1, "Chris>Cleo": 1}
+		store, err := fs.NewFileSystemPlayerStore(database,
+			fs.WithTieBreakers(gs.HeadToHead, gs.EarliestToScore),
+			fs.WithHeadToHead(record))
+		assertNoError(t, err)
+
+		assertLeague(t, store.GetLeague(), []gs.Player{{"Chris", 10}, {"Pepper", 10}, {"Cleo", 10}})
+		assertLeague(t, store.Top(2), []gs.Player{{"Chris", 10}, {"Pepper", 10}})
+
+		around, ok := store.GetLeagueAround("Chris", 1, gs.CompetitionRank)
+		if !ok {
+			t.Fatal("Chris not found")
+		}
+		assertRanks(t, around, []gs.Rank{{"Chris", 10, 1}, {"Pepper", 10, 1}})
+	})
+
+	t.Run("head to head without a record", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, tied)
+		defer cleanDatabase()
+		store, err := fs.NewFileSystemPlayerStore(database, fs.WithTieBreakers(gs.HeadToHead, gs.Alphabetical))
+		assertNoError(t, err)
+
+		assertLeague(t, store.GetLeague(), []gs.Player{{"Chris", 10}, {"Cleo", 10}, {"Pepper", 10}})
+	})
+
+	t.Run("parses rules", func(t *testing.T) {
+		rules, err := gs.ParseTieBreakers("head-to-head, alphabetical")
+		assertNoError(t, err)
+		if !reflect.DeepEqual(rules, []gs.TieBreaker{gs.HeadToHead, gs.Alphabetical}) {
+			t.Errorf("got %v", rules)
+		}
+
+		if _, err := gs.ParseTieBreakers("coin-toss"); err == nil {
+			t.Error("expected an error but didn't get one")
+		}
+	})
+}
+
+func TestFileSystemStoreSchema(t *testing.T) {
+	t.Run("upgrades legacy file keeping a backup", func(t *testing.T) {
+		legacy := `[{"Name": "Cleo", "Wins": 10}]`
+		database, cleanDatabase := CreateTempFile(t, legacy)
+		defer cleanDatabase()
+
+		store, err := fs.NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+		assertScoreEquals(t, store.GetPlayerScore("Cleo"), 10)
+
+		database.Seek(0, 0)
+		db, err := gs.ReadDatabase(database)
+		assertNoError(t, err)
+		if db.Version != gs.SchemaVersion {
+			t.Errorf("got version %d, want %d", db.Version, gs.SchemaVersion)
+		}
+		assertLeague(t, db.Players, []gs.Player{{"Cleo", 10}})
+
+		backup, err := ioutil.ReadFile(fs.BackupName(database.Name(), 0))
+		assertNoError(t, err)
+		assertResponseBody(t, string(backup), legacy)
+	})
+
+	t.Run("opens current version without a backup", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, fmt.Sprintf(`{"version": %d, "players": [{"Name": "Cleo", "Wins": 10}]}`, gs.SchemaVersion))
+		defer cleanDatabase()
+
+		store, err := fs.NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+		assertScoreEquals(t, store.GetPlayerScore("Cleo"), 10)
+
+		if _, err := os.Stat(fs.BackupName(database.Name(), gs.SchemaVersion)); !os.IsNotExist(err) {
+			t.Errorf("expected no backup, got %v", err)
+		}
+	})
+
+	t.Run("upgrades version 1 file", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, `{"version": 1, "players": [{"Name": "Cleo", "Wins": 10}]}`)
+		defer cleanDatabase()
+
+		_, err := fs.NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+
+		if _, err := os.Stat(fs.BackupName(database.Name(), 1)); err != nil {
+			t.Errorf("expected a backup, got %v", err)
+		}
+	})
+
+	t.Run("reuses a backup with the same contents", func(t *testing.T) {
+		legacy := `[{"Name": "Cleo", "Wins": 10}]`
+		database, cleanDatabase := CreateTempFile(t, legacy)
+		defer cleanDatabase()
+		backupName := fs.BackupName(database.Name(), 0)
+		assertNoError(t, os.WriteFile(backupName, []byte(legacy), 0666))
+		defer os.Remove(backupName)
+
+		_, err := fs.NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+
+		if _, err := os.Stat(backupName + ".1"); !os.IsNotExist(err) {
+			t.Errorf("expected no second backup, got %v", err)
+		}
+	})
+
+	t.Run("keeps an older backup with other contents", func(t *testing.T) {
+		legacy := `[{"Name": "Cleo", "Wins": 10}]`
+		database, cleanDatabase := CreateTempFile(t, legacy)
+		defer cleanDatabase()
+		backupName := fs.BackupName(database.Name(), 0)
+		assertNoError(t, os.WriteFile(backupName, []byte(`[]`), 0666))
+		defer os.Remove(backupName)
+		defer os.Remove(backupName + ".1")
+
+		_, err := fs.NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+
+		backup, err := ioutil.ReadFile(backupName + ".1")
+		assertNoError(t, err)
+		assertResponseBody(t, string(backup), legacy)
+	})
+
+	t.Run("refuses newer version", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, `{"version": 1000, "players": []}`)
+		defer cleanDatabase()
+
+		_, err := fs.NewFileSystemPlayerStore(database)
+		if !errors.Is(err, gs.ErrNewerSchema) {
+			t.Errorf("got error %v, want %v", err, gs.ErrNewerSchema)
+		}
+	})
+}
+
+func TestFileSystemStoreDeltas(t *testing.T) {
+	t.Run("appends wins and reads them back", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, `{"version": 2, "players": [{"Name": "Cleo", "Wins": 10}]}`)
+		defer cleanDatabase()
+
+		clock := &fakeClock{time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)}
+		store, err := fs.NewFileSystemPlayerStore(database, fs.WithClock(clock.Now))
+		assertNoError(t, err)
+		store.RecordWin("Cleo")
+		store.RecordWin("Chris")
+
+		database.Seek(0, 0)
+		content, _ := ioutil.ReadAll(database)
+		want := `{"version": 2, "players": [{"Name": "Cleo", "Wins": 10}]}{"win":"Cleo","at":"2026-10-19T10:00:00Z"}
+{"win":"Chris","at":"2026-10-19T10:00:00Z"}
+`
+		assertResponseBody(t, string(content), want)
+
+		reopened, err := fs.NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+		assertLeague(t, reopened.GetLeague(), []gs.Player{{"Cleo", 11}, {"Chris", 1}})
+	})
+
+	t.Run("compacts deltas", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, "")
+		defer cleanDatabase()
+
+		store, err := fs.NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+		for i := 0; i < 10000; i++ {
+			store.RecordWin("Cleo")
+		}
+
+		info, err := database.Stat()
+		assertNoError(t, err)
+		if info.Size() > 2*64*1024 {
+			t.Errorf("file grew to %d bytes", info.Size())
+		}
+
+		reopened, err := fs.NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+		assertScoreEquals(t, reopened.GetPlayerScore("Cleo"), 10000)
+	})
+
+	t.Run("drops a torn delta", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, `{"version": 2, "players": []}
+{"win":"Cleo"}
+{"win":"Chr`)
+		defer cleanDatabase()
+
+		store, err := fs.NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+		assertLeague(t, store.GetLeague(), []gs.Player{{"Cleo", 1}})
+
+		store.RecordWin("Chris")
+		reopened, err := fs.NewFileSystemPlayerStore(database)
+		assertNoError(t, err)
+		assertLeague(t, reopened.GetLeague(), []gs.Player{{"Cleo", 1}, {"Chris", 1}})
+	})
+
+	t.Run("refuses a corrupted delta", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, `{"version": 2, "players": []}
+{"win":}
+{"win":"Cleo"}`)
+		defer cleanDatabase()
+
+		_, err := fs.NewFileSystemPlayerStore(database)
+		if err == nil {
+			t.Error("expected an error but didn't get one")
+		}
+	})
+
+	t.Run("respects limits", func(t *testing.T) {
+		database, cleanDatabase := CreateTempFile(t, `{"version": 2, "players": [{"Name": "Cleo", "Wins": 10}]}
+{"win":"Chris"}`)
+		defer cleanDatabase()
+
+		_, err := fs.NewFileSystemPlayerStore(database, fs.WithLimits(gs.Limits{MaxPlayers: 1}))
+		if !errors.Is(err, gs.ErrLimitExceeded) {
+			t.Errorf("got error %v, want %v", err, gs.ErrLimitExceeded)
+		}
+	})
+}
+
 func newGetScoreRequest(name string) *http.Request {
 	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/players/%s", name), nil)
 	return req
@@ -273,6 +697,40 @@ func newLeagueRequest() *http.Request {
 	return request
 }
 
+func newRankRequest(name, mode string) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/players/%s/rank?mode=%s", name, mode), nil)
+	return req
+}
+
+func newAroundRequest(name, query string) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/league/around/%s?%s", name, query), nil)
+	return req
+}
+
+func getRanksFromResponse(t *testing.T, body io.Reader, list bool) (ranks []gs.Rank) {
+	t.Helper()
+
+	var err error
+	if list {
+		err = json.NewDecoder(body).Decode(&ranks)
+	} else {
+		var rank gs.Rank
+		err = json.NewDecoder(body).Decode(&rank)
+		ranks = append(ranks, rank)
+	}
+	if err != nil {
+		t.Fatalf("unable to parse ranks, %v", err)
+	}
+	return
+}
+
+func assertRanks(t *testing.T, got, want []gs.Rank) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
 func getLeagueFromResponse(t *testing.T, body io.Reader) (league []gs.Player) {
 	t.Helper()
 
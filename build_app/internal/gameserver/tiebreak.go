@@ -0,0 +1,43 @@
+package gameserver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TieBreaker is a rule ordering players with the same number of wins
+type TieBreaker string
+
+// Supported tie-breaking rules
+const (
+	// EarliestToScore puts first the player who reached the score first
+	EarliestToScore TieBreaker = "earliest"
+	// HeadToHead puts first the player with more wins over the other one
+	HeadToHead TieBreaker = "head-to-head"
+	// Alphabetical orders players by name
+	Alphabetical TieBreaker = "alphabetical"
+)
+
+// DefaultTieBreakers are used by stores unless configured otherwise
+var DefaultTieBreakers = []TieBreaker{EarliestToScore}
+
+// HeadToHeadRecord tells how the players did against each other: a positive
+// number means a won more games against b than b against a
+type HeadToHeadRecord interface {
+	HeadToHead(a, b string) int
+}
+
+// ParseTieBreakers parses a comma separated list of rules
+func ParseTieBreakers(list string) ([]TieBreaker, error) {
+	var rules []TieBreaker
+	for _, name := range strings.Split(list, ",") {
+		switch rule := TieBreaker(strings.TrimSpace(name)); rule {
+		case "":
+		case EarliestToScore, HeadToHead, Alphabetical:
+			rules = append(rules, rule)
+		default:
+			return nil, fmt.Errorf("unknown tie breaker %q", name)
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,727 @@
+package gameserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/windnow/edusrv/internal/metrics"
+)
+
+// Headers of webhook deliveries. The signature is "sha256=" followed by the
+// hex encoded HMAC-SHA256 of the timestamp, a dot and the body, keyed with
+// the secret of the subscription, see SignWebhook
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	subscriptionsFile = "subscriptions.json"
+	deliveriesFile    = "deliveries.ndjson"
+)
+
+// Subscription registers a URL for some events
+type Subscription struct {
+	ID      string      `json:"id"`
+	URL     string      `json:"url"`
+	Events  []EventType `json:"events"`
+	Secret  string      `json:"secret,omitempty"`
+	Created time.Time   `json:"created"`
+}
+
+func (s *Subscription) wants(t EventType) bool {
+	for _, e := range s.Events {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookConfig configures Webhooks, zero values get defaults
+type WebhookConfig struct {
+	// Dir keeps the subscriptions and the deliveries not made yet
+	Dir string
+	// Milestones are numbers of wins worth an EventMilestone
+	Milestones []int
+	// MaxAttempts is the number of times a delivery is tried, 10 by
+	// default. Retries wait Backoff, one second by default, doubling up
+	// to MaxBackoff, an hour by default
+	MaxAttempts         int
+	Backoff, MaxBackoff time.Duration
+	Client              *http.Client
+	Logger              *slog.Logger
+	// QueueSize is the number of published events waiting to be queued
+	// for delivery, 1024 by default. Events beyond it are dropped and
+	// counted, see Dropped
+	QueueSize int
+}
+
+// delivery is an event to send to a subscription
+type delivery struct {
+	ID           string    `json:"id"`
+	Subscription string    `json:"subscription"`
+	Event        Event     `json:"event"`
+	Attempts     int       `json:"attempts"`
+	Next         time.Time `json:"next"`
+}
+
+// queueRecord is a line of the deliveries file: add and retry store the
+// delivery, done removes it
+type queueRecord struct {
+	Op       string    `json:"op"`
+	Delivery *delivery `json:"delivery,omitempty"`
+	ID       string    `json:"id,omitempty"`
+}
+
+// Webhooks delivers events to the subscribed URLs. It is an EventSink and
+// serves the admin API under /admin/webhooks:
+//
+//	GET    /admin/webhooks       lists the subscriptions, without secrets
+//	POST   /admin/webhooks       subscribes {"url", "events", "secret"},
+//	                             a secret is generated when missing
+//	DELETE /admin/webhooks/{id}  removes a subscription
+//
+// Mount it behind RequireAdmin, subscriptions make the server send requests
+// to any URL. Deliveries are queued in a file so they survive restarts, and
+// tried in the background until the receiver replies with a 2xx status.
+// Each subscription has its own worker, a slow receiver only delays its own
+// deliveries
+type Webhooks struct {
+	config     WebhookConfig
+	milestones map[int]bool
+	http.Handler
+	route func(r *http.Request) string
+
+	mu            sync.Mutex
+	subscriptions []*Subscription
+	pending       []*delivery
+	queue         *os.File
+	records       int
+	workers       map[string]*webhookWorker
+	working       sync.WaitGroup
+
+	// published guards events against sends once closed
+	published sync.RWMutex
+	closed    bool
+	events    chan Event
+	dropped   atomic.Int64
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// webhookWorker delivers the events of a subscription
+type webhookWorker struct {
+	wake chan struct{}
+	stop chan struct{}
+}
+
+// notify wakes the worker up to look for due deliveries
+func (wk *webhookWorker) notify() {
+	select {
+	case wk.wake <- struct{}{}:
+	default:
+	}
+}
+
+// NewWebhooks loads the subscriptions and the queued deliveries from
+// config.Dir and starts delivering them
+func NewWebhooks(config WebhookConfig) (*Webhooks, error) {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 10
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = time.Second
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = time.Hour
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1024
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	if err := os.MkdirAll(config.Dir, 0777); err != nil {
+		return nil, fmt.Errorf("problem creating webhooks directory, %v", err)
+	}
+
+	w := &Webhooks{
+		config:     config,
+		milestones: make(map[int]bool),
+		workers:    make(map[string]*webhookWorker),
+		events:     make(chan Event, config.QueueSize),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	for _, m := range config.Milestones {
+		w.milestones[m] = true
+	}
+
+	content, err := os.ReadFile(filepath.Join(config.Dir, subscriptionsFile))
+	if err == nil {
+		err = json.Unmarshal(content, &w.subscriptions)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("problem loading webhook subscriptions, %v", err)
+	}
+
+	if err := w.loadQueue(); err != nil {
+		return nil, err
+	}
+
+	router := http.NewServeMux()
+	router.Handle("/admin/webhooks", http.HandlerFunc(w.subscriptionsHandler))
+	router.Handle("/admin/webhooks/", http.HandlerFunc(w.subscriptionHandler))
+	w.Handler = router
+	w.route = metrics.MuxRoute(router)
+
+	w.mu.Lock()
+	for _, s := range w.subscriptions {
+		w.startWorker(s.ID)
+	}
+	w.mu.Unlock()
+	go w.loop()
+	return w, nil
+}
+
+// Route names the route serving a request, see metrics.MuxRoute
+func (w *Webhooks) Route(r *http.Request) string {
+	return w.route(r)
+}
+
+// Publish hands the event, and the milestone it reaches, to the delivery
+// goroutine, which queues them for the subscriptions that want them. It
+// doesn't wait for the disk, stores call it while locked
+func (w *Webhooks) Publish(e Event) {
+	events := []Event{e}
+	if e.Type == EventWinRecorded && w.milestones[e.Wins] {
+		milestone := e
+		milestone.Type = EventMilestone
+		events = append(events, milestone)
+	}
+
+	w.published.RLock()
+	defer w.published.RUnlock()
+	for _, e := range events {
+		if w.closed {
+			w.drop(e, "webhooks are closed")
+			continue
+		}
+		select {
+		case w.events <- e:
+		default:
+			w.drop(e, "the queue is full")
+		}
+	}
+}
+
+func (w *Webhooks) drop(e Event, reason string) {
+	w.dropped.Add(1)
+	w.config.Logger.Error("dropping webhook event, "+reason, "event", e.Type, "player", e.Player)
+}
+
+// Dropped returns the number of events dropped because the queue was full
+// or they were published after Close
+func (w *Webhooks) Dropped() int64 {
+	return w.dropped.Load()
+}
+
+// enqueue queues deliveries of an event for the subscriptions that want it
+func (w *Webhooks) enqueue(e Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, s := range w.subscriptions {
+		if !s.wants(e.Type) {
+			continue
+		}
+		d := &delivery{ID: newID(), Subscription: s.ID, Event: e, Next: e.At}
+		w.pending = append(w.pending, d)
+		w.appendRecord(queueRecord{Op: "add", Delivery: d})
+		if wk, ok := w.workers[s.ID]; ok {
+			wk.notify()
+		}
+	}
+}
+
+// enqueuePublished queues the events published so far without waiting
+func (w *Webhooks) enqueuePublished() {
+	for {
+		select {
+		case e := <-w.events:
+			w.enqueue(e)
+		default:
+			return
+		}
+	}
+}
+
+// Close stops delivering, queued deliveries are kept for the next start.
+// Events published after it are dropped, close the sources of events first
+func (w *Webhooks) Close() error {
+	w.published.Lock()
+	w.closed = true
+	w.published.Unlock()
+
+	close(w.done)
+	<-w.stopped
+	w.working.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.queue.Close()
+}
+
+// loop queues the published events for delivery
+func (w *Webhooks) loop() {
+	defer close(w.stopped)
+
+	for {
+		select {
+		case <-w.done:
+			// keep the events published until now for the next start
+			w.enqueuePublished()
+			return
+		case e := <-w.events:
+			w.enqueue(e)
+		}
+	}
+}
+
+// startWorker starts delivering to a subscription, w.mu must be held
+func (w *Webhooks) startWorker(id string) {
+	wk := &webhookWorker{wake: make(chan struct{}, 1), stop: make(chan struct{})}
+	w.workers[id] = wk
+	w.working.Add(1)
+	go w.work(id, wk)
+}
+
+// stopWorker stops delivering to a subscription and drops its deliveries,
+// w.mu must be held
+func (w *Webhooks) stopWorker(id string) {
+	if wk, ok := w.workers[id]; ok {
+		close(wk.stop)
+		delete(w.workers, id)
+	}
+	for _, d := range append([]*delivery(nil), w.pending...) {
+		if d.Subscription == id {
+			w.remove(d)
+		}
+	}
+}
+
+// work delivers the events of a subscription in the order they were
+// queued
+func (w *Webhooks) work(id string, wk *webhookWorker) {
+	defer w.working.Done()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-wk.stop:
+			return
+		default:
+		}
+
+		d, wait := w.due(id)
+		if d != nil {
+			w.deliver(d)
+			continue
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-w.done:
+		case <-wk.stop:
+		case <-wk.wake:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// due returns the first delivery to a subscription to make now or, when
+// none is due, how long to wait for the next one, -1 when there are none
+func (w *Webhooks) due(id string) (*delivery, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	wait := time.Duration(-1)
+	for _, d := range w.pending {
+		if d.Subscription != id {
+			continue
+		}
+		until := d.Next.Sub(now)
+		if until <= 0 {
+			return d, 0
+		}
+		if wait < 0 || until < wait {
+			wait = until
+		}
+	}
+	return nil, wait
+}
+
+func (w *Webhooks) deliver(d *delivery) {
+	w.mu.Lock()
+	sub := w.subscription(d.Subscription)
+	w.mu.Unlock()
+	if sub == nil {
+		w.finish(d)
+		return
+	}
+
+	err := w.send(sub, d)
+	if err == nil {
+		w.finish(d)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	d.Attempts++
+	if d.Attempts >= w.config.MaxAttempts {
+		w.config.Logger.Error("giving up webhook delivery", "delivery", d.ID, "url", sub.URL, "attempts", d.Attempts, "error", err)
+		w.remove(d)
+		return
+	}
+
+	backoff := w.config.Backoff
+	for i := 1; i < d.Attempts && backoff < w.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > w.config.MaxBackoff {
+		backoff = w.config.MaxBackoff
+	}
+	d.Next = time.Now().Add(backoff)
+	w.config.Logger.Warn("problem delivering webhook", "delivery", d.ID, "url", sub.URL, "attempts", d.Attempts, "retry_in", backoff, "error", err)
+	w.appendRecord(queueRecord{Op: "retry", Delivery: d})
+}
+
+func (w *Webhooks) send(sub *Subscription, d *delivery) error {
+	body, err := json.Marshal(struct {
+		ID string `json:"id"`
+		Event
+	}{d.ID, d.Event})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-w.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set(WebhookEventHeader, string(d.Event.Type))
+	req.Header.Set(WebhookDeliveryHeader, d.ID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(sub.Secret, timestamp, body))
+
+	resp, err := w.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver replied %s", resp.Status)
+	}
+	return nil
+}
+
+// SignWebhook returns the signature of a delivery, receivers compare it
+// with hmac.Equal to the X-Webhook-Signature header
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhooks) finish(d *delivery) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.remove(d)
+}
+
+// remove drops a delivery, w.mu must be held
+func (w *Webhooks) remove(d *delivery) {
+	for i, p := range w.pending {
+		if p == d {
+			w.pending = append(w.pending[:i], w.pending[i+1:]...)
+			break
+		}
+	}
+	w.appendRecord(queueRecord{Op: "done", ID: d.ID})
+}
+
+func (w *Webhooks) subscription(id string) *Subscription {
+	for _, s := range w.subscriptions {
+		if s.ID == id {
+			return s
+		}
+	}
+	return nil
+}
+
+// loadQueue reads the deliveries left by the previous run and rewrites the
+// file with them only
+func (w *Webhooks) loadQueue() error {
+	name := filepath.Join(w.config.Dir, deliveriesFile)
+	file, err := os.Open(name)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("problem opening webhook deliveries, %v", err)
+	}
+
+	if file != nil {
+		var order []string
+		byID := make(map[string]*delivery)
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 1024*1024)
+		for scanner.Scan() {
+			var r queueRecord
+			if err := json.Unmarshal(scanner.Bytes(), &r); err != nil || (r.Op != "done" && r.Delivery == nil) {
+				// a torn line left by a crash while appending it
+				w.config.Logger.Warn("skipping webhook delivery record", "file", name, "error", err)
+				continue
+			}
+			switch r.Op {
+			case "add", "retry":
+				if _, ok := byID[r.Delivery.ID]; !ok {
+					order = append(order, r.Delivery.ID)
+				}
+				byID[r.Delivery.ID] = r.Delivery
+			case "done":
+				delete(byID, r.ID)
+			}
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("problem reading webhook deliveries, %v", err)
+		}
+
+		for _, id := range order {
+			// deliveries of removed subscriptions are left by a retry
+			// that ended after the removal
+			if d, ok := byID[id]; ok && w.subscription(d.Subscription) != nil {
+				w.pending = append(w.pending, d)
+			}
+		}
+	}
+
+	return w.compact()
+}
+
+// compact rewrites the deliveries file with the pending deliveries, w.mu
+// must be held once the loop runs
+func (w *Webhooks) compact() error {
+	name := filepath.Join(w.config.Dir, deliveriesFile)
+	tmp, err := os.CreateTemp(w.config.Dir, deliveriesFile+".*")
+	if err != nil {
+		return fmt.Errorf("problem compacting webhook deliveries, %v", err)
+	}
+	enc := json.NewEncoder(tmp)
+	for _, d := range w.pending {
+		if err := enc.Encode(queueRecord{Op: "add", Delivery: d}); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return fmt.Errorf("problem compacting webhook deliveries, %v", err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("problem compacting webhook deliveries, %v", err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("problem compacting webhook deliveries, %v", err)
+	}
+
+	if w.queue != nil {
+		w.queue.Close()
+	}
+	w.queue, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("problem opening webhook deliveries, %v", err)
+	}
+	w.records = len(w.pending)
+	return nil
+}
+
+// appendRecord persists a change of the queue, already made to w.pending,
+// w.mu must be held
+func (w *Webhooks) appendRecord(r queueRecord) {
+	if w.records > 1000 && w.records > 4*len(w.pending) {
+		err := w.compact()
+		if err == nil {
+			return
+		}
+		w.config.Logger.Error("problem compacting webhook deliveries", "error", err)
+	}
+
+	record, err := json.Marshal(r)
+	if err == nil {
+		_, err = w.queue.Write(append(record, '\n'))
+	}
+	if err != nil {
+		w.config.Logger.Error("problem queueing webhook delivery", "op", r.Op, "error", err)
+		return
+	}
+	w.records++
+}
+
+func (w *Webhooks) subscriptionsHandler(rw http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.mu.Lock()
+		subscriptions := make([]Subscription, len(w.subscriptions))
+		for i, s := range w.subscriptions {
+			subscriptions[i] = *s
+			subscriptions[i].Secret = ""
+		}
+		w.mu.Unlock()
+
+		rw.Header().Set("content-type", "application/json")
+		json.NewEncoder(rw).Encode(subscriptions)
+	case http.MethodPost:
+		var s Subscription
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(rw, fmt.Sprintf("problem parsing subscription, %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := validateSubscription(&s); err != nil {
+			http.Error(rw, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		s.ID, s.Created = newID(), time.Now().UTC()
+		if s.Secret == "" {
+			s.Secret = newID() + newID()
+		}
+
+		w.mu.Lock()
+		w.subscriptions = append(w.subscriptions, &s)
+		w.startWorker(s.ID)
+		err := w.saveSubscriptions()
+		w.mu.Unlock()
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("content-type", "application/json")
+		rw.WriteHeader(http.StatusCreated)
+		json.NewEncoder(rw).Encode(s)
+	default:
+		rw.Header().Set("Allow", "GET, POST")
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (w *Webhooks) subscriptionHandler(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		rw.Header().Set("Allow", "DELETE")
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/admin/webhooks/")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, s := range w.subscriptions {
+		if s.ID == id {
+			w.subscriptions = append(w.subscriptions[:i], w.subscriptions[i+1:]...)
+			w.stopWorker(id)
+			if err := w.saveSubscriptions(); err != nil {
+				http.Error(rw, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	http.Error(rw, "unknown subscription", http.StatusNotFound)
+}
+
+func validateSubscription(s *Subscription) error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https url")
+	}
+	if len(s.Events) == 0 {
+		return fmt.Errorf("events must list at least one of %v", EventTypes)
+	}
+	for _, e := range s.Events {
+		known := false
+		for _, t := range EventTypes {
+			known = known || e == t
+		}
+		if !known {
+			return fmt.Errorf("unknown event %q, want one of %v", e, EventTypes)
+		}
+	}
+	return nil
+}
+
+// saveSubscriptions writes the subscriptions, w.mu must be held
+func (w *Webhooks) saveSubscriptions() error {
+	content, err := json.MarshalIndent(w.subscriptions, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(w.config.Dir, subscriptionsFile)
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return fmt.Errorf("problem writing webhook subscriptions, %v", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("problem writing webhook subscriptions, %v", err)
+	}
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
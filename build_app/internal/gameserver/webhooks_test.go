@@ -0,0 +1,302 @@
+package gameserver_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	. "github.com/windnow/edusrv/internal/helpers"
+	fs "github.com/windnow/edusrv/internal/infsstore"
+)
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+	event  gs.Event
+}
+
+// webhookReceiver replies 503 to the first failures deliveries
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	failures int
+	attempts int
+	received chan receivedWebhook
+}
+
+func newWebhookReceiver(failures int) *webhookReceiver {
+	r := &webhookReceiver{failures: failures, received: make(chan receivedWebhook, 100)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		r.attempts++
+		fail := r.failures > 0
+		if fail {
+			r.failures--
+		}
+		r.mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var event gs.Event
+		json.Unmarshal(body, &event)
+		r.received <- receivedWebhook{header: req.Header, body: body, event: event}
+	}))
+	return r
+}
+
+func (r *webhookReceiver) setFailures(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = n
+}
+
+func (r *webhookReceiver) next(t *testing.T) receivedWebhook {
+	t.Helper()
+	select {
+	case w := <-r.received:
+		return w
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a webhook")
+	}
+	return receivedWebhook{}
+}
+
+func TestWebhooks(t *testing.T) {
+	t.Run("delivers signed events of the store", func(t *testing.T) {
+		receiver := newWebhookReceiver(0)
+		defer receiver.Close()
+		hooks := newWebhooks(t, gs.WebhookConfig{Dir: t.TempDir(), Milestones: []int{2}})
+		defer hooks.Close()
+		sub := subscribe(t, hooks, receiver.URL, gs.EventWinRecorded, gs.EventNewLeader, gs.EventMilestone)
+
+		database, cleanDatabase := CreateTempFile(t, "")
+		defer cleanDatabase()
+		store, err := fs.NewFileSystemPlayerStore(database, fs.WithEvents(hooks))
+		assertNoError(t, err)
+		store.RecordWin("Cleo")
+		store.RecordWins([]string{"Chris", "Chris"})
+
+		var got []string
+		for i := 0; i < 6; i++ {
+			w := receiver.next(t)
+			timestamp := w.header.Get(gs.WebhookTimestampHeader)
+			if want := gs.SignWebhook(sub.Secret, timestamp, w.body); w.header.Get(gs.WebhookSignatureHeader) != want {
+				t.Errorf("got signature %q want %q", w.header.Get(gs.WebhookSignatureHeader), want)
+			}
+			if w.header.Get(gs.WebhookEventHeader) != string(w.event.Type) {
+				t.Errorf("got event header %q for a %s", w.header.Get(gs.WebhookEventHeader), w.event.Type)
+			}
+			got = append(got, fmt.Sprintf("%s %s %d %s", w.event.Type, w.event.Player, w.event.Wins, w.event.PreviousLeader))
+		}
+
+		want := []string{
+			"win.recorded Cleo 1 ",
+			"leader.changed Cleo 1 ",
+			"win.recorded Chris 1 ",
+			"win.recorded Chris 2 ",
+			"player.milestone Chris 2 ",
+			"leader.changed Chris 2 Cleo",
+		}
+		assertResponseBody(t, strings.Join(got, "\n"), strings.Join(want, "\n"))
+	})
+
+	t.Run("retries failed deliveries", func(t *testing.T) {
+		receiver := newWebhookReceiver(2)
+		defer receiver.Close()
+		hooks := newWebhooks(t, gs.WebhookConfig{Dir: t.TempDir(), Backoff: time.Millisecond})
+		defer hooks.Close()
+		subscribe(t, hooks, receiver.URL, gs.EventWinRecorded)
+
+		hooks.Publish(gs.Event{Type: gs.EventWinRecorded, At: time.Now(), Player: "Cleo", Wins: 1})
+
+		if w := receiver.next(t); w.event.Player != "Cleo" {
+			t.Errorf("got event of %q want %q", w.event.Player, "Cleo")
+		}
+		if receiver.attempts != 3 {
+			t.Errorf("got %d attempts want %d", receiver.attempts, 3)
+		}
+	})
+
+	t.Run("gives up after the attempts", func(t *testing.T) {
+		receiver := newWebhookReceiver(1000)
+		defer receiver.Close()
+		dir := t.TempDir()
+		hooks := newWebhooks(t, gs.WebhookConfig{Dir: dir, Backoff: time.Millisecond, MaxAttempts: 2})
+		subscribe(t, hooks, receiver.URL, gs.EventWinRecorded)
+
+		hooks.Publish(gs.Event{Type: gs.EventWinRecorded, At: time.Now(), Player: "Cleo", Wins: 1})
+		waitFor(t, func() bool {
+			receiver.mu.Lock()
+			defer receiver.mu.Unlock()
+			return receiver.attempts == 2
+		})
+		time.Sleep(20 * time.Millisecond)
+		hooks.Close()
+
+		receiver.setFailures(0)
+		hooks = newWebhooks(t, gs.WebhookConfig{Dir: dir, Backoff: time.Millisecond})
+		defer hooks.Close()
+		select {
+		case w := <-receiver.received:
+			t.Errorf("got a delivery given up on, %s", w.body)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("keeps deliveries across restarts", func(t *testing.T) {
+		receiver := newWebhookReceiver(1000)
+		defer receiver.Close()
+		dir := t.TempDir()
+		hooks := newWebhooks(t, gs.WebhookConfig{Dir: dir, Backoff: time.Millisecond, MaxBackoff: time.Millisecond})
+		subscribe(t, hooks, receiver.URL, gs.EventWinRecorded)
+
+		hooks.Publish(gs.Event{Type: gs.EventWinRecorded, At: time.Now(), Player: "Cleo", Wins: 1})
+		waitFor(t, func() bool {
+			receiver.mu.Lock()
+			defer receiver.mu.Unlock()
+			return receiver.attempts > 0
+		})
+		hooks.Close()
+
+		receiver.setFailures(0)
+		hooks = newWebhooks(t, gs.WebhookConfig{Dir: dir})
+		defer hooks.Close()
+		if w := receiver.next(t); w.event.Player != "Cleo" {
+			t.Errorf("got event of %q want %q", w.event.Player, "Cleo")
+		}
+	})
+
+	t.Run("keeps events published right before closing", func(t *testing.T) {
+		receiver := newWebhookReceiver(0)
+		defer receiver.Close()
+		dir := t.TempDir()
+		hooks := newWebhooks(t, gs.WebhookConfig{Dir: dir})
+		subscribe(t, hooks, receiver.URL, gs.EventWinRecorded)
+
+		hooks.Publish(gs.Event{Type: gs.EventWinRecorded, At: time.Now(), Player: "Cleo", Wins: 1})
+		hooks.Close()
+
+		hooks = newWebhooks(t, gs.WebhookConfig{Dir: dir})
+		defer hooks.Close()
+		if w := receiver.next(t); w.event.Player != "Cleo" {
+			t.Errorf("got event of %q want %q", w.event.Player, "Cleo")
+		}
+	})
+
+	t.Run("counts events published after closing as dropped", func(t *testing.T) {
+		hooks := newWebhooks(t, gs.WebhookConfig{Dir: t.TempDir()})
+		hooks.Close()
+
+		hooks.Publish(gs.Event{Type: gs.EventWinRecorded, At: time.Now(), Player: "Cleo", Wins: 1})
+		if got := hooks.Dropped(); got != 1 {
+			t.Errorf("got %d dropped events want %d", got, 1)
+		}
+	})
+
+	t.Run("doesn't delay deliveries behind a slow receiver", func(t *testing.T) {
+		release := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer slow.Close()
+		defer close(release)
+		receiver := newWebhookReceiver(0)
+		defer receiver.Close()
+
+		hooks := newWebhooks(t, gs.WebhookConfig{Dir: t.TempDir()})
+		defer hooks.Close()
+		subscribe(t, hooks, slow.URL, gs.EventWinRecorded)
+		subscribe(t, hooks, receiver.URL, gs.EventWinRecorded)
+
+		hooks.Publish(gs.Event{Type: gs.EventWinRecorded, At: time.Now(), Player: "Cleo", Wins: 1})
+		hooks.Publish(gs.Event{Type: gs.EventWinRecorded, At: time.Now(), Player: "Chris", Wins: 1})
+		for _, want := range []string{"Cleo", "Chris"} {
+			if w := receiver.next(t); w.event.Player != want {
+				t.Errorf("got event of %q want %q", w.event.Player, want)
+			}
+		}
+	})
+
+	t.Run("manages subscriptions", func(t *testing.T) {
+		hooks := newWebhooks(t, gs.WebhookConfig{Dir: t.TempDir()})
+		defer hooks.Close()
+
+		response := httptest.NewRecorder()
+		hooks.ServeHTTP(response, newSubscribeRequest(`{"url": "ftp://example.com", "events": ["win.recorded"]}`))
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+
+		response = httptest.NewRecorder()
+		hooks.ServeHTTP(response, newSubscribeRequest(`{"url": "https://example.com", "events": ["lost"]}`))
+		assertStatusCode(t, response.Code, http.StatusUnprocessableEntity)
+
+		sub := subscribe(t, hooks, "https://example.com/hook", gs.EventNewLeader)
+		if sub.Secret == "" {
+			t.Error("didn't generate a secret")
+		}
+
+		response = httptest.NewRecorder()
+		hooks.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/admin/webhooks", nil))
+		assertStatusCode(t, response.Code, http.StatusOK)
+		var subscriptions []gs.Subscription
+		json.NewDecoder(response.Body).Decode(&subscriptions)
+		if len(subscriptions) != 1 || subscriptions[0].ID != sub.ID || subscriptions[0].Secret != "" {
+			t.Errorf("got subscriptions %v want %s without its secret", subscriptions, sub.ID)
+		}
+
+		response = httptest.NewRecorder()
+		hooks.ServeHTTP(response, httptest.NewRequest(http.MethodDelete, "/admin/webhooks/"+sub.ID, nil))
+		assertStatusCode(t, response.Code, http.StatusNoContent)
+
+		response = httptest.NewRecorder()
+		hooks.ServeHTTP(response, httptest.NewRequest(http.MethodDelete, "/admin/webhooks/"+sub.ID, nil))
+		assertStatusCode(t, response.Code, http.StatusNotFound)
+	})
+}
+
+func newWebhooks(t *testing.T, config gs.WebhookConfig) *gs.Webhooks {
+	t.Helper()
+	hooks, err := gs.NewWebhooks(config)
+	assertNoError(t, err)
+	return hooks
+}
+
+func subscribe(t *testing.T, hooks *gs.Webhooks, url string, events ...gs.EventType) gs.Subscription {
+	t.Helper()
+	body, _ := json.Marshal(gs.Subscription{URL: url, Events: events})
+	response := httptest.NewRecorder()
+	hooks.ServeHTTP(response, newSubscribeRequest(string(body)))
+	assertStatusCode(t, response.Code, http.StatusCreated)
+
+	var sub gs.Subscription
+	if err := json.NewDecoder(response.Body).Decode(&sub); err != nil {
+		t.Fatalf("Unable to parse subscription, %v", err)
+	}
+	return sub
+}
+
+func newSubscribeRequest(body string) *http.Request {
+	return httptest.NewRequest(http.MethodPost, "/admin/webhooks", bytes.NewReader([]byte(body)))
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,91 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Windows of the league selected with the window parameter of /league
+const (
+	WindowDay   = "day"
+	WindowWeek  = "week"
+	WindowMonth = "month"
+	WindowAll   = "all"
+)
+
+// WindowedStore is implemented by stores that keep the time of wins
+type WindowedStore interface {
+	// GetLeagueBetween returns the players ordered by the wins they
+	// recorded from up to to. Stores may widen the range to the resolution
+	// they keep wins at
+	GetLeagueBetween(from, to time.Time) League
+}
+
+// WinBucket holds the wins recorded by players in the period starting at
+// Start
+type WinBucket struct {
+	Start time.Time      `json:"start"`
+	Wins  map[string]int `json:"wins"`
+}
+
+// WithClock sets the source of the current time, time.Now by default
+func WithClock(now func() time.Time) ServerOption {
+	return func(p *PlayerServer) {
+		p.now = now
+	}
+}
+
+// windowRange returns the range of the league asked for by query. Named
+// windows are calendar periods in UTC, weeks start on Monday. ok is false
+// for the all-time league
+func windowRange(query url.Values, now time.Time) (from, to time.Time, ok bool, err error) {
+	window, fromParam, toParam := query.Get("window"), query.Get("from"), query.Get("to")
+	if window != "" && (fromParam != "" || toParam != "") {
+		return from, to, false, fmt.Errorf("window can't be combined with from and to")
+	}
+
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch window {
+	case "", WindowAll:
+	case WindowDay:
+		return today, now, true, nil
+	case WindowWeek:
+		return today.AddDate(0, 0, -(int(today.Weekday())+6)%7), now, true, nil
+	case WindowMonth:
+		return today.AddDate(0, 0, 1-today.Day()), now, true, nil
+	default:
+		return from, to, false, fmt.Errorf("unknown window %q, use %s, %s, %s or %s", window, WindowDay, WindowWeek, WindowMonth, WindowAll)
+	}
+
+	if fromParam == "" && toParam == "" {
+		return from, to, false, nil
+	}
+	to = now
+	if fromParam != "" {
+		if from, err = time.Parse(time.RFC3339, fromParam); err != nil {
+			return from, to, false, fmt.Errorf("problem parsing from, %v", err)
+		}
+	}
+	if toParam != "" {
+		if to, err = time.Parse(time.RFC3339, toParam); err != nil {
+			return from, to, false, fmt.Errorf("problem parsing to, %v", err)
+		}
+	}
+	if !from.Before(to) {
+		return from, to, false, fmt.Errorf("from must be before to")
+	}
+	return from, to, true, nil
+}
+
+func (p *PlayerServer) showWindowedLeague(w http.ResponseWriter, from, to time.Time) {
+	if p.windowed == nil {
+		http.Error(w, "the store doesn't keep the time of wins", http.StatusNotImplemented)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(p.windowed.GetLeagueBetween(from, to))
+}
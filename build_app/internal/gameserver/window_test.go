@@ -0,0 +1,157 @@
+package gameserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	. "github.com/windnow/edusrv/internal/helpers"
+	fs "github.com/windnow/edusrv/internal/infsstore"
+)
+
+type StubWindowedStore struct {
+	StubPlayerStore
+	from, to time.Time
+}
+
+func (s *StubWindowedStore) GetLeagueBetween(from, to time.Time) gs.League {
+	s.from, s.to = from, to
+	return s.league
+}
+
+func TestWindowedLeague(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2026, 10, 21, 15, 30, 0, 0, time.UTC)
+	clock := &fakeClock{now}
+
+	cases := []struct {
+		query    string
+		from, to time.Time
+	}{
+		{"window=day", time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC), now},
+		{"window=week", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), now},
+		{"window=month", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), now},
+		{"from=2026-09-01T00:00:00Z&to=2026-09-08T00:00:00Z", time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 9, 8, 0, 0, 0, 0, time.UTC)},
+		{"from=2026-09-01T00:00:00Z", time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), now},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			store := &StubWindowedStore{StubPlayerStore: StubPlayerStore{league: []gs.Player{{"Cleo", 3}}}}
+			server := gs.NewServer(store, gs.WithClock(clock.Now))
+
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/league?"+c.query, nil))
+
+			assertStatusCode(t, response.Code, http.StatusOK)
+			assertContentType(t, response, "application/json")
+			assertLeague(t, getLeagueFromResponse(t, response.Body), []gs.Player{{"Cleo", 3}})
+			if !store.from.Equal(c.from) || !store.to.Equal(c.to) {
+				t.Errorf("got range %v to %v want %v to %v", store.from, store.to, c.from, c.to)
+			}
+		})
+	}
+
+	for _, query := range []string{"window=year", "window=day&from=2026-09-01T00:00:00Z", "from=yesterday", "from=2026-09-08T00:00:00Z&to=2026-09-01T00:00:00Z"} {
+		t.Run("rejects "+query, func(t *testing.T) {
+			server := gs.NewServer(&StubWindowedStore{}, gs.WithClock(clock.Now))
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/league?"+query, nil))
+			assertStatusCode(t, response.Code, http.StatusBadRequest)
+		})
+	}
+
+	t.Run("all-time league", func(t *testing.T) {
+		store := &StubWindowedStore{StubPlayerStore: StubPlayerStore{league: []gs.Player{{"Cleo", 3}}}}
+		server := gs.NewServer(store)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/league?window=all", nil))
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		if !store.from.IsZero() {
+			t.Errorf("asked for a windowed league from %v", store.from)
+		}
+	})
+
+	t.Run("store without windows", func(t *testing.T) {
+		server := gs.NewServer(&StubPlayerStore{})
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/league?window=day", nil))
+		assertStatusCode(t, response.Code, http.StatusNotImplemented)
+	})
+}
+
+func TestFileSystemStoreWindows(t *testing.T) {
+	database, cleanDatabase := CreateTempFile(t, "")
+	defer cleanDatabase()
+
+	clock := &fakeClock{time.Date(2026, 10, 18, 23, 10, 0, 0, time.UTC)}
+	store, err := fs.NewFileSystemPlayerStore(database, fs.WithClock(clock.Now))
+	assertNoError(t, err)
+
+	store.RecordWin("Chris")
+	store.RecordWin("Chris")
+	clock.now = time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	store.RecordWin("Cleo")
+	clock.now = time.Date(2026, 10, 20, 10, 45, 0, 0, time.UTC)
+	store.RecordWins([]string{"Cleo", "Floyd"})
+
+	assertWindows := func(t *testing.T, store *fs.FileSystemPlayerStore) {
+		t.Helper()
+		day := func(d, h int) time.Time { return time.Date(2026, 10, d, h, 0, 0, 0, time.UTC) }
+
+		assertLeague(t, store.GetLeagueBetween(day(20, 0), day(21, 0)), []gs.Player{{"Cleo", 1}, {"Floyd", 1}})
+		assertLeague(t, store.GetLeagueBetween(day(19, 0), day(21, 0)), []gs.Player{{"Cleo", 2}, {"Floyd", 1}})
+		assertLeague(t, store.GetLeagueBetween(day(18, 23), day(20, 11)), []gs.Player{{"Chris", 2}, {"Cleo", 2}, {"Floyd", 1}})
+		// widened to whole hours
+		assertLeague(t, store.GetLeagueBetween(day(20, 10).Add(50*time.Minute), day(20, 11)), []gs.Player{{"Cleo", 1}, {"Floyd", 1}})
+		assertLeague(t, store.GetLeagueBetween(day(1, 0), day(18, 23)), []gs.Player{})
+	}
+	assertWindows(t, store)
+
+	reopened, err := fs.NewFileSystemPlayerStore(database, fs.WithClock(clock.Now))
+	assertNoError(t, err)
+	assertWindows(t, reopened)
+
+	// rewriting the file keeps the buckets in the envelope
+	assertNoError(t, reopened.ReplaceLeague(reopened.GetLeague()))
+	rewritten, err := fs.NewFileSystemPlayerStore(database, fs.WithClock(clock.Now))
+	assertNoError(t, err)
+	assertWindows(t, rewritten)
+	assertLeague(t, rewritten.GetLeague(), []gs.Player{{"Chris", 2}, {"Cleo", 2}, {"Floyd", 1}})
+}
+
+func TestFileSystemStoreHourlyRetention(t *testing.T) {
+	database, cleanDatabase := CreateTempFile(t, "")
+	defer cleanDatabase()
+
+	day := func(d, h int) time.Time { return time.Date(2026, 10, d, h, 0, 0, 0, time.UTC) }
+	clock := &fakeClock{day(10, 9)}
+	options := []fs.Option{fs.WithClock(clock.Now), fs.WithHourlyRetention(48 * time.Hour)}
+	store, err := fs.NewFileSystemPlayerStore(database, options...)
+	assertNoError(t, err)
+
+	store.RecordWin("Chris")
+	clock.now = day(10, 15)
+	store.RecordWin("Cleo")
+	clock.now = day(19, 8)
+	store.RecordWin("Cleo")
+	assertNoError(t, store.ReplaceLeague(store.GetLeague()))
+
+	content, err := os.ReadFile(database.Name())
+	assertNoError(t, err)
+	if strings.Contains(string(content), "2026-10-10T09") {
+		t.Errorf("kept the hours of a day past the retention, %s", content)
+	}
+
+	reopened, err := fs.NewFileSystemPlayerStore(database, options...)
+	assertNoError(t, err)
+	// past the retention hours are widened to the whole day
+	assertLeague(t, reopened.GetLeagueBetween(day(10, 9), day(10, 10)), []gs.Player{{"Chris", 1}, {"Cleo", 1}})
+	assertLeague(t, reopened.GetLeagueBetween(day(9, 0), day(20, 0)), []gs.Player{{"Cleo", 2}, {"Chris", 1}})
+	assertLeague(t, reopened.GetLeagueBetween(day(19, 8), day(19, 9)), []gs.Player{{"Cleo", 1}})
+	assertLeague(t, reopened.GetLeagueBetween(day(19, 9), day(19, 10)), []gs.Player{})
+}
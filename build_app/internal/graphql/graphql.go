@@ -0,0 +1,616 @@
+// Package graphql executes GraphQL requests against a schema described in
+// Go. It supports what the game server needs: queries and mutations with
+// variables, aliases and arguments, but no fragments, directives,
+// subscriptions, input objects or introspection beyond __typename
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Schema describes the objects and enums served
+type Schema struct {
+	// Query and Mutation name the root objects, Mutation may be empty
+	Query, Mutation string
+	Objects         map[string]*Object
+	Enums           map[string][]string
+
+	// MaxDepth bounds the nesting of selections, MaxComplexity the
+	// number of fields resolved, lists counting as many times as the cost
+	// of their field says. Zero disables the limit
+	MaxDepth, MaxComplexity int
+}
+
+// Object is an object type
+type Object struct {
+	Fields map[string]*Field
+}
+
+// Field of an object. Types are written like in a schema: Int!, [Player!]!
+type Field struct {
+	Type string
+	Args map[string]*Arg
+	// Resolve returns the value of the field, a missing resolver reads the
+	// field from a map[string]interface{} source
+	Resolve func(p ResolveParams) (interface{}, error)
+	// Cost returns how many items a list field resolves to at most, one
+	// when missing
+	Cost func(args map[string]interface{}) int
+}
+
+// Arg is an argument of a field, optional arguments may have a default
+type Arg struct {
+	Type    string
+	Default interface{}
+}
+
+// ResolveParams are passed to resolvers. Args hold the coerced arguments:
+// Int as int, Float as float64, String, ID and enums as string, Boolean as
+// bool and lists as []interface{}
+type ResolveParams struct {
+	Context context.Context
+	Source  interface{}
+	Args    map[string]interface{}
+}
+
+// Request is the body of a GraphQL request
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Response of a request, Data is missing when the request was invalid
+type Response struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []*Error        `json:"errors,omitempty"`
+}
+
+// Error is a GraphQL error
+type Error struct {
+	Message   string        `json:"message"`
+	Locations []Location    `json:"locations,omitempty"`
+	Path      []interface{} `json:"path,omitempty"`
+}
+
+// Location in a document
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Operation returns the operation of the request that would be executed
+func (s *Schema) Operation(doc *Document, name string) (*Operation, error) {
+	if name == "" {
+		if len(doc.Operations) > 1 {
+			return nil, &Error{Message: "operationName is required for documents with several operations"}
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("unknown operation %q", name)}
+}
+
+// Execute runs the request. When readOnly is set mutations are refused
+func (s *Schema) Execute(ctx context.Context, req Request, readOnly bool) *Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return errorResponse(err)
+	}
+	op, err := s.Operation(doc, req.OperationName)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	root := s.Query
+	if op.Type == "mutation" {
+		if readOnly {
+			return errorResponse(&Error{Message: "mutations are not allowed here"})
+		}
+		if s.Mutation == "" {
+			return errorResponse(&Error{Message: "the schema has no mutations"})
+		}
+		root = s.Mutation
+	}
+
+	e := &executor{schema: s, ctx: ctx, src: req.Query, args: make(map[*Selection]map[string]interface{})}
+	if e.vars, err = e.coerceVariables(op, req.Variables); err != nil {
+		return errorResponse(err)
+	}
+	complexity, err := e.validate(root, op.Selections, 1)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if s.MaxComplexity > 0 && complexity > s.MaxComplexity {
+		return errorResponse(&Error{Message: fmt.Sprintf("query complexity %d exceeds the limit of %d", complexity, s.MaxComplexity)})
+	}
+
+	data, ok := e.executeObject(root, nil, op.Selections, nil)
+	resp := &Response{Data: json.RawMessage("null"), Errors: e.errors}
+	if ok {
+		resp.Data, _ = json.Marshal(data)
+	}
+	return resp
+}
+
+func errorResponse(err error) *Response {
+	if e, ok := err.(*Error); ok {
+		return &Response{Errors: []*Error{e}}
+	}
+	return &Response{Errors: []*Error{{Message: err.Error()}}}
+}
+
+// typeRef is a parsed type like [Int!]!
+type typeRef struct {
+	name    string
+	list    *typeRef
+	nonNull bool
+}
+
+func parseTypeRef(s string) *typeRef {
+	t := new(typeRef)
+	if strings.HasSuffix(s, "!") {
+		t.nonNull = true
+		s = strings.TrimSuffix(s, "!")
+	}
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		t.list = parseTypeRef(s[1 : len(s)-1])
+	} else {
+		t.name = s
+	}
+	return t
+}
+
+// named returns the type inside the lists
+func (t *typeRef) named() string {
+	for t.list != nil {
+		t = t.list
+	}
+	return t.name
+}
+
+var scalars = map[string]bool{"Int": true, "Float": true, "String": true, "Boolean": true, "ID": true}
+
+type executor struct {
+	schema   *Schema
+	ctx      context.Context
+	src      string
+	vars     map[string]interface{}
+	declared map[string]bool
+	args     map[*Selection]map[string]interface{}
+	errors   []*Error
+}
+
+func (e *executor) errorAt(s *Selection, format string, args ...interface{}) *Error {
+	l := lexer{src: e.src}
+	line, column := l.location(s.pos)
+	return &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{{Line: line, Column: column}}}
+}
+
+func (e *executor) coerceVariables(op *Operation, values map[string]interface{}) (map[string]interface{}, error) {
+	vars := make(map[string]interface{}, len(op.Variables))
+	e.declared = make(map[string]bool, len(op.Variables))
+	for _, v := range op.Variables {
+		e.declared[v.Name] = true
+		value, provided := values[v.Name]
+		if !provided {
+			if !v.HasDefault {
+				if strings.HasSuffix(v.Type, "!") {
+					return nil, &Error{Message: fmt.Sprintf("variable $%s of type %s is required", v.Name, v.Type)}
+				}
+				continue
+			}
+			value = v.Default
+		}
+		coerced, err := e.coerce(value, parseTypeRef(v.Type), provided)
+		if err != nil {
+			return nil, &Error{Message: fmt.Sprintf("variable $%s: %v", v.Name, err)}
+		}
+		vars[v.Name] = coerced
+	}
+	return vars, nil
+}
+
+// coerce converts an input value to the type, json tells whether it comes
+// from JSON variables rather than from the document
+func (e *executor) coerce(value interface{}, t *typeRef, json bool) (interface{}, error) {
+	if name, ok := value.(Variable); ok {
+		v, ok := e.vars[string(name)]
+		if !ok {
+			value = nil
+		} else {
+			value, json = v, true
+		}
+	}
+
+	if value == nil {
+		if t.nonNull {
+			return nil, fmt.Errorf("null is not a valid %s", typeString(t))
+		}
+		return nil, nil
+	}
+
+	if t.list != nil {
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			v, err := e.coerce(item, t.list, json)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v
+		}
+		return list, nil
+	}
+
+	switch t.name {
+	case "Int":
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			if int64(int32(v)) == v {
+				return int(v), nil
+			}
+		case float64:
+			if v == float64(int32(v)) {
+				return int(v), nil
+			}
+		}
+	case "Float":
+		switch v := value.(type) {
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+	case "String", "ID":
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case "Boolean":
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	default:
+		values, ok := e.schema.Enums[t.name]
+		if !ok {
+			return nil, fmt.Errorf("unknown input type %s", t.name)
+		}
+		var name string
+		switch v := value.(type) {
+		case Enum:
+			name = string(v)
+		case string:
+			if !json {
+				return nil, fmt.Errorf("%q is a string, not a %s value", v, t.name)
+			}
+			name = v
+		}
+		for _, allowed := range values {
+			if name != "" && name == allowed {
+				return name, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%v is not a valid %s", value, t.name)
+}
+
+func typeString(t *typeRef) string {
+	s := t.name
+	if t.list != nil {
+		s = "[" + typeString(t.list) + "]"
+	}
+	if t.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+// validate checks the selections of an object and coerces their arguments,
+// returning the complexity of the selections. Selections of the same
+// response key are merged
+func (e *executor) validate(object string, selections []*Selection, depth int) (int, error) {
+	if max := e.schema.MaxDepth; max > 0 && depth > max {
+		return 0, e.errorAt(selections[0], "query depth exceeds the limit of %d", max)
+	}
+
+	complexity := 0
+	keys, groups := collectFields(selections)
+	for _, key := range keys {
+		group := groups[key]
+		s := group[0]
+		for _, other := range group[1:] {
+			if err := e.checkMerge(key, s, other); err != nil {
+				return 0, err
+			}
+		}
+
+		if s.Name == "__typename" {
+			for _, s := range group {
+				if s.Selections != nil {
+					return 0, e.errorAt(s, "__typename has no fields")
+				}
+			}
+			complexity++
+			continue
+		}
+
+		field, ok := e.schema.Objects[object].Fields[s.Name]
+		if !ok {
+			return 0, e.errorAt(s, "unknown field %s on %s", s.Name, object)
+		}
+
+		args, err := e.coerceArgs(s, field)
+		if err != nil {
+			return 0, err
+		}
+		e.args[s] = args
+
+		named := parseTypeRef(field.Type).named()
+		_, isObject := e.schema.Objects[named]
+		for _, s := range group {
+			switch {
+			case isObject && s.Selections == nil:
+				return 0, e.errorAt(s, "field %s of type %s needs a selection of fields", s.Name, field.Type)
+			case !isObject && s.Selections != nil:
+				return 0, e.errorAt(s, "field %s of type %s has no fields", s.Name, field.Type)
+			}
+		}
+		cost := 1
+		if isObject {
+			children, err := e.validate(named, mergedSelections(group), depth+1)
+			if err != nil {
+				return 0, err
+			}
+			items := 1
+			if field.Cost != nil {
+				items = field.Cost(args)
+			}
+			cost += items * children
+		}
+		complexity += cost
+	}
+	return complexity, nil
+}
+
+func responseKey(s *Selection) string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Name
+}
+
+// collectFields groups the selections by response key, keys are returned in
+// the order they are first selected
+func collectFields(selections []*Selection) ([]string, map[string][]*Selection) {
+	var keys []string
+	groups := make(map[string][]*Selection, len(selections))
+	for _, s := range selections {
+		key := responseKey(s)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], s)
+	}
+	return keys, groups
+}
+
+// mergedSelections returns the selections of fields merged into one
+func mergedSelections(group []*Selection) []*Selection {
+	if len(group) == 1 {
+		return group[0].Selections
+	}
+	var selections []*Selection
+	for _, s := range group {
+		selections = append(selections, s.Selections...)
+	}
+	return selections
+}
+
+// checkMerge tells whether b can be merged into a selected earlier with the
+// same response key: both must select the same field with the same
+// arguments. Their selections are checked once merged
+func (e *executor) checkMerge(key string, a, b *Selection) error {
+	if a.Name != b.Name {
+		return e.errorAt(b, "%s selects both %s and %s, use different aliases", key, a.Name, b.Name)
+	}
+	if !reflect.DeepEqual(argumentValues(a), argumentValues(b)) {
+		return e.errorAt(b, "%s selects %s with different arguments, use different aliases", key, b.Name)
+	}
+	return nil
+}
+
+func argumentValues(s *Selection) map[string]interface{} {
+	values := make(map[string]interface{}, len(s.Arguments))
+	for _, a := range s.Arguments {
+		values[a.Name] = a.Value
+	}
+	return values
+}
+
+func (e *executor) coerceArgs(s *Selection, field *Field) (map[string]interface{}, error) {
+	args := make(map[string]interface{}, len(field.Args))
+	given := make(map[string]bool, len(s.Arguments))
+	for _, a := range s.Arguments {
+		def, ok := field.Args[a.Name]
+		if !ok {
+			return nil, e.errorAt(s, "unknown argument %s of field %s", a.Name, s.Name)
+		}
+		if given[a.Name] {
+			return nil, e.errorAt(s, "argument %s of field %s is given more than once", a.Name, s.Name)
+		}
+		given[a.Name] = true
+		if v, ok := a.Value.(Variable); ok {
+			if !e.declared[string(v)] {
+				return nil, e.errorAt(s, "variable $%s is not declared", v)
+			}
+			if _, ok := e.vars[string(v)]; !ok {
+				continue
+			}
+		}
+		value, err := e.coerce(a.Value, parseTypeRef(def.Type), false)
+		if err != nil {
+			return nil, e.errorAt(s, "argument %s of field %s: %v", a.Name, s.Name, err)
+		}
+		args[a.Name] = value
+	}
+
+	for name, def := range field.Args {
+		if _, ok := args[name]; ok {
+			continue
+		}
+		if def.Default != nil {
+			args[name] = def.Default
+		} else if strings.HasSuffix(def.Type, "!") {
+			return nil, e.errorAt(s, "argument %s of field %s is required", name, s.Name)
+		}
+	}
+	return args, nil
+}
+
+// orderedObject keeps the fields in the order they were selected
+type orderedObject []field
+
+type field struct {
+	name  string
+	value interface{}
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(f.name)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
+
+// executeObject resolves the selections, merging those of the same response
+// key. It returns false when a non-null field is null, making the object
+// null
+func (e *executor) executeObject(object string, source interface{}, selections []*Selection, path []interface{}) (orderedObject, bool) {
+	keys, groups := collectFields(selections)
+	result := make(orderedObject, 0, len(keys))
+	for _, key := range keys {
+		s := groups[key][0]
+		fieldPath := append(append([]interface{}{}, path...), key)
+
+		if s.Name == "__typename" {
+			result = append(result, field{key, object})
+			continue
+		}
+
+		def := e.schema.Objects[object].Fields[s.Name]
+		var value interface{}
+		var err error
+		if def.Resolve != nil {
+			value, err = def.Resolve(ResolveParams{Context: e.ctx, Source: source, Args: e.args[s]})
+		} else if m, ok := source.(map[string]interface{}); ok {
+			value = m[s.Name]
+		}
+		if err != nil {
+			resolveErr := e.errorAt(s, "%v", err)
+			resolveErr.Path = fieldPath
+			e.errors = append(e.errors, resolveErr)
+			value = nil
+		}
+
+		merged := s
+		if len(groups[key]) > 1 {
+			merged = &Selection{Alias: s.Alias, Name: s.Name, Arguments: s.Arguments, Selections: mergedSelections(groups[key]), pos: s.pos}
+		}
+		completed, ok := e.complete(parseTypeRef(def.Type), value, merged, fieldPath)
+		if !ok {
+			return nil, false
+		}
+		result = append(result, field{key, completed})
+	}
+	return result, true
+}
+
+// complete shapes a resolved value after its type, it returns false when a
+// non-null value is null
+func (e *executor) complete(t *typeRef, value interface{}, s *Selection, path []interface{}) (interface{}, bool) {
+	if isNull(value) {
+		if t.nonNull {
+			if len(e.errors) == 0 || !samePath(e.errors[len(e.errors)-1].Path, path) {
+				nullErr := e.errorAt(s, "non-null field %s resolved to null", s.Name)
+				nullErr.Path = path
+				e.errors = append(e.errors, nullErr)
+			}
+			return nil, false
+		}
+		return nil, true
+	}
+
+	if t.list != nil {
+		items := reflect.ValueOf(value)
+		if items.Kind() != reflect.Slice {
+			e.errors = append(e.errors, &Error{Message: fmt.Sprintf("field %s resolved to %T, not a list", s.Name, value), Path: path})
+			return nil, !t.nonNull
+		}
+		list := make([]interface{}, items.Len())
+		for i := range list {
+			item, ok := e.complete(t.list, items.Index(i).Interface(), s, append(append([]interface{}{}, path...), i))
+			if !ok {
+				return nil, !t.nonNull
+			}
+			list[i] = item
+		}
+		return list, true
+	}
+
+	if _, ok := e.schema.Objects[t.name]; ok {
+		object, ok := e.executeObject(t.name, value, s.Selections, path)
+		if !ok {
+			return nil, !t.nonNull
+		}
+		return object, true
+	}
+	return value, true
+}
+
+func isNull(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+func samePath(a, b []interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,236 @@
+package graphql_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/windnow/edusrv/internal/graphql"
+)
+
+func newSchema() *graphql.Schema {
+	return &graphql.Schema{
+		Query:    "Query",
+		Mutation: "Mutation",
+		MaxDepth: 4,
+		Enums:    map[string][]string{"Color": {"RED", "BLUE"}},
+		Objects: map[string]*graphql.Object{
+			"Query": {Fields: map[string]*graphql.Field{
+				"hello": {
+					Type: "String!",
+					Args: map[string]*graphql.Arg{"name": {Type: "String", Default: "world"}},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return "hello " + p.Args["name"].(string), nil
+					},
+				},
+				"paint": {
+					Type: "[String!]!",
+					Args: map[string]*graphql.Arg{"colors": {Type: "[Color!]!"}, "times": {Type: "Int", Default: 1}},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						var painted []string
+						for i := 0; i < p.Args["times"].(int); i++ {
+							for _, c := range p.Args["colors"].([]interface{}) {
+								painted = append(painted, c.(string))
+							}
+						}
+						return painted, nil
+					},
+				},
+				"box": {
+					Type: "Box",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return map[string]interface{}{"size": 2, "inner": map[string]interface{}{"size": 1}}, nil
+					},
+				},
+				"boxes": {
+					Type: "[Box!]!",
+					Args: map[string]*graphql.Arg{"n": {Type: "Int!"}},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return []interface{}{}, nil
+					},
+					Cost: func(args map[string]interface{}) int { return args["n"].(int) },
+				},
+			}},
+			"Mutation": {Fields: map[string]*graphql.Field{
+				"fail": {Type: "String", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return nil, errors.New("it failed")
+				}},
+			}},
+			"Box": {Fields: map[string]*graphql.Field{
+				"size":  {Type: "Int!"},
+				"inner": {Type: "Box"},
+				"broken": {Type: "Int!", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return nil, errors.New("broken")
+				}},
+			}},
+		},
+	}
+}
+
+func TestExecute(t *testing.T) {
+	cases := []struct {
+		name      string
+		req       graphql.Request
+		readOnly  bool
+		want      string
+		wantError string
+	}{
+		{
+			name: "shorthand query with an alias",
+			req:  graphql.Request{Query: `{ hello greeting: hello(name: "Cleo") __typename }`},
+			want: `{"hello":"hello world","greeting":"hello Cleo","__typename":"Query"}`,
+		},
+		{
+			name: "variables and enums",
+			req: graphql.Request{
+				Query:     `query Paint($colors: [Color!]!, $times: Int = 1) { paint(colors: $colors, times: $times) }`,
+				Variables: map[string]interface{}{"colors": []interface{}{"RED", "BLUE"}, "times": 2.0},
+			},
+			want: `{"paint":["RED","BLUE","RED","BLUE"]}`,
+		},
+		{
+			name: "single value for a list",
+			req:  graphql.Request{Query: `{ paint(colors: RED) }`},
+			want: `{"paint":["RED"]}`,
+		},
+		{
+			name:      "string for an enum",
+			req:       graphql.Request{Query: `{ paint(colors: "RED") }`},
+			wantError: `argument colors of field paint: "RED" is a string, not a Color value`,
+		},
+		{
+			name: "nested objects",
+			req:  graphql.Request{Query: `{ box { size inner { size inner { size } } } }`},
+			want: `{"box":{"size":2,"inner":{"size":1,"inner":null}}}`,
+		},
+		{
+			name:      "non-null errors make the parent null",
+			req:       graphql.Request{Query: `{ hello box { size broken } }`},
+			want:      `{"hello":"hello world","box":null}`,
+			wantError: "broken",
+		},
+		{
+			name:      "resolver errors",
+			req:       graphql.Request{Query: `mutation { fail }`},
+			want:      `{"fail":null}`,
+			wantError: "it failed",
+		},
+		{
+			name:      "mutations when read only",
+			req:       graphql.Request{Query: `mutation { fail }`},
+			readOnly:  true,
+			wantError: "mutations are not allowed here",
+		},
+		{
+			name:      "unknown fields",
+			req:       graphql.Request{Query: `{ goodbye }`},
+			wantError: "unknown field goodbye on Query",
+		},
+		{
+			name:      "missing selections",
+			req:       graphql.Request{Query: `{ box }`},
+			wantError: "field box of type Box needs a selection of fields",
+		},
+		{
+			name:      "missing arguments",
+			req:       graphql.Request{Query: `{ paint }`},
+			wantError: "argument colors of field paint is required",
+		},
+		{
+			name:      "undeclared variables",
+			req:       graphql.Request{Query: `{ hello(name: $name) }`},
+			wantError: "variable $name is not declared",
+		},
+		{
+			name:      "depth limit",
+			req:       graphql.Request{Query: `{ box { inner { inner { inner { size } } } } }`},
+			wantError: "query depth exceeds the limit of 4",
+		},
+		{
+			name:      "syntax errors",
+			req:       graphql.Request{Query: "{\n  hello("},
+			wantError: `syntax error: expected a name, got end of document`,
+		},
+		{
+			name:      "fragments",
+			req:       graphql.Request{Query: `{ box { ...Sizes } }`},
+			wantError: "syntax error: fragments are not supported",
+		},
+		{
+			name: "merges fields of the same response key",
+			req:  graphql.Request{Query: `{ hello box { size } hello box { inner { size } } }`},
+			want: `{"hello":"hello world","box":{"size":2,"inner":{"size":1}}}`,
+		},
+		{
+			name:      "different fields of the same response key",
+			req:       graphql.Request{Query: `{ x: hello x: box { size } }`},
+			wantError: "x selects both hello and box, use different aliases",
+		},
+		{
+			name:      "different arguments of the same response key",
+			req:       graphql.Request{Query: `{ x: hello(name: "a") x: hello(name: "b") }`},
+			wantError: "x selects hello with different arguments, use different aliases",
+		},
+		{
+			name:      "conflicts within merged selections",
+			req:       graphql.Request{Query: `{ box { size } box { size: inner { size } } }`},
+			wantError: "size selects both size and inner, use different aliases",
+		},
+		{
+			name:      "repeated arguments",
+			req:       graphql.Request{Query: `{ hello(name: "a", name: "b") }`},
+			wantError: "argument name of field hello is given more than once",
+		},
+		{
+			name: "operation names",
+			req: graphql.Request{
+				Query:         `query A { hello } query B { greeting: hello }`,
+				OperationName: "B",
+			},
+			want: `{"greeting":"hello world"}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp := newSchema().Execute(context.Background(), c.req, c.readOnly)
+
+			if string(resp.Data) != c.want {
+				t.Errorf("got data %s want %s", resp.Data, c.want)
+			}
+			var messages []string
+			for _, err := range resp.Errors {
+				messages = append(messages, err.Message)
+			}
+			if got := strings.Join(messages, "; "); got != c.wantError {
+				t.Errorf("got errors %q want %q", got, c.wantError)
+			}
+		})
+	}
+}
+
+func TestComplexityLimit(t *testing.T) {
+	schema := newSchema()
+	schema.MaxComplexity = 20
+
+	resp := schema.Execute(context.Background(), graphql.Request{Query: `{ boxes(n: 5) { size inner { size } } }`}, true)
+	if len(resp.Errors) > 0 {
+		t.Errorf("didn't expect errors, got %v", resp.Errors[0])
+	}
+
+	resp = schema.Execute(context.Background(), graphql.Request{Query: `{ boxes(n: 50) { size } }`}, true)
+	if resp.Data != nil || len(resp.Errors) != 1 || resp.Errors[0].Message != "query complexity 51 exceeds the limit of 20" {
+		t.Errorf("got %s %v, want the complexity error", resp.Data, resp.Errors)
+	}
+}
+
+func TestErrorLocations(t *testing.T) {
+	resp := newSchema().Execute(context.Background(), graphql.Request{Query: "{\n  hello\n  goodbye\n}"}, true)
+	if len(resp.Errors) != 1 {
+		t.Fatalf("got %d errors want 1", len(resp.Errors))
+	}
+	if got := resp.Errors[0].Locations; len(got) != 1 || got[0] != (graphql.Location{Line: 3, Column: 3}) {
+		t.Errorf("got locations %v want line 3 column 3", got)
+	}
+}
@@ -0,0 +1,369 @@
+package graphql
+
+import (
+	"strconv"
+)
+
+// Document is a parsed request. Fragments and directives are not supported
+type Document struct {
+	Operations []*Operation
+}
+
+// Operation is a query or a mutation
+type Operation struct {
+	Type       string
+	Name       string
+	Variables  []*VariableDefinition
+	Selections []*Selection
+}
+
+// VariableDefinition declares a variable of an operation, Type is written
+// like in the document, for example [String!]!
+type VariableDefinition struct {
+	Name       string
+	Type       string
+	Default    interface{}
+	HasDefault bool
+}
+
+// Selection is a field requested from an object
+type Selection struct {
+	Alias      string
+	Name       string
+	Arguments  []*Argument
+	Selections []*Selection
+	pos        int
+}
+
+// Argument of a field. Values are nil, bool, int64, float64, string, Enum,
+// Variable, []interface{} or map[string]interface{}
+type Argument struct {
+	Name  string
+	Value interface{}
+}
+
+// Enum is an enum value in a document
+type Enum string
+
+// Variable is a reference to a variable in a document
+type Variable string
+
+// Parse parses a document
+func Parse(src string) (*Document, error) {
+	p := &parser{lexer: lexer{src: src}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := new(Document)
+	for p.tok.kind != tokenEOF {
+		op, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		doc.Operations = append(doc.Operations, op)
+	}
+	if len(doc.Operations) == 0 {
+		return nil, p.lexer.errorf(p.tok.pos, "the document has no operation")
+	}
+	return doc, nil
+}
+
+type parser struct {
+	lexer lexer
+	tok   token
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lexer.next()
+	p.tok = tok
+	return err
+}
+
+func (p *parser) peek(value string) bool {
+	return p.tok.kind == tokenPunctuator && p.tok.value == value
+}
+
+func (p *parser) expect(value string) error {
+	if !p.peek(value) {
+		return p.unexpected("%q", value)
+	}
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.unexpected("a name")
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *parser) unexpected(want string, args ...interface{}) error {
+	got := strconv.Quote(p.tok.value)
+	if p.tok.kind == tokenEOF {
+		got = "end of document"
+	}
+	return p.lexer.errorf(p.tok.pos, "expected "+want+", got %s", append(args, got)...)
+}
+
+func (p *parser) operation() (*Operation, error) {
+	op := &Operation{Type: "query"}
+	if p.peek("{") {
+		selections, err := p.selectionSet()
+		op.Selections = selections
+		return op, err
+	}
+
+	if p.tok.kind != tokenName {
+		return nil, p.unexpected("an operation")
+	}
+	switch p.tok.value {
+	case "query", "mutation":
+		op.Type = p.tok.value
+	case "fragment":
+		return nil, p.lexer.errorf(p.tok.pos, "fragments are not supported")
+	default:
+		return nil, p.lexer.errorf(p.tok.pos, "%s operations are not supported", p.tok.value)
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind == tokenName {
+		op.Name = p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek("(") {
+		variables, err := p.variableDefinitions()
+		if err != nil {
+			return nil, err
+		}
+		op.Variables = variables
+	}
+	if p.peek("@") {
+		return nil, p.lexer.errorf(p.tok.pos, "directives are not supported")
+	}
+
+	selections, err := p.selectionSet()
+	op.Selections = selections
+	return op, err
+}
+
+func (p *parser) variableDefinitions() ([]*VariableDefinition, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var variables []*VariableDefinition
+	for !p.peek(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		typ, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+
+		v := &VariableDefinition{Name: name, Type: typ}
+		if p.peek("=") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if v.Default, err = p.value(true); err != nil {
+				return nil, err
+			}
+			v.HasDefault = true
+		}
+		variables = append(variables, v)
+	}
+	return variables, p.advance()
+}
+
+func (p *parser) typeRef() (string, error) {
+	var typ string
+	if p.peek("[") {
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+		of, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + of + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+
+	if p.peek("!") {
+		typ += "!"
+		return typ, p.advance()
+	}
+	return typ, nil
+}
+
+func (p *parser) selectionSet() ([]*Selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var selections []*Selection
+	for !p.peek("}") {
+		if p.peek("...") {
+			return nil, p.lexer.errorf(p.tok.pos, "fragments are not supported")
+		}
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, s)
+	}
+	if len(selections) == 0 {
+		return nil, p.lexer.errorf(p.tok.pos, "empty selection set")
+	}
+	return selections, p.advance()
+}
+
+func (p *parser) selection() (*Selection, error) {
+	s := &Selection{pos: p.tok.pos}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	s.Name = name
+
+	if p.peek(":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		s.Alias = name
+		if s.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek("(") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for !p.peek(")") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			value, err := p.value(false)
+			if err != nil {
+				return nil, err
+			}
+			s.Arguments = append(s.Arguments, &Argument{Name: name, Value: value})
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("@") {
+		return nil, p.lexer.errorf(p.tok.pos, "directives are not supported")
+	}
+
+	if p.peek("{") {
+		if s.Selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// value parses a value, constant values can't refer to variables
+func (p *parser) value(constant bool) (interface{}, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokenInt:
+		v, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, p.lexer.errorf(tok.pos, "invalid integer %s", tok.value)
+		}
+		return v, p.advance()
+	case tokenFloat:
+		v, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, p.lexer.errorf(tok.pos, "invalid float %s", tok.value)
+		}
+		return v, p.advance()
+	case tokenString:
+		return tok.value, p.advance()
+	case tokenName:
+		var v interface{}
+		switch tok.value {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			v = Enum(tok.value)
+		}
+		return v, p.advance()
+	}
+
+	switch {
+	case p.peek("$") && !constant:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return Variable(name), err
+	case p.peek("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for !p.peek("]") {
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.advance()
+	case p.peek("{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		object := map[string]interface{}{}
+		for !p.peek("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if object[name], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		return object, p.advance()
+	}
+	return nil, p.unexpected("a value")
+}
@@ -0,0 +1,87 @@
+package grpcapi
+
+import (
+	"context"
+	"io"
+
+	"google.golang.org/grpc"
+)
+
+// Client calls the League service
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewClient ...
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+// GetScore ...
+func (c *Client) GetScore(ctx context.Context, name string) (int64, error) {
+	score := new(Score)
+	err := c.conn.Invoke(ctx, "/"+serviceName+"/GetScore", &GetScoreRequest{Name: name}, score)
+	return score.Wins, err
+}
+
+// RecordWin records a win, at most once per key when key isn't empty.
+// It returns whether the win was already recorded with the key
+func (c *Client) RecordWin(ctx context.Context, name, key string) (bool, error) {
+	resp := new(RecordWinResponse)
+	err := c.conn.Invoke(ctx, "/"+serviceName+"/RecordWin", &RecordWinRequest{Name: name, IdempotencyKey: key}, resp)
+	return resp.Replayed, err
+}
+
+// GetLeague ...
+func (c *Client) GetLeague(ctx context.Context) ([]*Player, error) {
+	stream, err := c.stream(ctx, 0, "GetLeague", &GetLeagueRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	var league []*Player
+	for {
+		p := new(Player)
+		if err := stream.RecvMsg(p); err == io.EOF {
+			return league, nil
+		} else if err != nil {
+			return nil, err
+		}
+		league = append(league, p)
+	}
+}
+
+// LeagueWatcher receives the updates of a watched league
+type LeagueWatcher struct {
+	stream grpc.ClientStream
+}
+
+// Recv blocks until the next update, cancel the context passed to
+// WatchLeague to stop watching
+func (w *LeagueWatcher) Recv() (*LeagueUpdate, error) {
+	update := new(LeagueUpdate)
+	if err := w.stream.RecvMsg(update); err != nil {
+		return nil, err
+	}
+	return update, nil
+}
+
+// WatchLeague watches the top players, all of them when top is 0
+func (c *Client) WatchLeague(ctx context.Context, top int32) (*LeagueWatcher, error) {
+	stream, err := c.stream(ctx, 1, "WatchLeague", &WatchLeagueRequest{Top: top})
+	if err != nil {
+		return nil, err
+	}
+	return &LeagueWatcher{stream: stream}, nil
+}
+
+func (c *Client) stream(ctx context.Context, i int, method string, req interface{}) (grpc.ClientStream, error) {
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[i], "/"+serviceName+"/"+method)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return nil, err
+	}
+	return stream, stream.CloseSend()
+}
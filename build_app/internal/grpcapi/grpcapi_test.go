@@ -0,0 +1,186 @@
+package grpcapi_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	"github.com/windnow/edusrv/internal/grpcapi"
+	. "github.com/windnow/edusrv/internal/helpers"
+	fs "github.com/windnow/edusrv/internal/infsstore"
+	"github.com/windnow/edusrv/internal/replication"
+)
+
+func TestLeagueService(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("records wins and reads them back", func(t *testing.T) {
+		client, _, clean := newService(t)
+		defer clean()
+
+		for _, name := range []string{"Pepper", "Cleo", "Pepper"} {
+			_, err := client.RecordWin(ctx, name, "")
+			assertNoError(t, err)
+		}
+
+		wins, err := client.GetScore(ctx, "Pepper")
+		assertNoError(t, err)
+		if wins != 2 {
+			t.Errorf("got %d wins want %d", wins, 2)
+		}
+
+		league, err := client.GetLeague(ctx)
+		assertNoError(t, err)
+		assertPlayers(t, league, []*grpcapi.Player{{Name: "Pepper", Wins: 2}, {Name: "Cleo", Wins: 1}})
+	})
+
+	t.Run("reports unknown players", func(t *testing.T) {
+		client, _, clean := newService(t)
+		defer clean()
+
+		_, err := client.GetScore(ctx, "Apollo")
+		assertCode(t, err, codes.NotFound)
+	})
+
+	t.Run("records a win once per key", func(t *testing.T) {
+		client, store, clean := newService(t)
+		defer clean()
+
+		replayed, err := client.RecordWin(ctx, "Pepper", "game-1")
+		assertNoError(t, err)
+		if replayed {
+			t.Error("first win reported as replayed")
+		}
+
+		replayed, err = client.RecordWin(ctx, "Pepper", "game-1")
+		assertNoError(t, err)
+		if !replayed {
+			t.Error("second win not reported as replayed")
+		}
+		if got := store.GetPlayerScore("Pepper"); got != 1 {
+			t.Errorf("got %d wins want %d", got, 1)
+		}
+
+		_, err = client.RecordWin(ctx, "Cleo", "game-1")
+		assertCode(t, err, codes.FailedPrecondition)
+	})
+
+	t.Run("refuses idempotency keys that are too long", func(t *testing.T) {
+		client, store, clean := newService(t)
+		defer clean()
+
+		_, err := client.RecordWin(ctx, "Pepper", strings.Repeat("k", gs.MaxIdempotencyKeyLength+1))
+		assertCode(t, err, codes.InvalidArgument)
+		if got := store.GetPlayerScore("Pepper"); got != 0 {
+			t.Errorf("got %d wins want %d", got, 0)
+		}
+	})
+
+	t.Run("refuses wins without a name", func(t *testing.T) {
+		client, _, clean := newService(t)
+		defer clean()
+
+		_, err := client.RecordWin(ctx, "", "")
+		assertCode(t, err, codes.InvalidArgument)
+	})
+
+	t.Run("refuses wins while following a leader", func(t *testing.T) {
+		leader := "http://leader:5000"
+		client, store, clean := newService(t, grpcapi.WithLeader(func() string { return leader }))
+		defer clean()
+
+		_, err := client.RecordWin(ctx, "Pepper", "")
+		assertCode(t, err, codes.FailedPrecondition)
+
+		leader = ""
+		_, err = client.RecordWin(ctx, "Pepper", "")
+		assertNoError(t, err)
+		if got := store.GetPlayerScore("Pepper"); got != 1 {
+			t.Errorf("got %d wins want %d", got, 1)
+		}
+	})
+
+	t.Run("watches the league", func(t *testing.T) {
+		client, store, clean := newService(t)
+		defer clean()
+		store.RecordWin("Cleo")
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		watcher, err := client.WatchLeague(ctx, 1)
+		assertNoError(t, err)
+
+		update, err := watcher.Recv()
+		assertNoError(t, err)
+		assertPlayers(t, update.Players, []*grpcapi.Player{{Name: "Cleo", Wins: 1}})
+
+		store.RecordWin("Pepper")
+		store.RecordWin("Pepper")
+		update, err = watcher.Recv()
+		assertNoError(t, err)
+		assertPlayers(t, update.Players, []*grpcapi.Player{{Name: "Pepper", Wins: 2}})
+	})
+}
+
+func newService(t *testing.T, options ...grpcapi.Option) (*grpcapi.Client, gs.PlayerStore, func()) {
+	t.Helper()
+	database, cleanDatabase := CreateTempFile(t, "")
+	changes := replication.NewLog(replication.DefaultLogSize)
+	store, err := fs.NewFileSystemPlayerStore(database, fs.WithChangeLog(changes))
+	assertNoError(t, err)
+
+	listener := bufconn.Listen(1024 * 1024)
+	// Watched leagues are sent on changes only, never on a timer
+	options = append(options, grpcapi.WithChanges(changes.Changed), grpcapi.WithWatchInterval(time.Hour))
+	server := grpcapi.NewServer(store, options...).GRPCServer()
+	go server.Serve(listener)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assertNoError(t, err)
+
+	return grpcapi.NewClient(conn), store, func() {
+		conn.Close()
+		server.Stop()
+		cleanDatabase()
+	}
+}
+
+func assertPlayers(t *testing.T, got, want []*grpcapi.Player) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	for i := range got {
+		if !proto.Equal(got[i], want[i]) {
+			t.Errorf("got %v want %v", got, want)
+		}
+	}
+}
+
+func assertCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Errorf("got code %v want %v, %v", got, want, err)
+	}
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("didn't expect an error but got one, %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package grpcapi
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMessagesWireFormat(t *testing.T) {
+	update := &LeagueUpdate{Players: []*Player{{Name: "Cleo", Wins: 3}, {Name: "Al"}}}
+	// what clients generated from league.proto in other languages write
+	want := []byte{0x0a, 0x08, 0x0a, 0x04, 'C', 'l', 'e', 'o', 0x10, 0x03, 0x0a, 0x04, 0x0a, 0x02, 'A', 'l'}
+
+	got, err := proto.MarshalOptions{Deterministic: true}.Marshal(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got % x want % x", got, want)
+	}
+
+	decoded := new(LeagueUpdate)
+	// an unknown field is kept but doesn't get in the way
+	if err := proto.Unmarshal(append(got, 0x18, 0x01), decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(decoded.Players[0], update.Players[0]) || !proto.Equal(decoded.Players[1], update.Players[1]) {
+		t.Errorf("got %v want %v", decoded, update)
+	}
+
+	if err := proto.Unmarshal([]byte{0x0a, 0x08, 0x0a}, decoded); err == nil {
+		t.Error("expected an error for a truncated message but didn't get one")
+	}
+}
@@ -0,0 +1,307 @@
+// Package grpcapi serves the league over gRPC, see league.proto, on top of
+// the same gameserver.PlayerStore as the HTTP server
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative league.proto
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	"github.com/windnow/edusrv/internal/ratelimit"
+)
+
+const (
+	serviceName          = "gamelogger.v1.League"
+	defaultWatchInterval = time.Second
+)
+
+// Server implements the League service
+type Server struct {
+	store         gs.PlayerStore
+	idempotent    gs.IdempotentStore
+	fallible      gs.FallibleStore
+	winCooldown   *ratelimit.Cooldown
+	watchInterval time.Duration
+	changed       func() <-chan struct{}
+	leader        func() string
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithWinCooldown limits how often wins of a player can be recorded, share
+// the cooldown with the HTTP server to apply it to both
+func WithWinCooldown(cooldown *ratelimit.Cooldown) Option {
+	return func(s *Server) {
+		s.winCooldown = cooldown
+	}
+}
+
+// WithChanges sends the updates of watched leagues when the channel
+// returned by changed is closed, see replication.Log.Changed
+func WithChanges(changed func() <-chan struct{}) Option {
+	return func(s *Server) {
+		s.changed = changed
+	}
+}
+
+// WithWatchInterval sets how often watched leagues are checked for
+// changes without WithChanges, every second by default
+func WithWatchInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		s.watchInterval = interval
+	}
+}
+
+// WithLeader refuses wins while leader returns the address of another
+// node, which takes the writes, see replication.Node.Leader
+func WithLeader(leader func() string) Option {
+	return func(s *Server) {
+		s.leader = leader
+	}
+}
+
+// NewServer ...
+func NewServer(store gs.PlayerStore, options ...Option) *Server {
+	s := &Server{store: store, watchInterval: defaultWatchInterval}
+	s.idempotent, _ = store.(gs.IdempotentStore)
+	s.fallible, _ = store.(gs.FallibleStore)
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// GRPCServer returns a gRPC server serving the service
+func (s *Server) GRPCServer(options ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(options...)
+	server.RegisterService(&serviceDesc, s)
+	return server
+}
+
+// GetScore ...
+func (s *Server) GetScore(ctx context.Context, req *GetScoreRequest) (*Score, error) {
+	wins := s.store.GetPlayerScore(req.Name)
+	if wins == 0 {
+		return nil, status.Errorf(codes.NotFound, "player %q has no wins", req.Name)
+	}
+	return &Score{Name: req.Name, Wins: int64(wins)}, nil
+}
+
+// RecordWin ...
+func (s *Server) RecordWin(ctx context.Context, req *RecordWinRequest) (*RecordWinResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing player name")
+	}
+	if s.leader != nil {
+		if leader := s.leader(); leader != "" {
+			return nil, status.Errorf(codes.FailedPrecondition, "read-only follower, record wins with the leader at %s", leader)
+		}
+	}
+
+	if req.IdempotencyKey == "" {
+		if err := s.allowWin(req.Name); err != nil {
+			return nil, err
+		}
+		if s.fallible != nil {
+			if err := s.fallible.TryRecordWins([]string{req.Name}); err != nil {
+				s.releaseWin(req.Name)
+				return nil, status.Errorf(codes.Unavailable, "problem recording win, %v", err)
+			}
+			return &RecordWinResponse{}, nil
+		}
+		s.store.RecordWin(req.Name)
+		return &RecordWinResponse{}, nil
+	}
+
+	if s.idempotent == nil {
+		return nil, status.Error(codes.Unimplemented, "idempotency keys are not supported by the store")
+	}
+	if len(req.IdempotencyKey) > gs.MaxIdempotencyKeyLength {
+		return nil, status.Error(codes.InvalidArgument, "idempotency key is too long")
+	}
+	if name, ok := s.idempotent.LookupWinKey(req.IdempotencyKey); ok {
+		return replayWin(req.Name, name)
+	}
+	if err := s.allowWin(req.Name); err != nil {
+		return nil, err
+	}
+	name, recorded := "", false
+	if s.fallible != nil {
+		var err error
+		if name, recorded, err = s.fallible.TryRecordWinOnce(req.Name, req.IdempotencyKey); err != nil {
+			s.releaseWin(req.Name)
+			return nil, status.Errorf(codes.Unavailable, "problem recording win, %v", err)
+		}
+	} else {
+		name, recorded = s.idempotent.RecordWinOnce(req.Name, req.IdempotencyKey)
+	}
+	if !recorded {
+		s.releaseWin(req.Name)
+		return replayWin(req.Name, name)
+	}
+	return &RecordWinResponse{}, nil
+}
+
+func (s *Server) allowWin(name string) error {
+	if s.winCooldown == nil {
+		return nil
+	}
+	if ok, wait := s.winCooldown.Allow(name); !ok {
+		return status.Errorf(codes.ResourceExhausted, "win cooldown, retry after %s", wait)
+	}
+	return nil
+}
+
+// releaseWin takes back the cooldown of a win that wasn't recorded
+func (s *Server) releaseWin(name string) {
+	if s.winCooldown != nil {
+		s.winCooldown.Release(name)
+	}
+}
+
+func replayWin(name, recordedFor string) (*RecordWinResponse, error) {
+	if name != recordedFor {
+		return nil, status.Error(codes.FailedPrecondition, "idempotency key was used for another player")
+	}
+	return &RecordWinResponse{Replayed: true}, nil
+}
+
+// GetLeague ...
+func (s *Server) GetLeague(req *GetLeagueRequest, stream grpc.ServerStream) error {
+	for _, p := range s.store.GetLeague() {
+		if err := stream.SendMsg(&Player{Name: p.Name, Wins: int64(p.Wins)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WatchLeague sends the league whenever it changes until the client goes
+// away. Without WithChanges the league is checked every watch interval
+func (s *Server) WatchLeague(req *WatchLeagueRequest, stream grpc.ServerStream) error {
+	if req.Top < 0 {
+		return status.Error(codes.InvalidArgument, "top must not be negative")
+	}
+
+	var tick <-chan time.Time
+	if s.changed == nil {
+		ticker := time.NewTicker(s.watchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var last gs.League
+	sent := false
+	for {
+		// Taken before reading the league so that no change goes unnoticed
+		var changed <-chan struct{}
+		if s.changed != nil {
+			changed = s.changed()
+		}
+
+		league := s.store.GetLeague()
+		if req.Top > 0 && len(league) > int(req.Top) {
+			league = league[:req.Top]
+		}
+		if !sent || !sameLeague(league, last) {
+			update := &LeagueUpdate{Players: make([]*Player, len(league))}
+			for i, p := range league {
+				update.Players[i] = &Player{Name: p.Name, Wins: int64(p.Wins)}
+			}
+			if err := stream.SendMsg(update); err != nil {
+				return err
+			}
+			last, sent = league, true
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-changed:
+		case <-tick:
+		}
+	}
+}
+
+func sameLeague(a, b gs.League) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetScore",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(GetScoreRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return unary(ctx, req, "GetScore", interceptor, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(*Server).GetScore(ctx, req.(*GetScoreRequest))
+				})
+			},
+		},
+		{
+			MethodName: "RecordWin",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(RecordWinRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return unary(ctx, req, "RecordWin", interceptor, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(*Server).RecordWin(ctx, req.(*RecordWinRequest))
+				})
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetLeague",
+			ServerStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				req := new(GetLeagueRequest)
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(*Server).GetLeague(req, stream)
+			},
+		},
+		{
+			StreamName:    "WatchLeague",
+			ServerStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				req := new(WatchLeagueRequest)
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(*Server).WatchLeague(req, stream)
+			},
+		},
+	},
+	Metadata: "league.proto",
+}
+
+func unary(ctx context.Context, req interface{}, method string, interceptor grpc.UnaryServerInterceptor, handler grpc.UnaryHandler) (interface{}, error) {
+	if interceptor == nil {
+		return handler(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/" + serviceName + "/" + method}
+	return interceptor(ctx, req, info, handler)
+}
@@ -6,13 +6,20 @@ import (
 	"testing"
 )
 
-// CreateTempFile ...
-func CreateTempFile(t *testing.T, initialData string) (*os.File, func()) {
+// CreateTempFile creates a file with initialData in its own temporary
+// directory, so files the code under test puts next to it are removed too
+func CreateTempFile(t testing.TB, initialData string) (*os.File, func()) {
 	t.Helper()
 
-	tmpfile, err := ioutil.TempFile("", "db")
+	dir, err := ioutil.TempDir("", "db")
+	if err != nil {
+		t.Fatalf("could't create tmp dir %v", err)
+	}
+
+	tmpfile, err := ioutil.TempFile(dir, "db")
 
 	if err != nil {
+		os.RemoveAll(dir)
 		t.Fatalf("could't create tmp file %v", err)
 	}
 
@@ -20,6 +27,6 @@ func CreateTempFile(t *testing.T, initialData string) (*os.File, func()) {
 
 	return tmpfile, func() {
 		tmpfile.Close()
-		os.Remove(tmpfile.Name())
+		os.RemoveAll(dir)
 	}
 }
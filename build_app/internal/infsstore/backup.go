@@ -0,0 +1,378 @@
+package infsstore
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+)
+
+const (
+	snapshotPrefix = "snapshot-"
+	snapshotTime   = "20060102T150405.000000000Z"
+	journalName    = "journal.ndjson"
+)
+
+// ErrNoSnapshot is returned by Restore when no snapshot precedes the
+// requested time
+var ErrNoSnapshot = errors.New("no snapshot found")
+
+// BackupConfig ...
+type BackupConfig struct {
+	// Dir holds the snapshots and the journal
+	Dir string
+	// Interval between snapshots, zero disables periodic snapshots
+	Interval time.Duration
+	// Compress snapshots with gzip
+	Compress bool
+	// KeepHourly is the number of the latest hours a snapshot is kept for
+	KeepHourly int
+	// KeepDaily is the number of the latest days a snapshot is kept for
+	KeepDaily int
+	// Now defaults to time.Now
+	Now func() time.Time
+}
+
+// snapshot is the content of a snapshot file
+type snapshot struct {
+	Taken    time.Time   `json:"taken"`
+	Seq      uint64      `json:"seq"`
+	Database gs.Database `json:"database"`
+}
+
+// Backup writes snapshots of a FileSystemPlayerStore and journals the
+// changes made between them
+type Backup struct {
+	config BackupConfig
+	store  *FileSystemPlayerStore
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewBackup attaches the backup subsystem to the store, takes an initial
+// snapshot and starts taking them every config.Interval until Close
+func NewBackup(store *FileSystemPlayerStore, config BackupConfig) (*Backup, error) {
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	if err := os.MkdirAll(config.Dir, 0777); err != nil {
+		return nil, fmt.Errorf("problem creating backup dir %s, %v", config.Dir, err)
+	}
+
+	j, err := openJournal(filepath.Join(config.Dir, journalName), config.Now)
+	if err != nil {
+		return nil, err
+	}
+
+	store.mu.Lock()
+	store.journal = j
+	store.mu.Unlock()
+
+	b := &Backup{
+		config: config,
+		store:  store,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	if _, err := b.Snapshot(); err != nil {
+		b.detach()
+		return nil, err
+	}
+
+	go b.loop()
+
+	return b, nil
+}
+
+func (b *Backup) loop() {
+	defer close(b.done)
+	if b.config.Interval <= 0 {
+		<-b.stop
+		return
+	}
+
+	ticker := time.NewTicker(b.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := b.Snapshot(); err != nil {
+				b.store.logger.Error("problem taking snapshot", "dir", b.config.Dir, "error", err)
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Close stops periodic snapshots, takes the final one and detaches the
+// journal from the store
+func (b *Backup) Close() error {
+	close(b.stop)
+	<-b.done
+
+	_, err := b.Snapshot()
+	if derr := b.detach(); err == nil {
+		err = derr
+	}
+	return err
+}
+
+func (b *Backup) detach() error {
+	b.store.mu.Lock()
+	defer b.store.mu.Unlock()
+
+	err := b.store.journal.close()
+	b.store.journal = nil
+	return err
+}
+
+// Snapshot writes the current database to a new snapshot file, applies the
+// retention policy and returns the name of the file
+func (b *Backup) Snapshot() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.store.mu.RLock()
+	snap := snapshot{
+		Taken:    b.config.Now().UTC(),
+		Seq:      b.store.journal.seq,
+		Database: b.store.snapshot(),
+	}
+	// the keys are expired in place once the lock is released
+	snap.Database.Keys = append([]gs.IdempotencyKey(nil), snap.Database.Keys...)
+	b.store.mu.RUnlock()
+
+	name := filepath.Join(b.config.Dir, snapshotPrefix+snap.Taken.Format(snapshotTime)+".json")
+	if b.config.Compress {
+		name += ".gz"
+	}
+
+	if err := writeSnapshot(name, snap); err != nil {
+		return "", fmt.Errorf("problem writing snapshot %s, %v", name, err)
+	}
+
+	if err := b.prune(); err != nil {
+		return name, err
+	}
+	return name, b.compactJournal()
+}
+
+// compactJournal drops the journal entries the oldest kept snapshot
+// contains, restoring to an earlier time isn't possible anyway
+func (b *Backup) compactJournal() error {
+	files, err := listSnapshots(b.config.Dir)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	oldest, err := readSnapshot(files[len(files)-1].name)
+	if err != nil {
+		return fmt.Errorf("problem reading snapshot %s, %v", files[len(files)-1].name, err)
+	}
+	return b.store.journal.compact(oldest.Seq, &b.store.mu)
+}
+
+func writeSnapshot(name string, snap snapshot) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".snapshot")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var w io.Writer = tmp
+	var zw *gzip.Writer
+	if strings.HasSuffix(name, ".gz") {
+		zw = gzip.NewWriter(tmp)
+		w = zw
+	}
+	if err := json.NewEncoder(w).Encode(snap); err != nil {
+		return err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func readSnapshot(name string) (snapshot, error) {
+	var snap snapshot
+
+	file, err := os.Open(name)
+	if err != nil {
+		return snap, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return snap, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	err = json.NewDecoder(r).Decode(&snap)
+	return snap, err
+}
+
+type snapshotFile struct {
+	name  string
+	taken time.Time
+}
+
+// listSnapshots returns snapshot files in dir, the newest first
+func listSnapshots(dir string) ([]snapshotFile, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []snapshotFile
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, snapshotPrefix) {
+			continue
+		}
+		stamp := strings.TrimPrefix(name, snapshotPrefix)
+		stamp = strings.TrimSuffix(strings.TrimSuffix(stamp, ".gz"), ".json")
+		taken, err := time.Parse(snapshotTime, stamp)
+		if err != nil {
+			continue
+		}
+		files = append(files, snapshotFile{filepath.Join(dir, name), taken})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].taken.After(files[j].taken)
+	})
+	return files, nil
+}
+
+// prune keeps the newest snapshot plus the newest one of each of the last
+// KeepHourly hours and KeepDaily days, removing the rest
+func (b *Backup) prune() error {
+	files, err := listSnapshots(b.config.Dir)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	keep := map[string]bool{files[0].name: true}
+	retain := func(n int, bucket func(time.Time) time.Time) {
+		seen := make(map[time.Time]bool)
+		for _, f := range files {
+			key := bucket(f.taken)
+			if seen[key] {
+				continue
+			}
+			if len(seen) == n {
+				return
+			}
+			seen[key] = true
+			keep[f.name] = true
+		}
+	}
+	retain(b.config.KeepHourly, func(t time.Time) time.Time { return t.Truncate(time.Hour) })
+	retain(b.config.KeepDaily, func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	})
+
+	for _, f := range files {
+		if keep[f.name] {
+			continue
+		}
+		if err := os.Remove(f.name); err != nil {
+			return fmt.Errorf("problem removing snapshot %s, %v", f.name, err)
+		}
+	}
+	return nil
+}
+
+// Restore rebuilds the database as it was at the given time from the
+// latest snapshot taken before it and the journal entries that follow
+func Restore(dir string, at time.Time) (gs.Database, error) {
+	files, err := listSnapshots(dir)
+	if err != nil {
+		return gs.Database{}, fmt.Errorf("problem listing snapshots in %s, %v", dir, err)
+	}
+
+	var base *snapshotFile
+	for i := range files {
+		if !files[i].taken.After(at) {
+			base = &files[i]
+			break
+		}
+	}
+	if base == nil {
+		return gs.Database{}, fmt.Errorf("%w at or before %s", ErrNoSnapshot, at.Format(time.RFC3339))
+	}
+
+	snap, err := readSnapshot(base.name)
+	if err != nil {
+		return gs.Database{}, fmt.Errorf("problem reading snapshot %s, %v", base.name, err)
+	}
+	if snap.Database.Version > gs.SchemaVersion {
+		return gs.Database{}, fmt.Errorf("%w: version %d, supported %d", gs.ErrNewerSchema, snap.Database.Version, gs.SchemaVersion)
+	}
+
+	db := snap.Database
+	db.Version = gs.SchemaVersion
+	hours := newWinBuckets(hourBucket)
+	for _, b := range db.Buckets {
+		for name, wins := range b.Wins {
+			hours.add(name, b.Start, wins)
+		}
+	}
+
+	file, err := os.Open(filepath.Join(dir, journalName))
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return db, fmt.Errorf("problem opening journal, %v", err)
+	}
+	defer file.Close()
+
+	errStop := errors.New("stop")
+	_, err = readJournal(file, func(e journalEntry) error {
+		if e.At.After(at) {
+			return errStop
+		}
+		if e.Seq > snap.Seq {
+			db.Players = e.apply(db.Players)
+			db.Keys = e.applyKey(db.Keys)
+			if e.Op == opWin {
+				hours.add(e.Name, e.At, 1)
+			}
+		}
+		return nil
+	})
+	db.Buckets = hours.buckets(time.Time{})
+	if err != nil && err != errStop {
+		return db, err
+	}
+	return db, nil
+}
@@ -0,0 +1,210 @@
+package infsstore_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	. "github.com/windnow/edusrv/internal/helpers"
+	fs "github.com/windnow/edusrv/internal/infsstore"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) time.Time {
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+func TestBackup(t *testing.T) {
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	newStore := func(t *testing.T, config *fs.BackupConfig, options ...fs.Option) (*fs.FileSystemPlayerStore, *fs.Backup, func()) {
+		t.Helper()
+		database, cleanDatabase := CreateTempFile(t, `[{"Name": "Cleo", "Wins": 10}]`)
+		store, err := fs.NewFileSystemPlayerStore(database, options...)
+		assertNoError(t, err)
+
+		config.Dir = filepath.Join(filepath.Dir(database.Name()), "backups")
+		backup, err := fs.NewBackup(store, *config)
+		assertNoError(t, err)
+		return store, backup, cleanDatabase
+	}
+
+	t.Run("restores point in time from snapshot and journal", func(t *testing.T) {
+		clock := &fakeClock{start}
+		config := &fs.BackupConfig{Compress: true, KeepHourly: 10, Now: clock.Now}
+		store, backup, clean := newStore(t, config)
+		defer clean()
+
+		clock.Advance(30 * time.Minute)
+		store.RecordWin("Chris")
+		afterFirstWin := clock.Advance(15 * time.Minute)
+
+		clock.Advance(15 * time.Minute)
+		_, err := backup.Snapshot()
+		assertNoError(t, err)
+
+		clock.Advance(30 * time.Minute)
+		store.RecordWin("Cleo")
+		clock.Advance(30 * time.Minute)
+		assertNoError(t, backup.Close())
+		dir := config.Dir
+
+		db, err := fs.Restore(dir, afterFirstWin)
+		assertNoError(t, err)
+		assertLeague(t, db.Players, []gs.Player{{Name: "Cleo", Wins: 10}, {Name: "Chris", Wins: 1}})
+
+		db, err = fs.Restore(dir, clock.Now())
+		assertNoError(t, err)
+		assertLeague(t, db.Players, []gs.Player{{Name: "Cleo", Wins: 11}, {Name: "Chris", Wins: 1}})
+
+		_, err = fs.Restore(dir, start.Add(-time.Second))
+		if !errors.Is(err, fs.ErrNoSnapshot) {
+			t.Errorf("got error %v, want %v", err, fs.ErrNoSnapshot)
+		}
+	})
+
+	t.Run("restores idempotency keys and windowed wins", func(t *testing.T) {
+		clock := &fakeClock{start}
+		config := &fs.BackupConfig{KeepHourly: 10, Now: clock.Now}
+		store, backup, clean := newStore(t, config, fs.WithClock(clock.Now))
+		defer clean()
+
+		store.RecordWinOnce("Chris", "before-snapshot")
+		_, err := backup.Snapshot()
+		assertNoError(t, err)
+
+		clock.Advance(time.Hour)
+		store.RecordWinOnce("Chris", "after-snapshot")
+		store.RecordWin("Cleo")
+		assertNoError(t, backup.Close())
+
+		db, err := fs.Restore(config.Dir, clock.Now())
+		assertNoError(t, err)
+		data, err := json.Marshal(db)
+		assertNoError(t, err)
+		database, cleanDatabase := CreateTempFile(t, string(data))
+		defer cleanDatabase()
+		restored, err := fs.NewFileSystemPlayerStore(database, fs.WithClock(clock.Now))
+		assertNoError(t, err)
+
+		for _, key := range []string{"before-snapshot", "after-snapshot"} {
+			if name, ok := restored.LookupWinKey(key); !ok || name != "Chris" {
+				t.Errorf("got key %q recorded for %q %v, want Chris", key, name, ok)
+			}
+		}
+		assertLeague(t, restored.GetLeagueBetween(start, start.Add(time.Hour)), []gs.Player{{Name: "Chris", Wins: 1}})
+		assertLeague(t, restored.GetLeagueBetween(start.Add(time.Hour), clock.Now().Add(time.Hour)),
+			[]gs.Player{{Name: "Chris", Wins: 1}, {Name: "Cleo", Wins: 1}})
+	})
+
+	t.Run("drops an entry torn at the end of the journal", func(t *testing.T) {
+		clock := &fakeClock{start}
+		config := &fs.BackupConfig{KeepHourly: 10, Now: clock.Now}
+		store, backup, clean := newStore(t, config)
+		defer clean()
+		store.RecordWin("Chris")
+		assertNoError(t, backup.Close())
+
+		journal := filepath.Join(config.Dir, "journal.ndjson")
+		file, err := os.OpenFile(journal, os.O_WRONLY|os.O_APPEND, 0666)
+		assertNoError(t, err)
+		file.WriteString(`{"seq": 2, "op": "wi`)
+		file.Close()
+
+		backup, err = fs.NewBackup(store, *config)
+		assertNoError(t, err)
+		clock.Advance(time.Minute)
+		store.RecordWin("Chris")
+		assertNoError(t, backup.Close())
+
+		db, err := fs.Restore(config.Dir, clock.Now())
+		assertNoError(t, err)
+		assertLeague(t, db.Players, []gs.Player{{Name: "Cleo", Wins: 10}, {Name: "Chris", Wins: 2}})
+	})
+
+	t.Run("compacts the journal to the oldest kept snapshot", func(t *testing.T) {
+		clock := &fakeClock{start}
+		config := &fs.BackupConfig{KeepHourly: 2, Now: clock.Now}
+		store, backup, clean := newStore(t, config)
+		defer clean()
+
+		for i := 0; i < 6; i++ {
+			clock.Advance(time.Hour)
+			store.RecordWin("Chris")
+			_, err := backup.Snapshot()
+			assertNoError(t, err)
+		}
+		clock.Advance(time.Minute)
+		store.RecordWin("Chris")
+
+		data, err := os.ReadFile(filepath.Join(config.Dir, "journal.ndjson"))
+		assertNoError(t, err)
+		if got := strings.Count(string(data), "\n"); got != 2 {
+			t.Errorf("got %d journal entries, want 2:\n%s", got, data)
+		}
+
+		db, err := fs.Restore(config.Dir, clock.Now())
+		assertNoError(t, err)
+		assertLeague(t, db.Players, []gs.Player{{Name: "Cleo", Wins: 10}, {Name: "Chris", Wins: 7}})
+		assertNoError(t, backup.Close())
+	})
+
+	t.Run("keeps newest snapshot of each retained hour", func(t *testing.T) {
+		clock := &fakeClock{start}
+		config := &fs.BackupConfig{KeepHourly: 2, Now: clock.Now}
+		_, backup, clean := newStore(t, config)
+		defer clean()
+
+		for i := 0; i < 6; i++ {
+			clock.Advance(30 * time.Minute)
+			_, err := backup.Snapshot()
+			assertNoError(t, err)
+		}
+
+		files, err := ioutil.ReadDir(config.Dir)
+		assertNoError(t, err)
+
+		var snapshots []string
+		for _, f := range files {
+			if filepath.Ext(f.Name()) == ".json" {
+				snapshots = append(snapshots, f.Name())
+			}
+		}
+		want := []string{
+			"snapshot-20261019T123000.000000000Z.json",
+			"snapshot-20261019T130000.000000000Z.json",
+		}
+		if !reflect.DeepEqual(snapshots, want) {
+			t.Errorf("got snapshots %v, want %v", snapshots, want)
+		}
+	})
+}
+
+func assertLeague(t *testing.T, got, want gs.League) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("didn't expect an error but got one, %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package infsstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultMinFreeSpace is the free disk space below which the store is not
+// ready, enough for a few rewrites of a sizable league
+const defaultMinFreeSpace = 64 * 1024 * 1024
+
+// errFreeSpaceUnsupported is returned by freeSpace where it can't be told
+var errFreeSpaceUnsupported = errors.New("free space is not supported on this platform")
+
+// WithMinFreeSpace sets the free disk space below which Check fails
+func WithMinFreeSpace(bytes uint64) Option {
+	return func(f *FileSystemPlayerStore) {
+		f.minFreeSpace = bytes
+	}
+}
+
+// Check reports whether the database file is open and writable and the disk
+// it is on has enough free space
+func (f *FileSystemPlayerStore) Check(ctx context.Context) error {
+	f.mu.RLock()
+	file := f.file
+	f.mu.RUnlock()
+
+	if _, err := file.Stat(); err != nil {
+		return fmt.Errorf("database is not open, %v", err)
+	}
+
+	w, err := os.OpenFile(file.Name(), os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("database is not writable, %v", err)
+	}
+	w.Close()
+
+	free, err := freeSpace(filepath.Dir(file.Name()))
+	if err == errFreeSpaceUnsupported {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("problem getting free disk space, %v", err)
+	}
+	if free < f.minFreeSpace {
+		return fmt.Errorf("disk is almost full, %d bytes free", free)
+	}
+	return ctx.Err()
+}
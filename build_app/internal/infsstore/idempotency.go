@@ -0,0 +1,86 @@
+package infsstore
+
+import (
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+)
+
+// defaultIdempotencyWindow is how long keys of recorded wins are remembered
+const defaultIdempotencyWindow = 24 * time.Hour
+
+// WithIdempotencyWindow sets how long the keys wins were recorded with are
+// remembered, a day by default
+func WithIdempotencyWindow(window time.Duration) Option {
+	return func(f *FileSystemPlayerStore) {
+		f.keyWindow = window
+	}
+}
+
+// WithClock sets the source of the current time, time.Now by default
+func WithClock(now func() time.Time) Option {
+	return func(f *FileSystemPlayerStore) {
+		f.now = now
+	}
+}
+
+// LookupWinKey returns the player a win was recorded for with key, as long
+// as the key is remembered
+func (f *FileSystemPlayerStore) LookupWinKey(key string) (string, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	k, ok := f.keys[key]
+	if !ok || f.expired(k, f.now()) {
+		return "", false
+	}
+	return k.Name, true
+}
+
+// RecordWinOnce records a win for name unless a win was recorded with key
+// within the idempotency window. The key is persisted with the win
+func (f *FileSystemPlayerStore) RecordWinOnce(name, key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	f.expireKeys(now)
+	if k, ok := f.keys[key]; ok {
+		return k.Name, false
+	}
+
+	at := now.UTC()
+	f.rememberKey(gs.IdempotencyKey{Key: key, Name: name, At: at})
+	f.win(name, at)
+	if err := f.appendDelta(gs.Delta{Win: name, Key: key, At: &at}); err != nil {
+		f.writeErrors++
+		f.logger.Error("problem persisting win", "player", name, "file", f.file.Name(), "error", err)
+	}
+	if err := f.journal.append(journalEntry{Op: opWin, Name: name, Key: key}); err != nil {
+		f.logger.Error("problem journaling win", "player", name, "error", err)
+	}
+	return name, true
+}
+
+func (f *FileSystemPlayerStore) expired(k gs.IdempotencyKey, now time.Time) bool {
+	return !k.At.Add(f.keyWindow).After(now)
+}
+
+// rememberKey expects keys to be remembered in the order they were used
+func (f *FileSystemPlayerStore) rememberKey(k gs.IdempotencyKey) {
+	if f.keys == nil {
+		f.keys = make(map[string]gs.IdempotencyKey)
+	}
+	f.keys[k.Key] = k
+	f.keyOrder = append(f.keyOrder, k)
+}
+
+// expireKeys forgets the keys used before the idempotency window
+func (f *FileSystemPlayerStore) expireKeys(now time.Time) {
+	n := 0
+	for n < len(f.keyOrder) && f.expired(f.keyOrder[n], now) {
+		delete(f.keys, f.keyOrder[n].Key)
+		n++
+	}
+	f.keyOrder = f.keyOrder[n:]
+}
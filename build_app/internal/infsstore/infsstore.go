@@ -3,34 +3,149 @@ package infsstore
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"sort"
+	"sync"
+	"time"
 
 	gs "github.com/windnow/edusrv/internal/gameserver"
 	"github.com/windnow/edusrv/internal/tape"
 )
 
-// FileSystemPlayerStore ...
+// minCompactSize is the amount of deltas worth rewriting the file for
+const minCompactSize = 64 * 1024
+
+// FileSystemPlayerStore keeps the league in a file, see gs.Database for the
+// format. Wins are appended as small deltas, the file is rewritten as a
+// whole once the deltas outgrow the league itself.
+//
+// In memory players are indexed by name and kept ordered by wins, so
+// lookups, wins and positional queries take O(log n)
 type FileSystemPlayerStore struct {
+	mu       sync.RWMutex
+	file     *os.File
 	database *json.Encoder
-	league   gs.League
+	deltas   *tape.Appender
+	journal  *journal
+	limits   gs.Limits
+	logger   *slog.Logger
+
+	tieBreakers []gs.TieBreaker
+	headToHead  gs.HeadToHeadRecord
+
+	players   map[string]*standing
+	standings *skipList
+	tick      uint64
+
+	// levels holds a standing per distinct number of wins for dense ranks
+	levels     *skipList
+	levelCount map[int]int
+	levelOf    map[int]*standing
+
+	// keys wins were recorded with, in the order they were used
+	keys      map[string]gs.IdempotencyKey
+	keyOrder  []gs.IdempotencyKey
+	keyWindow time.Duration
+	now       func() time.Time
+
+	// wins per hour and per day for windowed leagues
+	hours, days     *winBuckets
+	hourlyRetention time.Duration
+
+	events  gs.EventSink
+	changes gs.ChangeLog
+
+	// sizes of the file and of the envelope at its start
+	size, envelope int64
+	writeErrors    uint64
+	minFreeSpace   uint64
+}
+
+// Option configures a FileSystemPlayerStore
+type Option func(*FileSystemPlayerStore)
+
+// WithLimits bounds the memory used to load the database
+func WithLimits(limits gs.Limits) Option {
+	return func(f *FileSystemPlayerStore) {
+		f.limits = limits
+	}
+}
+
+// WithLogger sets the logger persistence errors are reported to,
+// slog.Default() by default
+func WithLogger(logger *slog.Logger) Option {
+	return func(f *FileSystemPlayerStore) {
+		f.logger = logger
+	}
+}
+
+// WithTieBreakers sets the rules ordering players with the same number of
+// wins, gs.DefaultTieBreakers by default. Whatever the rules, the order is
+// deterministic: players that are still tied keep the order in which they
+// reached their score
+func WithTieBreakers(rules ...gs.TieBreaker) Option {
+	return func(f *FileSystemPlayerStore) {
+		f.tieBreakers = rules
+	}
 }
 
-// GetLeague ...
+// WithHeadToHead sets the source of the gs.HeadToHead rule, without it the
+// rule never breaks a tie
+func WithHeadToHead(record gs.HeadToHeadRecord) Option {
+	return func(f *FileSystemPlayerStore) {
+		f.headToHead = record
+	}
+}
+
+// WithEvents publishes the wins recorded by clients and the changes of
+// leader to sink
+func WithEvents(sink gs.EventSink) Option {
+	return func(f *FileSystemPlayerStore) {
+		f.events = sink
+	}
+}
+
+// GetLeague returns the players ordered by wins and the tie breakers
 func (f *FileSystemPlayerStore) GetLeague() gs.League {
-	sort.Slice(f.league, func(i, j int) bool {
-		return f.league[i].Wins > f.league[j].Wins
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if !f.usesHeadToHead() {
+		return f.standings.slice(0, f.standings.length)
+	}
+	return league(f.headToHeadOrder())
+}
+
+// headToHeadOrder returns the standings in the order of the league. The
+// gs.HeadToHead rule changes without wins being recorded, so unlike the
+// other rules it is applied by sorting the standings whenever they are read
+func (f *FileSystemPlayerStore) headToHeadOrder() []*standing {
+	standings := f.standings.all()
+	less := f.less(true)
+	sort.SliceStable(standings, func(i, j int) bool {
+		return less(standings[i], standings[j])
 	})
-	return f.league
+	return standings
+}
+
+func league(standings []*standing) gs.League {
+	league := make(gs.League, len(standings))
+	for i, s := range standings {
+		league[i] = s.player()
+	}
+	return league
 }
 
 // GetPlayerScore ...
 func (f *FileSystemPlayerStore) GetPlayerScore(name string) int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 
-	player := f.league.Find(name)
+	player, ok := f.players[name]
 
-	if player != nil {
-		return player.Wins
+	if ok {
+		return player.wins
 	}
 
 	return 0
@@ -38,37 +153,399 @@ func (f *FileSystemPlayerStore) GetPlayerScore(name string) int {
 
 // RecordWin ...
 func (f *FileSystemPlayerStore) RecordWin(name string) {
-	player := f.league.Find(name)
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	if player != nil {
-		player.Wins++
-	} else {
-		f.league = append(f.league, gs.Player{Name: name, Wins: 1})
+	at := f.now().UTC()
+	f.win(name, at)
+	if err := f.appendDelta(gs.Delta{Win: name, At: &at}); err != nil {
+		f.writeErrors++
+		f.logger.Error("problem persisting win", "player", name, "file", f.file.Name(), "error", err)
 	}
+	if err := f.journal.append(journalEntry{Op: opWin, Name: name}); err != nil {
+		f.logger.Error("problem journaling win", "player", name, "error", err)
+	}
+}
 
-	f.database.Encode(f.league)
+// RecordWins records the wins in order, appending their deltas with a
+// single write
+func (f *FileSystemPlayerStore) RecordWins(names []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	at := f.now().UTC()
+	deltas := make([]gs.Delta, len(names))
+	for i, name := range names {
+		f.win(name, at)
+		deltas[i] = gs.Delta{Win: name, At: &at}
+	}
+	if err := f.appendDelta(deltas...); err != nil {
+		f.writeErrors++
+		f.logger.Error("problem persisting wins", "wins", len(names), "file", f.file.Name(), "error", err)
+	}
+	for _, name := range names {
+		if err := f.journal.append(journalEntry{Op: opWin, Name: name}); err != nil {
+			f.logger.Error("problem journaling win", "player", name, "error", err)
+		}
+	}
+}
+
+// Top returns up to n best players
+func (f *FileSystemPlayerStore) Top(n int) gs.League {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.usesHeadToHead() {
+		standings := f.headToHeadOrder()
+		if n < len(standings) {
+			standings = standings[:n]
+		}
+		return league(standings)
+	}
+	return f.standings.slice(0, n)
+}
+
+// Stats ...
+func (f *FileSystemPlayerStore) Stats() gs.StoreStats {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return gs.StoreStats{
+		Players:     len(f.players),
+		FileSize:    f.size,
+		WriteErrors: f.writeErrors,
+	}
+}
+
+// GetPlayerRank ...
+func (f *FileSystemPlayerStore) GetPlayerRank(name string, mode gs.RankMode) (gs.Rank, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	player, ok := f.players[name]
+	if !ok {
+		return gs.Rank{}, false
+	}
+	return f.rank(player, mode), true
+}
+
+// GetLeagueAround returns the player with up to n players above and below
+func (f *FileSystemPlayerStore) GetLeagueAround(name string, n int, mode gs.RankMode) ([]gs.Rank, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	player, ok := f.players[name]
+	if !ok {
+		return nil, false
+	}
+
+	if f.usesHeadToHead() {
+		standings := f.headToHeadOrder()
+		pos := 0
+		for standings[pos] != player {
+			pos++
+		}
+		from, to := pos-n, pos+n+1
+		if from < 0 {
+			from = 0
+		}
+		if to > len(standings) {
+			to = len(standings)
+		}
+		ranks := make([]gs.Rank, 0, to-from)
+		for _, s := range standings[from:to] {
+			ranks = append(ranks, f.rank(s, mode))
+		}
+		return ranks, true
+	}
+
+	pos := f.standings.position(player)
+	from := pos - n
+	if from < 0 {
+		from = 0
+	}
+
+	ranks := []gs.Rank{}
+	for x := f.standings.at(from); x != nil && len(ranks) <= pos-from+n; x = x.next[0].node {
+		ranks = append(ranks, f.rank(x.standing, mode))
+	}
+	return ranks, true
+}
+
+func (f *FileSystemPlayerStore) rank(s *standing, mode gs.RankMode) gs.Rank {
+	above := f.standings.countBefore(s.wins)
+	if mode == gs.DenseRank {
+		above = f.levels.countBefore(s.wins)
+	}
+	return gs.Rank{Name: s.name, Wins: s.wins, Rank: above + 1}
+}
+
+// ReplaceLeague swaps the whole league and persists it
+func (f *FileSystemPlayerStore) ReplaceLeague(league gs.League) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.reset(league)
+	if f.changes != nil {
+		f.changes.Reset()
+	}
+	if err := f.save(); err != nil {
+		f.writeErrors++
+		f.logger.Error("problem persisting league", "file", f.file.Name(), "error", err)
+		return fmt.Errorf("problem writing league, %v", err)
+	}
+	if err := f.journal.append(journalEntry{Op: opReplace, Players: league}); err != nil {
+		f.logger.Error("problem journaling league", "error", err)
+	}
+	return nil
 }
 
 // NewFileSystemPlayerStore ...
-func NewFileSystemPlayerStore(file *os.File) (*FileSystemPlayerStore, error) {
+func NewFileSystemPlayerStore(file *os.File, options ...Option) (*FileSystemPlayerStore, error) {
+	store := &FileSystemPlayerStore{
+		file: file,
+		database: json.NewEncoder(&tape.Tape{
+			File: file,
+		}),
+		deltas: &tape.Appender{
+			File: file,
+		},
+	}
+	store.tieBreakers = gs.DefaultTieBreakers
+	store.logger = slog.Default()
+	store.minFreeSpace = defaultMinFreeSpace
+	store.keyWindow = defaultIdempotencyWindow
+	store.now = time.Now
+	store.hours, store.days = newWinBuckets(hourBucket), newWinBuckets(dayBucket)
+	store.hourlyRetention = defaultHourlyRetention
+	for _, option := range options {
+		option(store)
+	}
 
 	err := initialisePlayerDBFile(file)
 	if err != nil {
 		return nil, fmt.Errorf("problem initialising player db file, %v", err)
 	}
 
-	league, err := gs.NewLeague(file)
+	db, envelope, migrated, err := loadDatabase(file, store.limits)
+	if err == nil {
+		store.reset(db.Players)
+		for _, k := range db.Keys {
+			store.rememberKey(k)
+		}
+		store.loadBuckets(db)
+		err = replayDeltas(file, envelope, func(d gs.Delta) error {
+			if _, ok := store.players[d.Win]; !ok {
+				if err := store.limits.Check(len(store.players), d.Win); err != nil {
+					return err
+				}
+			}
+			store.addWin(d.Win)
+			if d.At != nil {
+				store.bucketWin(d.Win, *d.At, 1)
+			}
+			if d.Key != "" && d.At != nil {
+				store.rememberKey(gs.IdempotencyKey{Key: d.Key, Name: d.Win, At: *d.At})
+			}
+			return nil
+		})
+		store.expireKeys(store.now())
+	}
 
 	if err != nil {
-		return nil, fmt.Errorf("problem loading player store from file %s, %v", file.Name(), err)
+		return nil, fmt.Errorf("problem loading player store from file %s, %w", file.Name(), err)
 	}
 
-	return &FileSystemPlayerStore{
-		database: json.NewEncoder(&tape.Tape{
-			File: file,
-		}),
-		league: league,
-	}, nil
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("problem getting file info from file %v, %s", file.Name(), err)
+	}
+
+	store.envelope = envelope
+	store.size = info.Size()
+
+	if migrated {
+		if err := store.save(); err != nil {
+			return nil, fmt.Errorf("problem writing migrated database, %v", err)
+		}
+		store.logger.Info("upgraded database schema", "file", file.Name(), "version", gs.SchemaVersion)
+	}
+
+	return store, nil
+}
+
+// reset replaces the players with the league, keeping the order of ties
+func (f *FileSystemPlayerStore) reset(league gs.League) {
+	f.players = make(map[string]*standing, len(league))
+	f.standings = newSkipList(f.less(false))
+	f.levels = newSkipList(byWins)
+	f.levelCount = make(map[int]int)
+	f.levelOf = make(map[int]*standing)
+	for _, p := range league {
+		f.tick++
+		s := &standing{name: p.Name, wins: p.Wins, tick: f.tick}
+		f.players[p.Name] = s
+		f.standings.insert(s)
+		f.addLevel(p.Wins)
+	}
+}
+
+// less orders standings by wins and then by the tie breakers, falling back
+// to the order in which players reached their score
+func (f *FileSystemPlayerStore) less(headToHead bool) func(a, b *standing) bool {
+	return func(a, b *standing) bool {
+		if a.wins != b.wins {
+			return a.wins > b.wins
+		}
+		for _, rule := range f.tieBreakers {
+			switch rule {
+			case gs.EarliestToScore:
+				if a.tick != b.tick {
+					return a.tick < b.tick
+				}
+			case gs.Alphabetical:
+				if a.name != b.name {
+					return a.name < b.name
+				}
+			case gs.HeadToHead:
+				if headToHead {
+					if diff := f.headToHead.HeadToHead(a.name, b.name); diff != 0 {
+						return diff > 0
+					}
+				}
+			}
+		}
+		return a.tick < b.tick
+	}
+}
+
+func (f *FileSystemPlayerStore) usesHeadToHead() bool {
+	if f.headToHead == nil {
+		return false
+	}
+	for _, rule := range f.tieBreakers {
+		if rule == gs.HeadToHead {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FileSystemPlayerStore) addLevel(wins int) {
+	f.levelCount[wins]++
+	if f.levelCount[wins] == 1 {
+		level := &standing{wins: wins}
+		f.levelOf[wins] = level
+		f.levels.insert(level)
+	}
+}
+
+func (f *FileSystemPlayerStore) removeLevel(wins int) {
+	f.levelCount[wins]--
+	if f.levelCount[wins] == 0 {
+		f.levels.remove(f.levelOf[wins])
+		delete(f.levelCount, wins)
+		delete(f.levelOf, wins)
+	}
+}
+
+// win adds a win recorded by a client at the given time, publishing its
+// events
+func (f *FileSystemPlayerStore) win(name string, at time.Time) {
+	leader := f.leader()
+	f.addWin(name)
+	f.bucketWin(name, at, 1)
+	if f.events == nil {
+		return
+	}
+
+	wins := f.players[name].wins
+	f.events.Publish(gs.Event{Type: gs.EventWinRecorded, At: at, Player: name, Wins: wins})
+	if leader != name && f.leader() == name {
+		f.events.Publish(gs.Event{Type: gs.EventNewLeader, At: at, Player: name, Wins: wins, PreviousLeader: leader})
+	}
+}
+
+// leader returns the first player of the standings, ignoring head to head
+// records
+func (f *FileSystemPlayerStore) leader() string {
+	if first := f.standings.at(0); first != nil {
+		return first.standing.name
+	}
+	return ""
+}
+
+func (f *FileSystemPlayerStore) addWin(name string) {
+	f.tick++
+
+	player, ok := f.players[name]
+	if ok {
+		f.standings.remove(player)
+		f.removeLevel(player.wins)
+		player.wins++
+		player.tick = f.tick
+	} else {
+		player = &standing{name: name, wins: 1, tick: f.tick}
+		f.players[name] = player
+	}
+	f.standings.insert(player)
+	f.addLevel(player.wins)
+}
+
+// save rewrites the whole file, dropping the deltas. Players are written
+// in league order, so ties keep their order when the file is read again.
+// Keys still remembered and the windowed wins are written along, hours
+// past the retention rolled into days
+func (f *FileSystemPlayerStore) save() error {
+	f.expireKeys(f.now())
+	f.hours.drop(f.hourlyCutoff())
+	if err := f.database.Encode(f.snapshot()); err != nil {
+		return err
+	}
+
+	info, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	f.size, f.envelope = info.Size(), info.Size()
+	return nil
+}
+
+// snapshot returns the whole database as it would be saved
+func (f *FileSystemPlayerStore) snapshot() gs.Database {
+	return gs.Database{
+		Version: gs.SchemaVersion,
+		Players: f.standings.slice(0, f.standings.length),
+		Keys:    f.keyOrder,
+		Buckets: f.hours.buckets(time.Time{}),
+		// days are only written where their hours are gone
+		DailyBuckets: f.days.buckets(f.hourlyCutoff()),
+	}
+}
+
+// appendDelta writes the deltas at once, or rewrites the file when the
+// deltas are due to be compacted
+func (f *FileSystemPlayerStore) appendDelta(ds ...gs.Delta) error {
+	if f.changes != nil {
+		f.changes.Wins(ds)
+	}
+
+	deltas := f.size - f.envelope
+	if deltas > minCompactSize && deltas > f.envelope {
+		return f.save()
+	}
+
+	var records []byte
+	for _, d := range ds {
+		record, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		records = append(append(records, record...), '\n')
+	}
+	n, err := f.deltas.Write(records)
+	f.size += int64(n)
+	return err
 }
 
 func initialisePlayerDBFile(file *os.File) error {
@@ -79,7 +556,7 @@ func initialisePlayerDBFile(file *os.File) error {
 	}
 
 	if info.Size() == 0 {
-		file.Write([]byte("[]"))
+		fmt.Fprintf(file, `{"version":%d,"players":[]}`, gs.SchemaVersion)
 		file.Seek(0, 0)
 	}
 	return nil
@@ -0,0 +1,201 @@
+package infsstore_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	. "github.com/windnow/edusrv/internal/helpers"
+	fs "github.com/windnow/edusrv/internal/infsstore"
+	"github.com/windnow/edusrv/internal/tape"
+)
+
+var benchmarkSizes = []int{10000, 100000, 1000000}
+
+func newBenchmarkLeague(size int) gs.League {
+	league := make(gs.League, size)
+	for i := range league {
+		league[i] = gs.Player{Name: fmt.Sprintf("player-%d", i), Wins: i % 100}
+	}
+	return league
+}
+
+func createBenchmarkDatabase(b *testing.B, size int) (*os.File, func()) {
+	b.Helper()
+	file, clean := CreateTempFile(b, "")
+	if err := json.NewEncoder(file).Encode(gs.Database{
+		Version: gs.SchemaVersion,
+		Players: newBenchmarkLeague(size),
+	}); err != nil {
+		clean()
+		b.Fatalf("could't write database %v", err)
+	}
+	return file, clean
+}
+
+// BenchmarkLoad compares decoding the whole file at once, as NewLeague used
+// to, with the streaming decoder
+func BenchmarkLoad(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		file, clean := createBenchmarkDatabase(b, size)
+
+		b.Run(fmt.Sprintf("decode/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				file.Seek(0, 0)
+				var db gs.Database
+				if err := json.NewDecoder(file).Decode(&db); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("stream/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				file.Seek(0, 0)
+				if _, err := gs.ReadDatabase(file); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		clean()
+	}
+}
+
+// BenchmarkRecordWin compares rewriting the whole league through Tape on
+// every win, as RecordWin used to, with appending a delta
+func BenchmarkRecordWin(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("rewrite/%d", size), func(b *testing.B) {
+			file, clean := createBenchmarkDatabase(b, size)
+			defer clean()
+
+			league := newBenchmarkLeague(size)
+			database := json.NewEncoder(&tape.Tape{File: file})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				league[i%size].Wins++
+				database.Encode(gs.Database{Version: gs.SchemaVersion, Players: league})
+			}
+		})
+
+		b.Run(fmt.Sprintf("delta/%d", size), func(b *testing.B) {
+			file, clean := createBenchmarkDatabase(b, size)
+			defer clean()
+
+			store, err := fs.NewFileSystemPlayerStore(file)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				store.RecordWin(fmt.Sprintf("player-%d", i%size))
+			}
+		})
+	}
+}
+
+// BenchmarkGetPlayerScore compares the linear League.Find the store used to
+// do with the name index
+func BenchmarkGetPlayerScore(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		league := newBenchmarkLeague(size)
+
+		b.Run(fmt.Sprintf("linear/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				league.Find(benchmarkName(i, size))
+			}
+		})
+
+		b.Run(fmt.Sprintf("indexed/%d", size), func(b *testing.B) {
+			store := newBenchmarkStore(b, league)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				store.GetPlayerScore(benchmarkName(i, size))
+			}
+		})
+	}
+}
+
+// BenchmarkTop compares sorting the league on every call, as GetLeague used
+// to, with reading the ordered standings
+func BenchmarkTop(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		league := newBenchmarkLeague(size)
+
+		b.Run(fmt.Sprintf("sort/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				league[i%size].Wins++
+				sort.Slice(league, func(i, j int) bool {
+					return league[i].Wins > league[j].Wins
+				})
+				_ = league[:10]
+			}
+		})
+
+		b.Run(fmt.Sprintf("indexed/%d", size), func(b *testing.B) {
+			store := newBenchmarkStore(b, league)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				store.RecordWin(benchmarkName(i, size))
+				store.Top(10)
+			}
+		})
+	}
+}
+
+// BenchmarkRank compares finding a player's position in the sorted league
+// with the indexed standings
+func BenchmarkRank(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		league := newBenchmarkLeague(size)
+
+		b.Run(fmt.Sprintf("linear/%d", size), func(b *testing.B) {
+			sort.Slice(league, func(i, j int) bool {
+				return league[i].Wins > league[j].Wins
+			})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				name := benchmarkName(i, size)
+				for pos := range league {
+					if league[pos].Name == name {
+						break
+					}
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("indexed/%d", size), func(b *testing.B) {
+			store := newBenchmarkStore(b, league)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				store.GetPlayerRank(benchmarkName(i, size), gs.CompetitionRank)
+			}
+		})
+	}
+}
+
+func newBenchmarkStore(b *testing.B, league gs.League) *fs.FileSystemPlayerStore {
+	b.Helper()
+	file, clean := CreateTempFile(b, "")
+	b.Cleanup(clean)
+
+	store, err := fs.NewFileSystemPlayerStore(file)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := store.ReplaceLeague(league); err != nil {
+		b.Fatal(err)
+	}
+	return store
+}
+
+// benchmarkName spreads lookups over the whole league
+func benchmarkName(i, size int) string {
+	return fmt.Sprintf("player-%d", (i*7919)%size)
+}
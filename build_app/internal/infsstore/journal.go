@@ -0,0 +1,193 @@
+package infsstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+)
+
+const (
+	opWin     = "win"
+	opReplace = "replace"
+)
+
+// journalEntry is a single change of the league. Entries are numbered so a
+// snapshot can tell which of them it already contains
+type journalEntry struct {
+	Seq     uint64    `json:"seq"`
+	At      time.Time `json:"at"`
+	Op      string    `json:"op"`
+	Name    string    `json:"name,omitempty"`
+	Key     string    `json:"key,omitempty"`
+	Players gs.League `json:"players,omitempty"`
+}
+
+// journal is an append-only log of league changes kept by the backup
+// subsystem to replay changes made after the latest snapshot
+type journal struct {
+	name string
+	file *os.File
+	enc  *json.Encoder
+	seq  uint64
+	now  func() time.Time
+}
+
+// openJournal drops an entry torn by a crash at the end of the journal
+func openJournal(name string, now func() time.Time) (*journal, error) {
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("problem opening journal %s, %v", name, err)
+	}
+
+	var seq uint64
+	offset, err := readJournal(file, func(e journalEntry) error {
+		seq = e.Seq
+		return nil
+	})
+	if err == nil {
+		err = file.Truncate(offset)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &journal{name: name, file: file, enc: json.NewEncoder(file), seq: seq, now: now}, nil
+}
+
+// append writes the entry, a nil journal ignores it
+func (j *journal) append(e journalEntry) error {
+	if j == nil {
+		return nil
+	}
+	j.seq++
+	e.Seq = j.seq
+	e.At = j.now().UTC()
+	return j.enc.Encode(e)
+}
+
+func (j *journal) close() error {
+	return j.file.Close()
+}
+
+// compact drops the entries up to seq, except the last one which keeps the
+// numbering across restarts. The entries are copied without holding lock,
+// then lock is held to copy the ones appended meanwhile and swap the files
+func (j *journal) compact(seq uint64, lock sync.Locker) error {
+	src, err := os.Open(j.name)
+	if err != nil {
+		return fmt.Errorf("problem opening journal %s, %v", j.name, err)
+	}
+	defer src.Close()
+
+	tmp, err := os.Create(j.name + ".tmp")
+	if err != nil {
+		return fmt.Errorf("problem creating journal, %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	var skipped *journalEntry
+	offset, err := readJournal(src, func(e journalEntry) error {
+		if e.Seq <= seq {
+			skipped = &e
+			return nil
+		}
+		skipped = nil
+		return enc.Encode(e)
+	})
+	if err == nil && skipped != nil {
+		err = enc.Encode(skipped)
+	}
+	if err != nil {
+		return fmt.Errorf("problem compacting journal, %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return fmt.Errorf("problem compacting journal, %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), j.name); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(j.name, os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("problem reopening journal %s, %v", j.name, err)
+	}
+	j.file.Close()
+	j.file, j.enc = file, json.NewEncoder(file)
+	return nil
+}
+
+// readJournal passes the entries of r to fn and returns the offset after the
+// last one. A last entry torn by a crash is ignored
+func readJournal(r io.Reader, fn func(journalEntry) error) (int64, error) {
+	reader := bufio.NewReader(r)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// a line without its newline was torn
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+
+		var e journalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			if _, peek := reader.Peek(1); peek == io.EOF {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("problem parsing journal entry, %v", err)
+		}
+		if err := fn(e); err != nil {
+			return offset, err
+		}
+		offset += int64(len(line))
+	}
+}
+
+func (e journalEntry) apply(league gs.League) gs.League {
+	switch e.Op {
+	case opWin:
+		if player := league.Find(e.Name); player != nil {
+			player.Wins++
+		} else {
+			league = append(league, gs.Player{Name: e.Name, Wins: 1})
+		}
+	case opReplace:
+		league = append(gs.League{}, e.Players...)
+	}
+	return league
+}
+
+// applyKey remembers the idempotency key of a win
+func (e journalEntry) applyKey(keys []gs.IdempotencyKey) []gs.IdempotencyKey {
+	if e.Op != opWin || e.Key == "" {
+		return keys
+	}
+	return append(keys, gs.IdempotencyKey{Key: e.Key, Name: e.Name, At: e.At})
+}
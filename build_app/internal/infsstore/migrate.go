@@ -0,0 +1,131 @@
+package infsstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+)
+
+// migrations[v] upgrades a database from version v to v+1
+var migrations = []func(db *gs.Database) error{
+	// 0: bare array of players, only needs the envelope
+	func(db *gs.Database) error { return nil },
+	// 1: deltas may follow the envelope, which version 1 readers can't parse
+	func(db *gs.Database) error { return nil },
+}
+
+// BackupName names the copy of a database file kept before migrating it from version
+func BackupName(fileName string, version int) string {
+	return fmt.Sprintf("%s.v%d.bak", fileName, version)
+}
+
+// loadDatabase reads the envelope from file. When the file was written with
+// an older schema the envelope is upgraded and the original content is kept
+// next to the file, see BackupName; the caller must then rewrite the file.
+// It also returns the size of the envelope, the rest of the file are deltas
+func loadDatabase(file *os.File, limits gs.Limits) (db gs.Database, envelope int64, migrated bool, err error) {
+	file.Seek(0, 0)
+	dec := json.NewDecoder(file)
+	db, err = gs.DecodeDatabase(dec, limits)
+	if err != nil {
+		return
+	}
+	envelope = dec.InputOffset()
+
+	if db.Version > gs.SchemaVersion {
+		err = fmt.Errorf("%w: version %d, supported %d", gs.ErrNewerSchema, db.Version, gs.SchemaVersion)
+		return
+	}
+	if db.Version == gs.SchemaVersion {
+		return
+	}
+
+	if err = backupFile(file, BackupName(file.Name(), db.Version)); err != nil {
+		err = fmt.Errorf("problem backing up %s, %v", file.Name(), err)
+		return
+	}
+	for ; db.Version < gs.SchemaVersion; db.Version++ {
+		if err = migrations[db.Version](&db); err != nil {
+			err = fmt.Errorf("problem migrating from version %d, %v", db.Version, err)
+			return
+		}
+	}
+	migrated = true
+	return
+}
+
+// replayDeltas passes the deltas following the envelope to apply
+func replayDeltas(file *os.File, envelope int64, apply func(gs.Delta) error) error {
+	file.Seek(envelope, 0)
+
+	offset, err := gs.DecodeDeltas(json.NewDecoder(file), apply)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		// the last delta was torn by a crash while appending it
+		err = file.Truncate(envelope + offset)
+	}
+	return err
+}
+
+// backupFile copies file to name. When a backup with other contents already
+// has the name, the copy is named after it with a .1, .2... suffix. A
+// backup with the same contents is reused, as left by a crash before the
+// migrated file was written
+func backupFile(file *os.File, name string) error {
+	sum, err := fileHash(file)
+	if err != nil {
+		return err
+	}
+
+	for n := 0; ; n++ {
+		candidate := name
+		if n > 0 {
+			candidate = fmt.Sprintf("%s.%d", name, n)
+		}
+
+		backup, err := os.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if errors.Is(err, os.ErrExist) {
+			existing, err := os.Open(candidate)
+			if err != nil {
+				return err
+			}
+			same, err := fileHash(existing)
+			existing.Close()
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(same, sum) {
+				return nil
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		file.Seek(0, 0)
+		if _, err := io.Copy(backup, file); err != nil {
+			backup.Close()
+			return err
+		}
+		if err := backup.Sync(); err != nil {
+			backup.Close()
+			return err
+		}
+		return backup.Close()
+	}
+}
+
+func fileHash(file *os.File) ([]byte, error) {
+	file.Seek(0, 0)
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,80 @@
+package infsstore
+
+import (
+	"fmt"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+)
+
+// WithChangeLog passes the changes of the store to log, so they can be
+// shipped to replicas
+func WithChangeLog(log gs.ChangeLog) Option {
+	return func(f *FileSystemPlayerStore) {
+		f.changes = log
+	}
+}
+
+// Snapshot calls fn with the whole database while no change can be made.
+// The database must not be used once fn returns
+func (f *FileSystemPlayerStore) Snapshot(fn func(db gs.Database)) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	fn(f.snapshot())
+}
+
+// Restore replaces the whole database, idempotency keys and windowed wins
+// included, with one taken by Snapshot
+func (f *FileSystemPlayerStore) Restore(db gs.Database) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.reset(db.Players)
+	f.keys, f.keyOrder = nil, nil
+	for _, k := range db.Keys {
+		f.rememberKey(k)
+	}
+	f.hours, f.days = newWinBuckets(hourBucket), newWinBuckets(dayBucket)
+	f.loadBuckets(db)
+	if f.changes != nil {
+		f.changes.Reset()
+	}
+
+	if err := f.save(); err != nil {
+		f.writeErrors++
+		f.logger.Error("problem persisting restored database", "file", f.file.Name(), "error", err)
+		return fmt.Errorf("problem writing database, %v", err)
+	}
+	if err := f.journal.append(journalEntry{Op: opReplace, Players: db.Players}); err != nil {
+		f.logger.Error("problem journaling league", "error", err)
+	}
+	return nil
+}
+
+// Apply records wins replicated from another store, with the time and the
+// key they were recorded with. No events are published, the store the wins
+// were recorded by did
+func (f *FileSystemPlayerStore) Apply(ds []gs.Delta) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, d := range ds {
+		f.addWin(d.Win)
+		if d.At != nil {
+			f.bucketWin(d.Win, *d.At, 1)
+		}
+		if d.Key != "" && d.At != nil {
+			f.rememberKey(gs.IdempotencyKey{Key: d.Key, Name: d.Win, At: *d.At})
+		}
+	}
+	f.expireKeys(f.now())
+
+	if err := f.appendDelta(ds...); err != nil {
+		f.writeErrors++
+		f.logger.Error("problem persisting replicated wins", "wins", len(ds), "file", f.file.Name(), "error", err)
+	}
+	for _, d := range ds {
+		if err := f.journal.append(journalEntry{Op: opWin, Name: d.Win, Key: d.Key}); err != nil {
+			f.logger.Error("problem journaling win", "player", d.Win, "error", err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package infsstore
+
+import (
+	"math/rand"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+)
+
+const skipListMaxLevel = 32
+
+// standing is a player as kept by the store. tick tells when the player
+// reached the current number of wins and keeps the order of ties stable
+type standing struct {
+	name string
+	wins int
+	tick uint64
+}
+
+func (s *standing) player() gs.Player {
+	return gs.Player{Name: s.name, Wins: s.wins}
+}
+
+// byWins orders standings by wins only
+func byWins(a, b *standing) bool {
+	return a.wins > b.wins
+}
+
+type skipLink struct {
+	node *skipNode
+	// span is the number of positions the link skips
+	span int
+}
+
+type skipNode struct {
+	standing *standing
+	next     []skipLink
+}
+
+// skipList keeps standings ordered and answers positional queries in
+// O(log n), see https://en.wikipedia.org/wiki/Skip_list#Indexable_skiplist
+type skipList struct {
+	head   *skipNode
+	level  int
+	length int
+	rnd    *rand.Rand
+	// less must order standings with more wins first and never report
+	// two different standings as equal
+	less func(a, b *standing) bool
+}
+
+func newSkipList(less func(a, b *standing) bool) *skipList {
+	return &skipList{
+		head:  &skipNode{next: make([]skipLink, skipListMaxLevel)},
+		level: 1,
+		rnd:   rand.New(rand.NewSource(1)),
+		less:  less,
+	}
+}
+
+func (l *skipList) randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && l.rnd.Intn(4) == 0 {
+		level++
+	}
+	return level
+}
+
+// insert adds s, which must not be in the list already
+func (l *skipList) insert(s *standing) {
+	var update [skipListMaxLevel]*skipNode
+	var rank [skipListMaxLevel]int
+
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		if i < l.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.next[i].node != nil && l.less(x.next[i].node.standing, s) {
+			rank[i] += x.next[i].span
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+
+	level := l.randomLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			update[i] = l.head
+			update[i].next[i].span = l.length
+		}
+		l.level = level
+	}
+
+	node := &skipNode{standing: s, next: make([]skipLink, level)}
+	for i := 0; i < level; i++ {
+		node.next[i].node = update[i].next[i].node
+		update[i].next[i].node = node
+
+		node.next[i].span = update[i].next[i].span - (rank[0] - rank[i])
+		update[i].next[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < l.level; i++ {
+		update[i].next[i].span++
+	}
+	l.length++
+}
+
+// remove deletes s, which must be in the list with its ordering fields
+// unchanged since it was inserted
+func (l *skipList) remove(s *standing) {
+	var update [skipListMaxLevel]*skipNode
+
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && l.less(x.next[i].node.standing, s) {
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+
+	x = x.next[0].node
+	if x == nil || x.standing != s {
+		return
+	}
+
+	for i := 0; i < l.level; i++ {
+		if update[i].next[i].node == x {
+			update[i].next[i].span += x.next[i].span - 1
+			update[i].next[i].node = x.next[i].node
+		} else {
+			update[i].next[i].span--
+		}
+	}
+	for l.level > 1 && l.head.next[l.level-1].node == nil {
+		l.level--
+	}
+	l.length--
+}
+
+// position returns the zero based position of s, which must be in the list
+func (l *skipList) position(s *standing) int {
+	rank := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && (l.less(x.next[i].node.standing, s) || x.next[i].node.standing == s) {
+			rank += x.next[i].span
+			x = x.next[i].node
+		}
+		if x.standing == s {
+			return rank - 1
+		}
+	}
+	return -1
+}
+
+// countBefore returns the number of standings ordered before those with the
+// given wins, that is the number of standings with more wins
+func (l *skipList) countBefore(wins int) int {
+	rank := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && x.next[i].node.standing.wins > wins {
+			rank += x.next[i].span
+			x = x.next[i].node
+		}
+	}
+	return rank
+}
+
+// at returns the node at the zero based position
+func (l *skipList) at(pos int) *skipNode {
+	if pos < 0 || pos >= l.length {
+		return nil
+	}
+	traversed := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && traversed+x.next[i].span <= pos+1 {
+			traversed += x.next[i].span
+			x = x.next[i].node
+		}
+		if traversed == pos+1 {
+			return x
+		}
+	}
+	return nil
+}
+
+// slice returns up to n standings starting at the zero based position
+func (l *skipList) slice(from, n int) gs.League {
+	players := gs.League{}
+	for x := l.at(from); x != nil && len(players) < n; x = x.next[0].node {
+		players = append(players, x.standing.player())
+	}
+	return players
+}
+
+// all returns the standings in order
+func (l *skipList) all() []*standing {
+	standings := make([]*standing, 0, l.length)
+	for x := l.head.next[0].node; x != nil; x = x.next[0].node {
+		standings = append(standings, x.standing)
+	}
+	return standings
+}
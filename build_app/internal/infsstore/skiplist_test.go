@@ -0,0 +1,63 @@
+package infsstore
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSkipList(t *testing.T) {
+	before := func(a, b *standing) bool {
+		if a.wins != b.wins {
+			return a.wins > b.wins
+		}
+		return a.tick < b.tick
+	}
+	list := newSkipList(before)
+	players := make(map[string]*standing)
+	rnd := rand.New(rand.NewSource(42))
+	names := []string{"Cleo", "Chris", "Tiest", "Pepper", "Floyd", "Apollo", "Alice", "Bob"}
+
+	var tick uint64
+	for i := 0; i < 2000; i++ {
+		tick++
+		name := names[rnd.Intn(len(names))]
+		if s, ok := players[name]; ok {
+			list.remove(s)
+			s.wins++
+			s.tick = tick
+			list.insert(s)
+		} else {
+			s = &standing{name: name, wins: 1, tick: tick}
+			players[name] = s
+			list.insert(s)
+		}
+
+		var want []*standing
+		for _, s := range players {
+			want = append(want, s)
+		}
+		sort.Slice(want, func(i, j int) bool { return before(want[i], want[j]) })
+
+		if list.length != len(want) {
+			t.Fatalf("got length %d, want %d", list.length, len(want))
+		}
+		for pos, s := range want {
+			if got := list.position(s); got != pos {
+				t.Fatalf("got position %d of %s, want %d", got, s.name, pos)
+			}
+			if got := list.at(pos).standing; got != s {
+				t.Fatalf("got %s at %d, want %s", got.name, pos, s.name)
+			}
+			better := 0
+			for _, o := range want {
+				if o.wins > s.wins {
+					better++
+				}
+			}
+			if got := list.countBefore(s.wins); got != better {
+				t.Fatalf("got %d players with more than %d wins, want %d", got, s.wins, better)
+			}
+		}
+	}
+}
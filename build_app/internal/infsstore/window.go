@@ -0,0 +1,165 @@
+package infsstore
+
+import (
+	"sort"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+)
+
+// Resolutions windowed leagues are answered at. Hourly buckets are kept in
+// the file for the hourly retention, daily ones are summed from them while
+// loading. Older hours are rolled into daily buckets kept in the file
+const (
+	hourBucket = time.Hour
+	dayBucket  = 24 * time.Hour
+
+	defaultHourlyRetention = 7 * dayBucket
+)
+
+// WithHourlyRetention sets how long wins are kept per hour, a week by
+// default. Windowed leagues older than that are answered in whole days
+func WithHourlyRetention(retention time.Duration) Option {
+	return func(f *FileSystemPlayerStore) {
+		f.hourlyRetention = retention
+	}
+}
+
+// winBuckets sums the wins of players per period of size, periods are
+// aligned to UTC and ordered by start
+type winBuckets struct {
+	size   time.Duration
+	starts []time.Time
+	wins   []map[string]int
+}
+
+func newWinBuckets(size time.Duration) *winBuckets {
+	return &winBuckets{size: size}
+}
+
+// search returns the index of the first bucket starting at or after t
+func (b *winBuckets) search(t time.Time) int {
+	return sort.Search(len(b.starts), func(i int) bool {
+		return !b.starts[i].Before(t)
+	})
+}
+
+func (b *winBuckets) add(name string, at time.Time, wins int) {
+	start := at.UTC().Truncate(b.size)
+	i := b.search(start)
+	if i == len(b.starts) || !b.starts[i].Equal(start) {
+		b.starts = append(b.starts, time.Time{})
+		b.wins = append(b.wins, nil)
+		copy(b.starts[i+1:], b.starts[i:])
+		copy(b.wins[i+1:], b.wins[i:])
+		b.starts[i], b.wins[i] = start, make(map[string]int)
+	}
+	b.wins[i][name] += wins
+}
+
+// sum adds the wins of the buckets starting from up to to into totals
+func (b *winBuckets) sum(from, to time.Time, totals map[string]int) {
+	for i := b.search(from); i < len(b.starts) && b.starts[i].Before(to); i++ {
+		for name, wins := range b.wins[i] {
+			totals[name] += wins
+		}
+	}
+}
+
+// drop forgets the buckets starting before t
+func (b *winBuckets) drop(t time.Time) {
+	i := b.search(t)
+	b.starts = append([]time.Time(nil), b.starts[i:]...)
+	b.wins = append([]map[string]int(nil), b.wins[i:]...)
+}
+
+// buckets returns the buckets starting before to, all of them when to is
+// zero
+func (b *winBuckets) buckets(to time.Time) []gs.WinBucket {
+	end := len(b.starts)
+	if !to.IsZero() {
+		end = b.search(to)
+	}
+	buckets := make([]gs.WinBucket, end)
+	for i := range buckets {
+		buckets[i] = gs.WinBucket{Start: b.starts[i], Wins: b.wins[i]}
+	}
+	return buckets
+}
+
+// bucketWin adds a win recorded at the given time to the windowed leagues
+func (f *FileSystemPlayerStore) bucketWin(name string, at time.Time, wins int) {
+	f.hours.add(name, at, wins)
+	f.days.add(name, at, wins)
+}
+
+// loadBuckets adds the windowed wins of a database, hourly and daily
+func (f *FileSystemPlayerStore) loadBuckets(db gs.Database) {
+	for _, b := range db.Buckets {
+		for name, wins := range b.Wins {
+			f.bucketWin(name, b.Start, wins)
+		}
+	}
+	for _, b := range db.DailyBuckets {
+		for name, wins := range b.Wins {
+			f.days.add(name, b.Start, wins)
+		}
+	}
+}
+
+// hourlyCutoff is the start of the first day whose wins are kept per hour
+func (f *FileSystemPlayerStore) hourlyCutoff() time.Time {
+	return f.now().UTC().Add(-f.hourlyRetention).Truncate(dayBucket)
+}
+
+// GetLeagueBetween returns the players ordered by the wins recorded from up
+// to to, widened to whole hours, or to whole days before the hourly
+// retention. Players tied on wins are ordered by name. Whole days are
+// summed from daily buckets, so a query reads at most two days of hourly
+// buckets. Wins recorded before the store kept their time are left out
+func (f *FileSystemPlayerStore) GetLeagueBetween(from, to time.Time) gs.League {
+	f.mu.RLock()
+	cutoff := f.hourlyCutoff()
+	from, to = widen(from, to, hourBucket)
+	if from.Before(cutoff) {
+		from = from.Truncate(dayBucket)
+	}
+	if end := to.Truncate(dayBucket); end.Before(to) && to.Before(cutoff) {
+		to = end.Add(dayBucket)
+	}
+
+	totals := make(map[string]int)
+	firstDay, lastDay := from.Truncate(dayBucket), to.Truncate(dayBucket)
+	if firstDay.Before(from) {
+		firstDay = firstDay.Add(dayBucket)
+	}
+	if firstDay.Before(lastDay) {
+		f.hours.sum(from, firstDay, totals)
+		f.days.sum(firstDay, lastDay, totals)
+		f.hours.sum(lastDay, to, totals)
+	} else {
+		f.hours.sum(from, to, totals)
+	}
+	f.mu.RUnlock()
+
+	league := make(gs.League, 0, len(totals))
+	for name, wins := range totals {
+		league = append(league, gs.Player{Name: name, Wins: wins})
+	}
+	sort.Slice(league, func(i, j int) bool {
+		if league[i].Wins != league[j].Wins {
+			return league[i].Wins > league[j].Wins
+		}
+		return league[i].Name < league[j].Name
+	})
+	return league
+}
+
+// widen aligns from and to to whole periods of size around them
+func widen(from, to time.Time, size time.Duration) (time.Time, time.Time) {
+	from = from.UTC().Truncate(size)
+	if end := to.UTC().Truncate(size); end.Before(to) {
+		to = end.Add(size)
+	}
+	return from, to.UTC()
+}
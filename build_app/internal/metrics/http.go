@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPMetrics counts requests and observes their latency
+type HTTPMetrics struct {
+	requests *CounterVec
+	latency  *HistogramVec
+}
+
+// NewHTTPMetrics registers the request metrics in reg
+func NewHTTPMetrics(reg *Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests: reg.NewCounterVec("http_requests_total",
+			"Number of HTTP requests by route, method and status.",
+			"route", "method", "status"),
+		latency: reg.NewHistogramVec("http_request_duration_seconds",
+			"Latency of HTTP requests by route and status.",
+			DefBuckets, "route", "status"),
+	}
+}
+
+// MuxRoute names requests by the pattern of mux they match, so metrics are
+// labelled by route rather than by raw path
+func MuxRoute(mux *http.ServeMux) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			return pattern
+		}
+		return "unmatched"
+	}
+}
+
+// Wrap instruments next, labelling requests with the name route gives
+// them, see MuxRoute
+func (m *HTTPMetrics) Wrap(next http.Handler, route func(r *http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		name, status := route(r), strconv.Itoa(rec.status)
+		m.requests.With(name, r.Method, status).Inc()
+		m.latency.With(name, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status = status
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the original writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,80 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/windnow/edusrv/internal/metrics"
+)
+
+func TestRegistry(t *testing.T) {
+	reg := metrics.NewRegistry()
+
+	requests := reg.NewCounterVec("requests_total", "Requests.", "path")
+	requests.With(`/a"b`).Inc()
+	requests.With("/").Add(2)
+
+	latency := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "op")
+	latency.With("get").Observe(0.05)
+	latency.With("get").Observe(0.5)
+	latency.With("get").Observe(3)
+
+	reg.NewGaugeFunc("players", "Players\nin league.", func() float64 { return 42 })
+
+	buf := &bytes.Buffer{}
+	_, err := reg.WriteTo(buf)
+	if err != nil {
+		t.Fatalf("didn't expect an error but got one, %v", err)
+	}
+
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{path="/"} 2
+requests_total{path="/a\"b"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="get",le="0.1"} 1
+latency_seconds_bucket{op="get",le="1"} 2
+latency_seconds_bucket{op="get",le="+Inf"} 3
+latency_seconds_sum{op="get"} 3.55
+latency_seconds_count{op="get"} 3
+# HELP players Players\nin league.
+# TYPE players gauge
+players 42
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf, want)
+	}
+}
+
+func TestHTTPMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/things/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := metrics.NewHTTPMetrics(reg).Wrap(mux, metrics.MuxRoute(mux))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/things/1", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/things/2", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nothing", nil))
+
+	response := httptest.NewRecorder()
+	reg.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if got := response.Header().Get("content-type"); got != metrics.ContentType {
+		t.Errorf("got content-type %q, want %q", got, metrics.ContentType)
+	}
+	for _, line := range []string{
+		`http_requests_total{route="/things/",method="GET",status="418"} 2`,
+		`http_requests_total{route="unmatched",method="GET",status="404"} 1`,
+		`http_request_duration_seconds_count{route="/things/",status="418"} 2`,
+	} {
+		if !strings.Contains(response.Body.String(), line+"\n") {
+			t.Errorf("missing %q in\n%s", line, response.Body)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/windnow/edusrv/internal/metrics"
+)
+
+// HTTPTransport sends requests to peers identified by their base URL
+type HTTPTransport struct {
+	Client *http.Client
+	// Token is sent as a bearer token when set
+	Token string
+}
+
+// RequestVote posts to /raft/vote
+func (t *HTTPTransport) RequestVote(ctx context.Context, peer string, req VoteRequest) (VoteResponse, error) {
+	var resp VoteResponse
+	err := t.post(ctx, peer, "/raft/vote", req, &resp)
+	return resp, err
+}
+
+// AppendEntries posts to /raft/append
+func (t *HTTPTransport) AppendEntries(ctx context.Context, peer string, req AppendRequest) (AppendResponse, error) {
+	var resp AppendResponse
+	err := t.post(ctx, peer, "/raft/append", req, &resp)
+	return resp, err
+}
+
+// InstallSnapshot posts to /raft/snapshot
+func (t *HTTPTransport) InstallSnapshot(ctx context.Context, peer string, req SnapshotRequest) (SnapshotResponse, error) {
+	var resp SnapshotResponse
+	err := t.post(ctx, peer, "/raft/snapshot", req, &resp)
+	return resp, err
+}
+
+// Propose posts to /raft/propose
+func (t *HTTPTransport) Propose(ctx context.Context, peer string, req ProposeRequest) (ProposeResponse, error) {
+	var resp ProposeResponse
+	err := t.post(ctx, peer, "/raft/propose", req, &resp)
+	return resp, err
+}
+
+func (t *HTTPTransport) post(ctx context.Context, peer, path string, body, v interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(peer, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg := new(bytes.Buffer)
+		msg.ReadFrom(res.Body)
+		return fmt.Errorf("%s returned %d, %s", path, res.StatusCode, strings.TrimSpace(msg.String()))
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("problem parsing response of %s, %v", path, err)
+	}
+	return nil
+}
+
+// HTTPHandler serves the requests of peers sent by HTTPTransport under
+// /raft/, and the Status of the node:
+//
+//	POST /raft/vote      a VoteRequest
+//	POST /raft/append    an AppendRequest
+//	POST /raft/snapshot  a SnapshotRequest
+//	POST /raft/propose   a ProposeRequest, answered once it is applied
+//	GET  /raft/status    a Status
+type HTTPHandler struct {
+	http.Handler
+	route func(r *http.Request) string
+	node  *Node
+	token string
+}
+
+// NewHTTPHandler serves the node, requiring token from peers when set
+func NewHTTPHandler(node *Node, token string) *HTTPHandler {
+	h := &HTTPHandler{node: node, token: token}
+
+	router := http.NewServeMux()
+	router.Handle("/raft/vote", h.rpc(func(r *http.Request) (interface{}, error) {
+		var req VoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+		return node.HandleVote(req), nil
+	}))
+	router.Handle("/raft/append", h.rpc(func(r *http.Request) (interface{}, error) {
+		var req AppendRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+		return node.HandleAppend(req), nil
+	}))
+	router.Handle("/raft/snapshot", h.rpc(func(r *http.Request) (interface{}, error) {
+		var req SnapshotRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+		return node.HandleSnapshot(req), nil
+	}))
+	router.Handle("/raft/propose", h.rpc(func(r *http.Request) (interface{}, error) {
+		var req ProposeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+		return node.HandlePropose(r.Context(), req)
+	}))
+	router.HandleFunc("/raft/status", h.statusHandler)
+	h.Handler = router
+	h.route = metrics.MuxRoute(router)
+	return h
+}
+
+// Route names the route serving a request, see metrics.MuxRoute
+func (h *HTTPHandler) Route(r *http.Request) string {
+	return h.route(r)
+}
+
+func (h *HTTPHandler) rpc(handle func(r *http.Request) (interface{}, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if h.token != "" && r.Header.Get("Authorization") != "Bearer "+h.token {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		resp, err := handle(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+func (h *HTTPHandler) statusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.node.Status())
+}
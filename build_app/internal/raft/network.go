@@ -0,0 +1,136 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrUnreachable is returned by the transports of a Network when the peer
+// is down or partitioned away
+var ErrUnreachable = errors.New("peer is unreachable")
+
+// Network connects nodes running in one process, requests between nodes
+// can be cut to simulate partitions
+type Network struct {
+	mu       sync.Mutex
+	handlers map[string]Handler
+	// group of every node, nodes only reach nodes of their group
+	groups map[string]int
+}
+
+// NewNetwork returns a network without nodes
+func NewNetwork() *Network {
+	return &Network{handlers: make(map[string]Handler), groups: make(map[string]int)}
+}
+
+// Transport returns the transport of the node with id
+func (n *Network) Transport(id string) Transport {
+	return &networkTransport{network: n, from: id}
+}
+
+// Connect routes the requests sent to id to h
+func (n *Network) Connect(id string, h Handler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handlers[id] = h
+}
+
+// Disconnect makes the node with id unreachable, as if it crashed
+func (n *Network) Disconnect(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.handlers, id)
+}
+
+// Partition splits the nodes in groups that can't reach each other, nodes
+// left out of the groups form one more group
+func (n *Network) Partition(groups ...[]string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.groups = make(map[string]int)
+	for i, group := range groups {
+		for _, id := range group {
+			n.groups[id] = i + 1
+		}
+	}
+}
+
+// Heal joins the partitions back
+func (n *Network) Heal() {
+	n.Partition()
+}
+
+// route returns the handler of to, unless it can't be reached from from
+func (n *Network) route(from, to string) (Handler, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	h, ok := n.handlers[to]
+	if !ok || n.groups[from] != n.groups[to] {
+		return nil, ErrUnreachable
+	}
+	if _, ok := n.handlers[from]; !ok {
+		return nil, ErrUnreachable
+	}
+	return h, nil
+}
+
+type networkTransport struct {
+	network *Network
+	from    string
+}
+
+// call sends a request, the response is lost when the network changed
+// while it was handled
+func (t *networkTransport) call(ctx context.Context, peer string, handle func(h Handler) error) error {
+	h, err := t.network.route(t.from, peer)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := handle(h); err != nil {
+		return err
+	}
+	_, err = t.network.route(peer, t.from)
+	return err
+}
+
+func (t *networkTransport) RequestVote(ctx context.Context, peer string, req VoteRequest) (VoteResponse, error) {
+	var resp VoteResponse
+	err := t.call(ctx, peer, func(h Handler) error {
+		resp = h.HandleVote(req)
+		return nil
+	})
+	return resp, err
+}
+
+func (t *networkTransport) AppendEntries(ctx context.Context, peer string, req AppendRequest) (AppendResponse, error) {
+	req.Entries = append([]Entry(nil), req.Entries...)
+	var resp AppendResponse
+	err := t.call(ctx, peer, func(h Handler) error {
+		resp = h.HandleAppend(req)
+		return nil
+	})
+	return resp, err
+}
+
+func (t *networkTransport) InstallSnapshot(ctx context.Context, peer string, req SnapshotRequest) (SnapshotResponse, error) {
+	var resp SnapshotResponse
+	err := t.call(ctx, peer, func(h Handler) error {
+		resp = h.HandleSnapshot(req)
+		return nil
+	})
+	return resp, err
+}
+
+func (t *networkTransport) Propose(ctx context.Context, peer string, req ProposeRequest) (ProposeResponse, error) {
+	var resp ProposeResponse
+	err := t.call(ctx, peer, func(h Handler) error {
+		var err error
+		resp, err = h.HandlePropose(ctx, req)
+		return err
+	})
+	return resp, err
+}
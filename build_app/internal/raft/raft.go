@@ -0,0 +1,814 @@
+// Package raft is a minimal implementation of the Raft consensus algorithm:
+// leader election, log replication and log compaction with snapshots, over
+// a fixed set of nodes. Followers forward proposals to the leader.
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultElectionTimeout   = 300 * time.Millisecond
+	defaultHeartbeatInterval = 50 * time.Millisecond
+	defaultSnapshotThreshold = 1000
+	maxEntriesPerAppend      = 256
+)
+
+var (
+	// ErrNoLeader is returned by Propose while no leader is known
+	ErrNoLeader = errors.New("no known leader")
+	// ErrLeadershipLost is returned by Propose when the entry was replaced
+	// by the one of another leader
+	ErrLeadershipLost = errors.New("leadership lost before the entry was committed")
+	// ErrClosed is returned by Propose once the node is closed
+	ErrClosed = errors.New("node is closed")
+)
+
+// Role of a node in its term
+type Role string
+
+// Roles of nodes
+const (
+	Follower  Role = "follower"
+	Candidate Role = "candidate"
+	Leader    Role = "leader"
+)
+
+// StateMachine is what the log is applied to. Its methods are called one at
+// a time
+type StateMachine interface {
+	Apply(command []byte)
+	// Snapshot returns the state with every command applied so far
+	Snapshot() ([]byte, error)
+	// Restore replaces the state with a snapshot
+	Restore(data []byte) error
+}
+
+// Entry of the log, entries without a command are appended by leaders when
+// they are elected
+type Entry struct {
+	Index   uint64 `json:"index"`
+	Term    uint64 `json:"term"`
+	Command []byte `json:"command,omitempty"`
+}
+
+// Snapshot is the state machine with the entries up to Index applied
+type Snapshot struct {
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+	Data  []byte `json:"data,omitempty"`
+}
+
+// Config configures a Node
+type Config struct {
+	// ID is how peers reach the node
+	ID string
+	// Peers are the IDs of the other nodes of the cluster
+	Peers        []string
+	StateMachine StateMachine
+	Transport    Transport
+	// Storage keeps the state of the node, in memory by default
+	Storage Storage
+	// ElectionTimeout is the least time without a leader before an
+	// election, elections start after up to twice as much
+	ElectionTimeout   time.Duration
+	HeartbeatInterval time.Duration
+	// SnapshotThreshold is the number of applied entries the log is
+	// compacted after
+	SnapshotThreshold int
+	Logger            *slog.Logger
+}
+
+// Status of a node
+type Status struct {
+	ID          string `json:"id"`
+	Role        Role   `json:"role"`
+	Term        uint64 `json:"term"`
+	Leader      string `json:"leader,omitempty"`
+	CommitIndex uint64 `json:"commit_index"`
+	LastApplied uint64 `json:"last_applied"`
+	Snapshot    uint64 `json:"snapshot"`
+}
+
+// waiter is told once the entry at its index is applied, the entry must
+// have its term unless the term is 0
+type waiter struct {
+	term uint64
+	done chan error
+}
+
+// Node is a member of a Raft cluster
+type Node struct {
+	config Config
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	role     Role
+	term     uint64
+	votedFor string
+	leader   string
+	// log starts with the last entry of the snapshot, without its command
+	log         []Entry
+	snapshot    Snapshot
+	commitIndex uint64
+	lastApplied uint64
+	deadline    time.Time
+	rnd         *rand.Rand
+
+	nextIndex   map[string]uint64
+	matchIndex  map[string]uint64
+	lastContact map[string]time.Time
+	triggers    map[string]chan struct{}
+	waiters     map[uint64][]waiter
+
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewNode restores the node from its storage and starts it as a follower
+func NewNode(config Config) (*Node, error) {
+	if config.ElectionTimeout == 0 {
+		config.ElectionTimeout = defaultElectionTimeout
+	}
+	if config.HeartbeatInterval == 0 {
+		config.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if config.SnapshotThreshold == 0 {
+		config.SnapshotThreshold = defaultSnapshotThreshold
+	}
+	if config.Storage == nil {
+		config.Storage = NewMemoryStorage()
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	state, snapshot, entries, err := config.Storage.Load()
+	if err != nil {
+		return nil, fmt.Errorf("problem loading raft state, %v", err)
+	}
+	if snapshot.Index > 0 {
+		if err := config.StateMachine.Restore(snapshot.Data); err != nil {
+			return nil, fmt.Errorf("problem restoring snapshot, %v", err)
+		}
+	}
+
+	n := &Node{
+		config:      config,
+		logger:      config.Logger.With("raft", config.ID),
+		role:        Follower,
+		term:        state.Term,
+		votedFor:    state.VotedFor,
+		log:         append([]Entry{{Index: snapshot.Index, Term: snapshot.Term}}, entries...),
+		snapshot:    snapshot,
+		commitIndex: snapshot.Index,
+		lastApplied: snapshot.Index,
+		rnd:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		nextIndex:   make(map[string]uint64),
+		matchIndex:  make(map[string]uint64),
+		lastContact: make(map[string]time.Time),
+		triggers:    make(map[string]chan struct{}),
+		waiters:     make(map[uint64][]waiter),
+		done:        make(chan struct{}),
+	}
+	n.resetDeadline()
+	for _, peer := range config.Peers {
+		n.triggers[peer] = make(chan struct{}, 1)
+	}
+
+	n.wg.Add(1)
+	go n.ticker()
+	for _, peer := range config.Peers {
+		n.wg.Add(1)
+		go n.replicator(peer)
+	}
+	return n, nil
+}
+
+// ID of the node
+func (n *Node) ID() string {
+	return n.config.ID
+}
+
+// Leader returns the ID of the leader of the current term, empty while it
+// isn't known
+func (n *Node) Leader() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leader
+}
+
+// Status describes the node
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return Status{
+		ID:          n.config.ID,
+		Role:        n.role,
+		Term:        n.term,
+		Leader:      n.leader,
+		CommitIndex: n.commitIndex,
+		LastApplied: n.lastApplied,
+		Snapshot:    n.snapshot.Index,
+	}
+}
+
+// Propose appends command to the log and returns once it is applied to the
+// state machine of the node. Followers forward the command to the leader
+func (n *Node) Propose(ctx context.Context, command []byte) error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return ErrClosed
+	}
+	if n.role != Leader {
+		leader := n.leader
+		n.mu.Unlock()
+		if leader == "" {
+			return ErrNoLeader
+		}
+		resp, err := n.config.Transport.Propose(ctx, leader, ProposeRequest{Command: command})
+		if err != nil {
+			return fmt.Errorf("problem forwarding to %s, %v", leader, err)
+		}
+		return n.wait(ctx, resp.Index)
+	}
+
+	_, done, err := n.append(command)
+	n.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return await(ctx, done)
+}
+
+// append adds the command to the log of the leader, the caller holds the lock.
+// The entry is applied once done is told
+func (n *Node) append(command []byte) (uint64, chan error, error) {
+	e := Entry{Index: n.lastIndex() + 1, Term: n.term, Command: command}
+	if err := n.config.Storage.Append([]Entry{e}); err != nil {
+		return 0, nil, fmt.Errorf("problem persisting entry, %v", err)
+	}
+	n.log = append(n.log, e)
+	done := make(chan error, 1)
+	n.waiters[e.Index] = append(n.waiters[e.Index], waiter{term: e.Term, done: done})
+	n.triggerAll()
+	n.advanceCommit()
+	return e.Index, done, nil
+}
+
+// wait returns once the committed entry at index is applied
+func (n *Node) wait(ctx context.Context, index uint64) error {
+	n.mu.Lock()
+	if n.lastApplied >= index {
+		n.mu.Unlock()
+		return nil
+	}
+	done := make(chan error, 1)
+	n.waiters[index] = append(n.waiters[index], waiter{done: done})
+	n.mu.Unlock()
+	return await(ctx, done)
+}
+
+func await(ctx context.Context, done chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops the node, it no longer takes part in the cluster
+func (n *Node) Close() {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return
+	}
+	n.closed = true
+	close(n.done)
+	for index, ws := range n.waiters {
+		for _, w := range ws {
+			w.done <- ErrClosed
+		}
+		delete(n.waiters, index)
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+}
+
+// HandleVote answers a candidate asking for the vote of the node
+func (n *Node) HandleVote(req VoteRequest) VoteResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term > n.term {
+		n.stepDown(req.Term)
+	}
+	upToDate := req.LastLogTerm > n.lastTerm() ||
+		req.LastLogTerm == n.lastTerm() && req.LastLogIndex >= n.lastIndex()
+	granted := req.Term == n.term && upToDate &&
+		(n.votedFor == "" || n.votedFor == req.Candidate)
+	if granted && n.votedFor == "" {
+		n.votedFor = req.Candidate
+		if err := n.persistState(); err != nil {
+			n.votedFor = ""
+			granted = false
+		}
+	}
+	if granted {
+		n.resetDeadline()
+	}
+	return VoteResponse{Term: n.term, Granted: granted}
+}
+
+// HandleAppend appends the entries of the leader to the log of the node
+func (n *Node) HandleAppend(req AppendRequest) AppendResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term < n.term {
+		return AppendResponse{Term: n.term}
+	}
+	n.follow(req.Term, req.Leader)
+
+	// Entries already in the snapshot are committed, so they match
+	base := n.log[0].Index
+	prev, entries := req.PrevLogIndex, req.Entries
+	if prev < base {
+		skip := base - prev
+		if skip > uint64(len(entries)) {
+			skip = uint64(len(entries))
+		}
+		prev, entries = prev+skip, entries[skip:]
+		if prev < base {
+			return AppendResponse{Term: n.term, Success: true}
+		}
+	} else {
+		if prev > n.lastIndex() {
+			return AppendResponse{Term: n.term, ConflictIndex: n.lastIndex() + 1}
+		}
+		if t := n.termAt(prev); t != req.PrevLogTerm {
+			conflict := prev
+			for conflict > base+1 && n.termAt(conflict-1) == t {
+				conflict--
+			}
+			return AppendResponse{Term: n.term, ConflictIndex: conflict}
+		}
+	}
+
+	for i, e := range entries {
+		if e.Index <= n.lastIndex() && n.termAt(e.Index) == e.Term {
+			continue
+		}
+		rest := entries[i:]
+		if err := n.config.Storage.Append(rest); err != nil {
+			n.logger.Error("problem persisting entries", "error", err)
+			return AppendResponse{Term: n.term}
+		}
+		n.log = append(n.log[:e.Index-base], rest...)
+		break
+	}
+
+	if req.LeaderCommit > n.commitIndex {
+		last := prev + uint64(len(entries))
+		if req.LeaderCommit < last {
+			last = req.LeaderCommit
+		}
+		if last > n.commitIndex {
+			n.commitIndex = last
+			n.applyCommitted()
+		}
+	}
+	return AppendResponse{Term: n.term, Success: true}
+}
+
+// HandleSnapshot replaces the state of a node too far behind the leader
+func (n *Node) HandleSnapshot(req SnapshotRequest) SnapshotResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term < n.term {
+		return SnapshotResponse{Term: n.term}
+	}
+	n.follow(req.Term, req.Leader)
+
+	s := req.Snapshot
+	if s.Index <= n.commitIndex {
+		return SnapshotResponse{Term: n.term}
+	}
+
+	log := []Entry{{Index: s.Index, Term: s.Term}}
+	if s.Index <= n.lastIndex() && n.termAt(s.Index) == s.Term {
+		log = append(log, n.log[s.Index-n.log[0].Index+1:]...)
+	}
+	if err := n.config.StateMachine.Restore(s.Data); err != nil {
+		n.logger.Error("problem restoring snapshot", "index", s.Index, "error", err)
+		return SnapshotResponse{Term: n.term}
+	}
+	if err := n.config.Storage.SetSnapshot(s, log[1:]); err != nil {
+		n.logger.Error("problem persisting snapshot", "index", s.Index, "error", err)
+	}
+	n.log, n.snapshot = log, s
+	n.commitIndex, n.lastApplied = s.Index, s.Index
+
+	// The entries in the snapshot can't be told apart
+	for index, ws := range n.waiters {
+		if index > s.Index {
+			continue
+		}
+		for _, w := range ws {
+			if w.term == 0 {
+				w.done <- nil
+			} else {
+				w.done <- ErrLeadershipLost
+			}
+		}
+		delete(n.waiters, index)
+	}
+	n.logger.Info("installed snapshot", "index", s.Index, "term", s.Term)
+	return SnapshotResponse{Term: n.term}
+}
+
+// HandlePropose appends a command forwarded by a follower
+func (n *Node) HandlePropose(ctx context.Context, req ProposeRequest) (ProposeResponse, error) {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return ProposeResponse{}, ErrClosed
+	}
+	if n.role != Leader {
+		n.mu.Unlock()
+		return ProposeResponse{}, ErrNoLeader
+	}
+	index, done, err := n.append(req.Command)
+	n.mu.Unlock()
+	if err != nil {
+		return ProposeResponse{}, err
+	}
+	if err := await(ctx, done); err != nil {
+		return ProposeResponse{}, err
+	}
+	return ProposeResponse{Index: index}, nil
+}
+
+// follow makes the node a follower of leader in term, the caller holds the lock
+func (n *Node) follow(term uint64, leader string) {
+	if term > n.term || n.role != Follower {
+		n.stepDown(term)
+	}
+	if n.leader != leader {
+		n.logger.Info("following leader", "leader", leader, "term", term)
+	}
+	n.leader = leader
+	n.resetDeadline()
+}
+
+// stepDown makes the node a follower in term, the caller holds the lock
+func (n *Node) stepDown(term uint64) {
+	if term > n.term {
+		n.term, n.votedFor, n.leader = term, "", ""
+		if err := n.persistState(); err != nil {
+			n.logger.Error("problem persisting term", "term", term, "error", err)
+		}
+	}
+	if n.role == Leader {
+		n.leader = ""
+	}
+	n.role = Follower
+}
+
+func (n *Node) persistState() error {
+	return n.config.Storage.SetState(HardState{Term: n.term, VotedFor: n.votedFor})
+}
+
+func (n *Node) resetDeadline() {
+	timeout := n.config.ElectionTimeout
+	n.deadline = time.Now().Add(timeout + time.Duration(n.rnd.Int63n(int64(timeout))))
+}
+
+func (n *Node) lastIndex() uint64 {
+	return n.log[len(n.log)-1].Index
+}
+
+func (n *Node) lastTerm() uint64 {
+	return n.log[len(n.log)-1].Term
+}
+
+// termAt expects the index to be within the log
+func (n *Node) termAt(index uint64) uint64 {
+	return n.log[index-n.log[0].Index].Term
+}
+
+func (n *Node) quorum() int {
+	return (len(n.config.Peers)+1)/2 + 1
+}
+
+// ticker starts elections and makes leaders that lost contact with the
+// majority step down
+func (n *Node) ticker() {
+	defer n.wg.Done()
+	tick := time.NewTicker(n.config.HeartbeatInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-tick.C:
+		}
+
+		n.mu.Lock()
+		now := time.Now()
+		switch {
+		case n.role == Leader:
+			contacted := 1
+			for _, peer := range n.config.Peers {
+				if now.Sub(n.lastContact[peer]) < n.config.ElectionTimeout {
+					contacted++
+				}
+			}
+			if contacted < n.quorum() {
+				n.logger.Warn("lost contact with the majority, stepping down", "term", n.term)
+				n.stepDown(n.term)
+				n.resetDeadline()
+			}
+		case now.After(n.deadline):
+			n.campaign()
+		}
+		n.mu.Unlock()
+	}
+}
+
+// campaign starts an election, the caller holds the lock
+func (n *Node) campaign() {
+	n.role = Candidate
+	n.term++
+	n.votedFor = n.config.ID
+	n.leader = ""
+	n.resetDeadline()
+	if err := n.persistState(); err != nil {
+		n.logger.Error("problem persisting vote", "term", n.term, "error", err)
+		n.role = Follower
+		return
+	}
+	n.logger.Debug("starting election", "term", n.term)
+
+	term := n.term
+	req := VoteRequest{Term: term, Candidate: n.config.ID, LastLogIndex: n.lastIndex(), LastLogTerm: n.lastTerm()}
+	votes := 1
+	if votes >= n.quorum() {
+		n.becomeLeader()
+		return
+	}
+
+	for _, peer := range n.config.Peers {
+		go func(peer string) {
+			ctx, cancel := context.WithTimeout(context.Background(), n.config.ElectionTimeout)
+			defer cancel()
+			resp, err := n.config.Transport.RequestVote(ctx, peer, req)
+			if err != nil {
+				return
+			}
+
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if resp.Term > n.term {
+				n.stepDown(resp.Term)
+				return
+			}
+			if n.role != Candidate || n.term != term || !resp.Granted {
+				return
+			}
+			votes++
+			if votes >= n.quorum() {
+				n.becomeLeader()
+			}
+		}(peer)
+	}
+}
+
+// becomeLeader appends an empty entry so the entries of previous terms get
+// committed, the caller holds the lock
+func (n *Node) becomeLeader() {
+	n.role = Leader
+	n.leader = n.config.ID
+	now := time.Now()
+	for _, peer := range n.config.Peers {
+		n.nextIndex[peer] = n.lastIndex() + 1
+		n.matchIndex[peer] = 0
+		n.lastContact[peer] = now
+	}
+	n.logger.Info("elected leader", "term", n.term)
+
+	e := Entry{Index: n.lastIndex() + 1, Term: n.term}
+	if err := n.config.Storage.Append([]Entry{e}); err != nil {
+		n.logger.Error("problem persisting entry", "error", err)
+		n.stepDown(n.term)
+		return
+	}
+	n.log = append(n.log, e)
+	n.triggerAll()
+	n.advanceCommit()
+}
+
+func (n *Node) triggerAll() {
+	for _, trigger := range n.triggers {
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// advanceCommit commits the entries of the term stored by a majority, the
+// caller holds the lock
+func (n *Node) advanceCommit() {
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		if n.termAt(index) != n.term {
+			break
+		}
+		stored := 1
+		for _, peer := range n.config.Peers {
+			if n.matchIndex[peer] >= index {
+				stored++
+			}
+		}
+		if stored >= n.quorum() {
+			n.commitIndex = index
+			n.applyCommitted()
+			return
+		}
+	}
+}
+
+// applyCommitted applies the committed entries to the state machine and
+// compacts the log when it grew past the threshold, the caller holds the lock
+func (n *Node) applyCommitted() {
+	for n.lastApplied < n.commitIndex {
+		n.lastApplied++
+		e := n.log[n.lastApplied-n.log[0].Index]
+		if e.Command != nil {
+			n.config.StateMachine.Apply(e.Command)
+		}
+		for _, w := range n.waiters[e.Index] {
+			if w.term == 0 || w.term == e.Term {
+				w.done <- nil
+			} else {
+				w.done <- ErrLeadershipLost
+			}
+		}
+		delete(n.waiters, e.Index)
+	}
+
+	if n.lastApplied-n.log[0].Index >= uint64(n.config.SnapshotThreshold) {
+		n.compact()
+	}
+}
+
+// compact replaces the applied entries with a snapshot, the caller holds the
+// lock
+func (n *Node) compact() {
+	data, err := n.config.StateMachine.Snapshot()
+	if err != nil {
+		n.logger.Error("problem taking snapshot", "error", err)
+		return
+	}
+	s := Snapshot{Index: n.lastApplied, Term: n.termAt(n.lastApplied), Data: data}
+	log := append([]Entry{{Index: s.Index, Term: s.Term}}, n.log[s.Index-n.log[0].Index+1:]...)
+	if err := n.config.Storage.SetSnapshot(s, log[1:]); err != nil {
+		n.logger.Error("problem persisting snapshot", "error", err)
+		return
+	}
+	n.log, n.snapshot = log, s
+	n.logger.Debug("compacted log", "index", s.Index)
+}
+
+// replicator sends the entries a peer is missing, or heartbeats, while the
+// node leads
+func (n *Node) replicator(peer string) {
+	defer n.wg.Done()
+	heartbeat := time.NewTicker(n.config.HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-n.triggers[peer]:
+		case <-heartbeat.C:
+		}
+
+		n.mu.Lock()
+		if n.role != Leader {
+			n.mu.Unlock()
+			continue
+		}
+		term := n.term
+		next := n.nextIndex[peer]
+		if next <= n.log[0].Index {
+			req := SnapshotRequest{Term: term, Leader: n.config.ID, Snapshot: n.snapshot}
+			n.mu.Unlock()
+			n.sendSnapshot(peer, req)
+			continue
+		}
+
+		entries := n.log[next-n.log[0].Index:]
+		if len(entries) > maxEntriesPerAppend {
+			entries = entries[:maxEntriesPerAppend]
+		}
+		req := AppendRequest{
+			Term:         term,
+			Leader:       n.config.ID,
+			PrevLogIndex: next - 1,
+			PrevLogTerm:  n.termAt(next - 1),
+			Entries:      append([]Entry(nil), entries...),
+			LeaderCommit: n.commitIndex,
+		}
+		n.mu.Unlock()
+		n.sendAppend(peer, req)
+	}
+}
+
+func (n *Node) sendAppend(peer string, req AppendRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.config.ElectionTimeout)
+	defer cancel()
+	resp, err := n.config.Transport.AppendEntries(ctx, peer, req)
+	if err != nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if resp.Term > n.term {
+		n.stepDown(resp.Term)
+		return
+	}
+	if n.role != Leader || n.term != req.Term {
+		return
+	}
+	n.lastContact[peer] = time.Now()
+
+	if !resp.Success {
+		next := resp.ConflictIndex
+		if next == 0 || next > req.PrevLogIndex {
+			next = req.PrevLogIndex
+		}
+		if next < 1 {
+			next = 1
+		}
+		n.nextIndex[peer] = next
+		n.trigger(peer)
+		return
+	}
+
+	match := req.PrevLogIndex + uint64(len(req.Entries))
+	if match > n.matchIndex[peer] {
+		n.matchIndex[peer] = match
+		n.advanceCommit()
+	}
+	n.nextIndex[peer] = n.matchIndex[peer] + 1
+	if n.nextIndex[peer] <= n.lastIndex() {
+		n.trigger(peer)
+	}
+}
+
+func (n *Node) sendSnapshot(peer string, req SnapshotRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.config.ElectionTimeout)
+	defer cancel()
+	resp, err := n.config.Transport.InstallSnapshot(ctx, peer, req)
+	if err != nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if resp.Term > n.term {
+		n.stepDown(resp.Term)
+		return
+	}
+	if n.role != Leader || n.term != req.Term {
+		return
+	}
+	n.lastContact[peer] = time.Now()
+	if req.Snapshot.Index > n.matchIndex[peer] {
+		n.matchIndex[peer] = req.Snapshot.Index
+	}
+	n.nextIndex[peer] = n.matchIndex[peer] + 1
+	n.trigger(peer)
+}
+
+func (n *Node) trigger(peer string) {
+	select {
+	case n.triggers[peer] <- struct{}{}:
+	default:
+	}
+}
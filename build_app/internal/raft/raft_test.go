@@ -0,0 +1,317 @@
+package raft_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/windnow/edusrv/internal/raft"
+)
+
+func TestRaft(t *testing.T) {
+	t.Run("elects one leader", func(t *testing.T) {
+		c := newCluster(t, 3, nil)
+		defer c.close()
+
+		leader := c.waitLeader(t, c.ids...)
+		for _, id := range c.ids {
+			c.waitFor(t, "everyone following "+leader, func() bool { return c.nodes[id].Leader() == leader })
+		}
+	})
+
+	t.Run("replicates commands to every node", func(t *testing.T) {
+		c := newCluster(t, 3, nil)
+		defer c.close()
+
+		leader := c.waitLeader(t, c.ids...)
+		assertPropose(t, c.nodes[leader], "a")
+		assertPropose(t, c.nodes[c.follower(leader)], "b")
+
+		c.waitApplied(t, []string{"a", "b"}, c.ids...)
+	})
+
+	t.Run("keeps committing on the majority side of a partition", func(t *testing.T) {
+		c := newCluster(t, 5, nil)
+		defer c.close()
+
+		old := c.waitLeader(t, c.ids...)
+		assertPropose(t, c.nodes[old], "a")
+		c.waitApplied(t, []string{"a"}, c.ids...)
+
+		minority := []string{old, c.follower(old)}
+		majority := without(c.ids, minority...)
+		c.network.Partition(minority, majority)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		if err := c.nodes[old].Propose(ctx, []byte("lost")); err == nil {
+			t.Error("committed a command without a majority")
+		}
+
+		leader := c.waitLeader(t, majority...)
+		assertPropose(t, c.nodes[leader], "b")
+		c.waitApplied(t, []string{"a", "b"}, majority...)
+		c.waitFor(t, "the old leader to step down", func() bool { return c.nodes[old].Status().Role != raft.Leader })
+
+		c.network.Heal()
+		c.waitApplied(t, []string{"a", "b"}, c.ids...)
+	})
+
+	t.Run("stops without a quorum", func(t *testing.T) {
+		c := newCluster(t, 3, nil)
+		defer c.close()
+
+		leader := c.waitLeader(t, c.ids...)
+		c.network.Partition([]string{c.ids[0]}, []string{c.ids[1]}, []string{c.ids[2]})
+		c.waitFor(t, "the leader to step down", func() bool { return c.nodes[leader].Status().Role != raft.Leader })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		if err := c.nodes[leader].Propose(ctx, []byte("a")); err == nil {
+			t.Error("committed a command without a quorum")
+		}
+
+		c.network.Heal()
+		leader = c.waitLeader(t, c.ids...)
+		assertPropose(t, c.nodes[leader], "b")
+		c.waitApplied(t, []string{"b"}, c.ids...)
+	})
+
+	t.Run("sends snapshots to nodes too far behind", func(t *testing.T) {
+		c := newCluster(t, 3, func(config *raft.Config) { config.SnapshotThreshold = 5 })
+		defer c.close()
+
+		leader := c.waitLeader(t, c.ids...)
+		lagging := c.follower(leader)
+		c.network.Disconnect(lagging)
+
+		var want []string
+		for i := 0; i < 20; i++ {
+			want = append(want, fmt.Sprint(i))
+			assertPropose(t, c.nodes[leader], want[i])
+		}
+		if got := c.nodes[leader].Status().Snapshot; got == 0 {
+			t.Fatal("leader didn't compact its log")
+		}
+
+		c.network.Connect(lagging, c.nodes[lagging])
+		c.waitApplied(t, want, c.ids...)
+		if got := c.machines[lagging].restores(); got == 0 {
+			t.Error("lagging node caught up without a snapshot")
+		}
+	})
+
+	t.Run("restarts from its storage", func(t *testing.T) {
+		dir := t.TempDir()
+		storages := make(map[string]raft.Storage)
+		c := newCluster(t, 3, func(config *raft.Config) {
+			storage, err := raft.NewFileStorage(dir + "/" + config.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config.Storage = storage
+			config.SnapshotThreshold = 4
+			storages[config.ID] = storage
+		})
+		defer c.close()
+
+		leader := c.waitLeader(t, c.ids...)
+		var want []string
+		for i := 0; i < 6; i++ {
+			want = append(want, fmt.Sprint(i))
+			assertPropose(t, c.nodes[leader], want[i])
+		}
+		c.waitApplied(t, want, c.ids...)
+
+		for _, id := range c.ids {
+			c.nodes[id].Close()
+			c.network.Disconnect(id)
+			storages[id].(*raft.FileStorage).Close()
+		}
+		for _, id := range c.ids {
+			storage, err := raft.NewFileStorage(dir + "/" + id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.start(t, id, func(config *raft.Config) { config.Storage = storage; config.SnapshotThreshold = 4 })
+		}
+
+		leader = c.waitLeader(t, c.ids...)
+		want = append(want, "after restart")
+		assertPropose(t, c.nodes[leader], "after restart")
+		c.waitApplied(t, want, c.ids...)
+	})
+}
+
+// machine records the commands applied to it
+type machine struct {
+	mu       sync.Mutex
+	commands []string
+	restored int
+}
+
+func (m *machine) Apply(command []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = append(m.commands, string(command))
+}
+
+func (m *machine) Snapshot() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return []byte(strings.Join(m.commands, "\n")), nil
+}
+
+func (m *machine) Restore(data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = nil
+	if len(data) > 0 {
+		m.commands = strings.Split(string(data), "\n")
+	}
+	m.restored++
+	return nil
+}
+
+func (m *machine) applied() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.commands...)
+}
+
+func (m *machine) restores() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.restored
+}
+
+type cluster struct {
+	network  *raft.Network
+	ids      []string
+	nodes    map[string]*raft.Node
+	machines map[string]*machine
+}
+
+func newCluster(t *testing.T, size int, configure func(config *raft.Config)) *cluster {
+	t.Helper()
+	c := &cluster{
+		network:  raft.NewNetwork(),
+		nodes:    make(map[string]*raft.Node),
+		machines: make(map[string]*machine),
+	}
+	for i := 0; i < size; i++ {
+		c.ids = append(c.ids, fmt.Sprintf("node-%d", i))
+	}
+	for _, id := range c.ids {
+		c.start(t, id, configure)
+	}
+	return c
+}
+
+func (c *cluster) start(t *testing.T, id string, configure func(config *raft.Config)) {
+	t.Helper()
+	c.machines[id] = new(machine)
+	config := raft.Config{
+		ID:                id,
+		Peers:             without(c.ids, id),
+		StateMachine:      c.machines[id],
+		Transport:         c.network.Transport(id),
+		ElectionTimeout:   50 * time.Millisecond,
+		HeartbeatInterval: 10 * time.Millisecond,
+		Logger:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	if configure != nil {
+		configure(&config)
+	}
+	node, err := raft.NewNode(config)
+	if err != nil {
+		t.Fatalf("problem starting %s, %v", id, err)
+	}
+	c.nodes[id] = node
+	c.network.Connect(id, node)
+}
+
+func (c *cluster) close() {
+	for _, node := range c.nodes {
+		node.Close()
+	}
+}
+
+// waitLeader waits for one of the nodes to lead them
+func (c *cluster) waitLeader(t *testing.T, ids ...string) string {
+	t.Helper()
+	var leader string
+	c.waitFor(t, "a leader", func() bool {
+		for _, id := range ids {
+			s := c.nodes[id].Status()
+			if s.Role == raft.Leader && s.Leader == id {
+				leader = id
+				return true
+			}
+		}
+		return false
+	})
+	return leader
+}
+
+func (c *cluster) follower(leader string) string {
+	return without(c.ids, leader)[0]
+}
+
+func (c *cluster) waitApplied(t *testing.T, want []string, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		m := c.machines[id]
+		c.waitFor(t, fmt.Sprintf("%s to apply %v", id, want), func() bool {
+			return reflect.DeepEqual(m.applied(), want)
+		})
+	}
+}
+
+func (c *cluster) waitFor(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func without(ids []string, out ...string) []string {
+	var kept []string
+next:
+	for _, id := range ids {
+		for _, o := range out {
+			if id == o {
+				continue next
+			}
+		}
+		kept = append(kept, id)
+	}
+	return kept
+}
+
+func assertPropose(t *testing.T, node *raft.Node, command string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		err := node.Propose(ctx, []byte(command))
+		if err == nil {
+			return
+		}
+		// The leader may change while the cluster settles
+		if ctx.Err() != nil {
+			t.Fatalf("problem proposing %q, %v", command, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,285 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// HardState is what a node must remember of its terms across restarts
+type HardState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"voted_for,omitempty"`
+}
+
+// Storage keeps the state of a node, it must be durable once its methods
+// return
+type Storage interface {
+	// Load returns the state, the snapshot and the entries following it
+	Load() (HardState, Snapshot, []Entry, error)
+	SetState(s HardState) error
+	// Append stores the entries, dropping the stored entries from the index
+	// of the first one on
+	Append(entries []Entry) error
+	// SetSnapshot stores the snapshot and replaces the entries with the
+	// ones following it
+	SetSnapshot(s Snapshot, entries []Entry) error
+}
+
+// MemoryStorage keeps the state of a node in memory, for tests and nodes
+// that can afford to lose it
+type MemoryStorage struct {
+	mu       sync.Mutex
+	state    HardState
+	snapshot Snapshot
+	entries  []Entry
+}
+
+// NewMemoryStorage returns an empty storage
+func NewMemoryStorage() *MemoryStorage {
+	return new(MemoryStorage)
+}
+
+// Load returns copies of what was stored
+func (m *MemoryStorage) Load() (HardState, Snapshot, []Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state, m.snapshot, append([]Entry(nil), m.entries...), nil
+}
+
+// SetState stores the state
+func (m *MemoryStorage) SetState(s HardState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = s
+	return nil
+}
+
+// Append stores the entries
+func (m *MemoryStorage) Append(entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keep := len(m.entries)
+	for keep > 0 && m.entries[keep-1].Index >= entries[0].Index {
+		keep--
+	}
+	m.entries = append(m.entries[:keep:keep], entries...)
+	return nil
+}
+
+// SetSnapshot stores the snapshot
+func (m *MemoryStorage) SetSnapshot(s Snapshot, entries []Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshot = s
+	m.entries = append([]Entry(nil), entries...)
+	return nil
+}
+
+// FileStorage keeps the state of a node in a directory: the state and the
+// snapshot are JSON files replaced as a whole, the entries an NDJSON file
+// appended to
+type FileStorage struct {
+	dir string
+
+	mu   sync.Mutex
+	log  *os.File
+	size int64
+	// first is the index of the first entry of the log file, offsets the
+	// position of every entry in it
+	first   uint64
+	offsets []int64
+}
+
+const (
+	stateFile    = "state.json"
+	snapshotFile = "snapshot.json"
+	logFile      = "log.ndjson"
+)
+
+// NewFileStorage opens the storage in dir, creating it when needed
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("problem creating %s, %v", dir, err)
+	}
+	log, err := os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("problem opening log, %v", err)
+	}
+	return &FileStorage{dir: dir, log: log}, nil
+}
+
+// Load reads the storage, a torn entry at the end of the log is dropped
+func (f *FileStorage) Load() (HardState, Snapshot, []Entry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var state HardState
+	if err := readJSON(filepath.Join(f.dir, stateFile), &state); err != nil {
+		return state, Snapshot{}, nil, err
+	}
+	var snapshot Snapshot
+	if err := readJSON(filepath.Join(f.dir, snapshotFile), &snapshot); err != nil {
+		return state, snapshot, nil, err
+	}
+
+	if _, err := f.log.Seek(0, io.SeekStart); err != nil {
+		return state, snapshot, nil, fmt.Errorf("problem reading log, %v", err)
+	}
+	var entries []Entry
+	f.offsets, f.size = nil, 0
+	reader := bufio.NewReader(f.log)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return state, snapshot, nil, fmt.Errorf("problem reading log, %v", err)
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			break
+		}
+		if e.Index > snapshot.Index {
+			if len(entries) == 0 {
+				f.first = e.Index
+			}
+			entries = append(entries, e)
+			f.offsets = append(f.offsets, f.size)
+		}
+		f.size += int64(len(line))
+	}
+	if len(entries) == 0 {
+		f.first = snapshot.Index + 1
+	}
+	if err := f.log.Truncate(f.size); err != nil {
+		return state, snapshot, nil, fmt.Errorf("problem truncating log, %v", err)
+	}
+	return state, snapshot, entries, nil
+}
+
+// SetState replaces the state file
+func (f *FileStorage) SetState(s HardState) error {
+	return writeJSON(filepath.Join(f.dir, stateFile), s)
+}
+
+// Append truncates the log file at the first entry and writes the entries
+// after it
+func (f *FileStorage) Append(entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if i := entries[0].Index; i < f.first+uint64(len(f.offsets)) {
+		if i < f.first {
+			return fmt.Errorf("entry %d is before the log starting at %d", i, f.first)
+		}
+		f.size = f.offsets[i-f.first]
+		f.offsets = f.offsets[:i-f.first]
+		if err := f.log.Truncate(f.size); err != nil {
+			return fmt.Errorf("problem truncating log, %v", err)
+		}
+	}
+	if len(f.offsets) == 0 {
+		f.first = entries[0].Index
+	}
+	return f.write(entries)
+}
+
+// write appends entries to the log file, the caller holds the lock
+func (f *FileStorage) write(entries []Entry) error {
+	var buf []byte
+	offsets := f.offsets
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		offsets = append(offsets, f.size+int64(len(buf)))
+		buf = append(append(buf, line...), '\n')
+	}
+	if _, err := f.log.WriteAt(buf, f.size); err != nil {
+		return fmt.Errorf("problem writing log, %v", err)
+	}
+	if err := f.log.Sync(); err != nil {
+		return fmt.Errorf("problem syncing log, %v", err)
+	}
+	f.offsets = offsets
+	f.size += int64(len(buf))
+	return nil
+}
+
+// SetSnapshot replaces the snapshot file, then rewrites the log file with
+// the entries. Entries the snapshot covers are skipped when loading, so a
+// crash in between loses nothing
+func (f *FileStorage) SetSnapshot(s Snapshot, entries []Entry) error {
+	if err := writeJSON(filepath.Join(f.dir, snapshotFile), s); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.log.Truncate(0); err != nil {
+		return fmt.Errorf("problem truncating log, %v", err)
+	}
+	f.size, f.offsets, f.first = 0, nil, s.Index+1
+	return f.write(entries)
+}
+
+// Close closes the log file
+func (f *FileStorage) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.log.Close()
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("problem reading %s, %v", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("problem parsing %s, %v", path, err)
+	}
+	return nil
+}
+
+// writeJSON replaces the file through a temporary one
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("problem creating %s, %v", tmp, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("problem writing %s, %v", tmp, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("problem syncing %s, %v", tmp, err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,73 @@
+package raft
+
+import "context"
+
+// VoteRequest asks for the vote of a node in an election
+type VoteRequest struct {
+	Term         uint64 `json:"term"`
+	Candidate    string `json:"candidate"`
+	LastLogIndex uint64 `json:"last_log_index"`
+	LastLogTerm  uint64 `json:"last_log_term"`
+}
+
+// VoteResponse tells a candidate whether it got the vote
+type VoteResponse struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+// AppendRequest replicates entries, without entries it is a heartbeat
+type AppendRequest struct {
+	Term         uint64  `json:"term"`
+	Leader       string  `json:"leader"`
+	PrevLogIndex uint64  `json:"prev_log_index"`
+	PrevLogTerm  uint64  `json:"prev_log_term"`
+	Entries      []Entry `json:"entries,omitempty"`
+	LeaderCommit uint64  `json:"leader_commit"`
+}
+
+// AppendResponse tells the leader whether the entries were appended. When
+// they weren't, ConflictIndex is the first entry the leader should send
+type AppendResponse struct {
+	Term          uint64 `json:"term"`
+	Success       bool   `json:"success"`
+	ConflictIndex uint64 `json:"conflict_index,omitempty"`
+}
+
+// SnapshotRequest sends a snapshot to a node missing the entries it replaced
+type SnapshotRequest struct {
+	Term     uint64   `json:"term"`
+	Leader   string   `json:"leader"`
+	Snapshot Snapshot `json:"snapshot"`
+}
+
+// SnapshotResponse carries the term of the node
+type SnapshotResponse struct {
+	Term uint64 `json:"term"`
+}
+
+// ProposeRequest forwards a command from a follower to the leader
+type ProposeRequest struct {
+	Command []byte `json:"command"`
+}
+
+// ProposeResponse is the index the command was applied at
+type ProposeResponse struct {
+	Index uint64 `json:"index"`
+}
+
+// Transport sends requests to the peers of a node
+type Transport interface {
+	RequestVote(ctx context.Context, peer string, req VoteRequest) (VoteResponse, error)
+	AppendEntries(ctx context.Context, peer string, req AppendRequest) (AppendResponse, error)
+	InstallSnapshot(ctx context.Context, peer string, req SnapshotRequest) (SnapshotResponse, error)
+	Propose(ctx context.Context, peer string, req ProposeRequest) (ProposeResponse, error)
+}
+
+// Handler answers the requests of peers, *Node is one
+type Handler interface {
+	HandleVote(req VoteRequest) VoteResponse
+	HandleAppend(req AppendRequest) AppendResponse
+	HandleSnapshot(req SnapshotRequest) SnapshotResponse
+	HandlePropose(ctx context.Context, req ProposeRequest) (ProposeResponse, error)
+}
@@ -0,0 +1,492 @@
+// Package raftstore is a PlayerStore replicated across nodes with Raft:
+// wins are recorded once a majority of the nodes stored them, and every
+// node serves the league as of the wins it applied.
+package raftstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	"github.com/windnow/edusrv/internal/raft"
+)
+
+const (
+	defaultTimeout           = 5 * time.Second
+	defaultIdempotencyWindow = 24 * time.Hour
+)
+
+// command is an entry of the Raft log
+type command struct {
+	// Wins are recorded in order
+	Wins []string `json:"wins,omitempty"`
+	// League replaces the league when set
+	League gs.League `json:"league,omitempty"`
+	// Key records the win unless a win was recorded with it already. At
+	// expires the keys, Window is how long the proposer keeps the key, so
+	// every node forgets it at once. Proposal tells the proposer its
+	// command recorded it
+	Key      string        `json:"key,omitempty"`
+	At       time.Time     `json:"at,omitempty"`
+	Window   time.Duration `json:"window,omitempty"`
+	Proposal string        `json:"proposal,omitempty"`
+}
+
+// idempotencyKey is a key a win was recorded with, kept in snapshots
+type idempotencyKey struct {
+	gs.IdempotencyKey
+	Expires  time.Time `json:"expires"`
+	Proposal string    `json:"proposal"`
+}
+
+// snapshot is the state of the store
+type snapshot struct {
+	League gs.League        `json:"league"`
+	Keys   []idempotencyKey `json:"keys,omitempty"`
+}
+
+// player keeps when the player reached its wins, earlier players rank first
+// among tied ones
+type player struct {
+	name string
+	wins int
+	tick uint64
+}
+
+// before orders players by wins and then by when they reached them
+func (p *player) before(other *player) bool {
+	if p.wins != other.wins {
+		return p.wins > other.wins
+	}
+	return p.tick < other.tick
+}
+
+// Store is a PlayerStore whose wins go through the Raft log
+type Store struct {
+	node      *raft.Node
+	timeout   time.Duration
+	logger    *slog.Logger
+	keyWindow time.Duration
+	now       func() time.Time
+
+	mu      sync.RWMutex
+	players map[string]*player
+	tick    uint64
+	// order keeps the players sorted for the league and ranks, levels
+	// the distinct numbers of wins from the most, with their players
+	order   []*player
+	levels  []int
+	atLevel map[int]int
+	// keys wins were recorded with, in the order they were used
+	keys     map[string]idempotencyKey
+	keyOrder []idempotencyKey
+}
+
+// Option configures a Store
+type Option func(*Store)
+
+// WithTimeout sets how long writes wait to be committed, 5 seconds by default
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Store) {
+		s.timeout = timeout
+	}
+}
+
+// WithIdempotencyWindow sets how long the keys of wins proposed by the node
+// are remembered, a day by default. The window goes through the log with
+// the key, every node remembers it as long
+func WithIdempotencyWindow(window time.Duration) Option {
+	return func(s *Store) {
+		s.keyWindow = window
+	}
+}
+
+// WithLogger sets the logger writes that fail are reported to
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Store) {
+		s.logger = logger
+	}
+}
+
+// New starts the Raft node of the store, the store is its state machine
+func New(config raft.Config, options ...Option) (*Store, error) {
+	s := &Store{
+		timeout:   defaultTimeout,
+		logger:    slog.Default(),
+		keyWindow: defaultIdempotencyWindow,
+		now:       time.Now,
+		players:   make(map[string]*player),
+		atLevel:   make(map[int]int),
+		keys:      make(map[string]idempotencyKey),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	if config.Logger == nil {
+		config.Logger = s.logger
+	}
+	config.StateMachine = s
+
+	node, err := raft.NewNode(config)
+	if err != nil {
+		return nil, fmt.Errorf("problem starting raft node, %v", err)
+	}
+	s.node = node
+	return s, nil
+}
+
+// Node returns the Raft node of the store
+func (s *Store) Node() *raft.Node {
+	return s.node
+}
+
+// Close stops the Raft node
+func (s *Store) Close() {
+	s.node.Close()
+}
+
+// GetPlayerScore returns the wins of a player
+func (s *Store) GetPlayerScore(name string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.players[name]; ok {
+		return p.wins
+	}
+	return 0
+}
+
+// RecordWin records a win once it is committed, failures are logged. The
+// server calls TryRecordWins instead to report them
+func (s *Store) RecordWin(name string) {
+	s.RecordWins([]string{name})
+}
+
+// RecordWins records the wins with one entry of the log, failures are
+// logged
+func (s *Store) RecordWins(names []string) {
+	if err := s.TryRecordWins(names); err != nil {
+		s.logger.Error("problem recording wins", "players", len(names), "error", err)
+	}
+}
+
+// TryRecordWins records the wins with one entry of the log, failing when
+// it isn't committed in time, see gs.FallibleStore. The entry may still be
+// committed later
+func (s *Store) TryRecordWins(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	return s.propose(command{Wins: names})
+}
+
+// LookupWinKey returns the player a win was recorded for with key
+func (s *Store) LookupWinKey(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[key]
+	return k.Name, ok
+}
+
+// RecordWinOnce records a win unless one was recorded with key, failures
+// are logged. The server calls TryRecordWinOnce instead to report them
+func (s *Store) RecordWinOnce(name, key string) (string, bool) {
+	recordedFor, recorded, err := s.TryRecordWinOnce(name, key)
+	if err != nil {
+		s.logger.Error("problem recording win", "player", name, "error", err)
+	}
+	return recordedFor, recorded
+}
+
+// TryRecordWinOnce records a win unless one was recorded with key. The key
+// goes through the log with the win, so every node remembers it and only
+// the first of concurrent retries counts
+func (s *Store) TryRecordWinOnce(name, key string) (string, bool, error) {
+	if recordedFor, ok := s.LookupWinKey(key); ok {
+		return recordedFor, false, nil
+	}
+
+	b := make([]byte, 12)
+	rand.Read(b)
+	proposal := hex.EncodeToString(b)
+	c := command{Wins: []string{name}, Key: key, At: s.now().UTC(), Window: s.keyWindow, Proposal: proposal}
+	if err := s.propose(c); err != nil {
+		return "", false, err
+	}
+
+	// the command is applied once proposed
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[key]
+	if !ok {
+		return "", false, fmt.Errorf("idempotency key %q expired before it was applied", key)
+	}
+	return k.Name, k.Proposal == proposal, nil
+}
+
+// ReplaceLeague swaps the whole league on every node
+func (s *Store) ReplaceLeague(league gs.League) error {
+	if league == nil {
+		league = gs.League{}
+	}
+	return s.propose(command{League: league})
+}
+
+func (s *Store) propose(c command) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.node.Propose(ctx, data)
+}
+
+// Check fails while the node doesn't know a leader, writes can't be
+// committed then
+func (s *Store) Check(ctx context.Context) error {
+	if s.node.Leader() == "" {
+		return errors.New("no raft leader")
+	}
+	return nil
+}
+
+// GetLeague returns the players sorted by wins
+func (s *Store) GetLeague() gs.League {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.league()
+}
+
+// GetPlayerRank returns the rank of a player
+func (s *Store) GetPlayerRank(name string, mode gs.RankMode) (gs.Rank, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.players[name]
+	if !ok {
+		return gs.Rank{}, false
+	}
+	return s.rank(p, mode), true
+}
+
+// GetLeagueAround returns the player with up to n players above and below
+func (s *Store) GetLeagueAround(name string, n int, mode gs.RankMode) ([]gs.Rank, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.players[name]
+	if !ok {
+		return nil, false
+	}
+
+	pos := s.position(p)
+	from, to := pos-n, pos+n+1
+	if from < 0 {
+		from = 0
+	}
+	if to > len(s.order) {
+		to = len(s.order)
+	}
+	ranks := make([]gs.Rank, 0, to-from)
+	for _, p := range s.order[from:to] {
+		ranks = append(ranks, s.rank(p, mode))
+	}
+	return ranks, true
+}
+
+// league returns the players in order, the caller holds the lock
+func (s *Store) league() gs.League {
+	league := make(gs.League, len(s.order))
+	for i, p := range s.order {
+		league[i] = gs.Player{Name: p.name, Wins: p.wins}
+	}
+	return league
+}
+
+// rank counts the players, or the numbers of wins, above p. The caller
+// holds the lock
+func (s *Store) rank(p *player, mode gs.RankMode) gs.Rank {
+	above := sort.Search(len(s.order), func(i int) bool {
+		return s.order[i].wins <= p.wins
+	})
+	if mode == gs.DenseRank {
+		above = sort.Search(len(s.levels), func(i int) bool {
+			return s.levels[i] <= p.wins
+		})
+	}
+	return gs.Rank{Name: p.name, Wins: p.wins, Rank: above + 1}
+}
+
+// position returns the index of p in the order, or where it belongs. The
+// caller holds the lock
+func (s *Store) position(p *player) int {
+	return sort.Search(len(s.order), func(i int) bool {
+		return !s.order[i].before(p)
+	})
+}
+
+// addWin moves the player to its place for one more win, the caller holds
+// the lock
+func (s *Store) addWin(name string) {
+	s.tick++
+	p, ok := s.players[name]
+	if ok {
+		i := s.position(p)
+		s.order = append(s.order[:i], s.order[i+1:]...)
+		s.removeLevel(p.wins)
+	} else {
+		p = &player{name: name}
+		s.players[name] = p
+	}
+	p.wins++
+	p.tick = s.tick
+
+	i := s.position(p)
+	s.order = append(s.order, nil)
+	copy(s.order[i+1:], s.order[i:])
+	s.order[i] = p
+	s.addLevel(p.wins)
+}
+
+func (s *Store) addLevel(wins int) {
+	s.atLevel[wins]++
+	if s.atLevel[wins] > 1 {
+		return
+	}
+	i := sort.Search(len(s.levels), func(i int) bool {
+		return s.levels[i] <= wins
+	})
+	s.levels = append(s.levels, 0)
+	copy(s.levels[i+1:], s.levels[i:])
+	s.levels[i] = wins
+}
+
+func (s *Store) removeLevel(wins int) {
+	s.atLevel[wins]--
+	if s.atLevel[wins] > 0 {
+		return
+	}
+	delete(s.atLevel, wins)
+	i := sort.Search(len(s.levels), func(i int) bool {
+		return s.levels[i] <= wins
+	})
+	s.levels = append(s.levels[:i], s.levels[i+1:]...)
+}
+
+// Apply applies an entry of the log
+func (s *Store) Apply(data []byte) {
+	var c command
+	if err := json.Unmarshal(data, &c); err != nil {
+		s.logger.Error("problem parsing raft entry", "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.League != nil {
+		s.reset(c.League)
+	}
+	if c.Key != "" {
+		s.expireKeys(c.At)
+		if _, ok := s.keys[c.Key]; ok {
+			// a retry was committed first
+			return
+		}
+		if c.Window <= 0 {
+			// entries proposed before commands carried the window
+			c.Window = defaultIdempotencyWindow
+		}
+		if len(c.Wins) > 0 {
+			k := gs.IdempotencyKey{Key: c.Key, Name: c.Wins[0], At: c.At}
+			s.rememberKey(idempotencyKey{k, c.At.Add(c.Window), c.Proposal})
+		}
+	}
+	for _, name := range c.Wins {
+		s.addWin(name)
+	}
+}
+
+// Snapshot returns the league and the keys wins were recorded with
+func (s *Store) Snapshot() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return json.Marshal(snapshot{League: s.league(), Keys: s.keyOrder})
+}
+
+// Restore replaces the league and the keys with a snapshot. Snapshots of
+// the league alone, without keys, are restored too
+func (s *Store) Restore(data []byte) error {
+	var snap snapshot
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err = json.Unmarshal(data, &snap.League)
+	} else {
+		err = json.Unmarshal(data, &snap)
+	}
+	if err != nil {
+		return fmt.Errorf("problem parsing snapshot, %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset(snap.League)
+	s.keys, s.keyOrder = make(map[string]idempotencyKey, len(snap.Keys)), nil
+	for _, k := range snap.Keys {
+		if k.Expires.IsZero() {
+			k.Expires = k.At.Add(defaultIdempotencyWindow)
+		}
+		s.rememberKey(k)
+	}
+	return nil
+}
+
+// rememberKey keeps a key until it expires, the caller holds the lock
+func (s *Store) rememberKey(k idempotencyKey) {
+	s.keys[k.Key] = k
+	s.keyOrder = append(s.keyOrder, k)
+}
+
+// expireKeys forgets the keys expired by now, which is the time of a
+// command so that every node forgets the same keys. Keys expire in the
+// order they were used, one proposed with a shorter window waits for the
+// ones before it. The caller holds the lock
+func (s *Store) expireKeys(now time.Time) {
+	i := 0
+	for i < len(s.keyOrder) && !now.Before(s.keyOrder[i].Expires) {
+		if s.keys[s.keyOrder[i].Key].Proposal == s.keyOrder[i].Proposal {
+			delete(s.keys, s.keyOrder[i].Key)
+		}
+		i++
+	}
+	if i > 0 {
+		s.keyOrder = append([]idempotencyKey(nil), s.keyOrder[i:]...)
+	}
+}
+
+// reset replaces the players, tied players keep their order in the league.
+// The caller holds the lock
+func (s *Store) reset(league gs.League) {
+	s.players = make(map[string]*player, len(league))
+	s.order = make([]*player, 0, len(league))
+	s.levels, s.atLevel = nil, make(map[int]int)
+	s.tick = 0
+	for _, p := range league {
+		if _, ok := s.players[p.Name]; ok {
+			continue
+		}
+		s.tick++
+		player := &player{name: p.Name, wins: p.Wins, tick: s.tick}
+		s.players[p.Name] = player
+		s.order = append(s.order, player)
+		s.addLevel(p.Wins)
+	}
+	sort.SliceStable(s.order, func(i, j int) bool {
+		return s.order[i].before(s.order[j])
+	})
+}
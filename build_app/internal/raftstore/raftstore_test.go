@@ -0,0 +1,278 @@
+package raftstore_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	"github.com/windnow/edusrv/internal/raft"
+	"github.com/windnow/edusrv/internal/raftstore"
+)
+
+func TestRaftStore(t *testing.T) {
+	t.Run("records wins on any node", func(t *testing.T) {
+		_, stores := newCluster(t, 3)
+		defer closeAll(stores)
+		waitLeader(t, stores)
+
+		stores[0].RecordWin("Pepper")
+		stores[1].RecordWins([]string{"Cleo", "Pepper"})
+		stores[2].RecordWin("Cleo")
+		stores[2].RecordWin("Apollo")
+
+		want := gs.League{{Name: "Pepper", Wins: 2}, {Name: "Cleo", Wins: 2}, {Name: "Apollo", Wins: 1}}
+		for _, s := range stores {
+			waitLeague(t, s, want)
+		}
+
+		rank, ok := stores[0].GetPlayerRank("Cleo", gs.CompetitionRank)
+		if !ok || rank != (gs.Rank{Name: "Cleo", Wins: 2, Rank: 1}) {
+			t.Errorf("got rank %v want Cleo first", rank)
+		}
+		around, _ := stores[1].GetLeagueAround("Apollo", 1, gs.DenseRank)
+		wantAround := []gs.Rank{{Name: "Cleo", Wins: 2, Rank: 1}, {Name: "Apollo", Wins: 1, Rank: 2}}
+		if !reflect.DeepEqual(around, wantAround) {
+			t.Errorf("got %v want %v", around, wantAround)
+		}
+	})
+
+	t.Run("serves the league of the majority after a partition heals", func(t *testing.T) {
+		network, stores := newCluster(t, 3)
+		defer closeAll(stores)
+		leader := waitLeader(t, stores)
+		stores[leader].RecordWin("Pepper")
+
+		isolated := stores[leader]
+		var majority []*raftstore.Store
+		for i, s := range stores {
+			if i != leader {
+				majority = append(majority, s)
+			}
+		}
+		network.Partition([]string{isolated.Node().ID()})
+
+		waitFor(t, "the isolated node to fail its check", func() bool {
+			return isolated.Check(context.Background()) != nil
+		})
+
+		// the win can't be committed, the server must not accept it
+		response := httptest.NewRecorder()
+		gs.NewServer(isolated).ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/players/Lost", nil))
+		if response.Code != http.StatusServiceUnavailable {
+			t.Errorf("got status %d for a win without a majority, want %d", response.Code, http.StatusServiceUnavailable)
+		}
+		waitLeader(t, majority)
+		majority[0].RecordWin("Cleo")
+		majority[1].RecordWin("Cleo")
+
+		network.Heal()
+		want := gs.League{{Name: "Cleo", Wins: 2}, {Name: "Pepper", Wins: 1}}
+		for _, s := range stores {
+			waitLeague(t, s, want)
+		}
+	})
+
+	t.Run("records a win once per idempotency key on any node", func(t *testing.T) {
+		network, stores := newCluster(t, 3)
+		defer closeAll(stores)
+		leader := waitLeader(t, stores)
+		lagging := stores[(leader+1)%3]
+		network.Disconnect(lagging.Node().ID())
+
+		recordedFor, recorded, err := stores[leader].TryRecordWinOnce("Pepper", "abc")
+		if err != nil || !recorded || recordedFor != "Pepper" {
+			t.Fatalf("got %q, %v, %v recording the first win", recordedFor, recorded, err)
+		}
+		other := stores[(leader+2)%3]
+		if recordedFor, recorded, err := other.TryRecordWinOnce("Pepper", "abc"); err != nil || recorded || recordedFor != "Pepper" {
+			t.Errorf("got %q, %v, %v retrying the win", recordedFor, recorded, err)
+		}
+		// enough entries for the lagging node to catch up from a snapshot
+		for i := 0; i < 5; i++ {
+			if err := stores[leader].TryRecordWins([]string{"Cleo"}); err != nil {
+				t.Fatalf("problem recording win, %v", err)
+			}
+		}
+
+		network.Connect(lagging.Node().ID(), lagging.Node())
+		want := gs.League{{Name: "Cleo", Wins: 5}, {Name: "Pepper", Wins: 1}}
+		for _, s := range stores {
+			waitLeague(t, s, want)
+			if name, ok := s.LookupWinKey("abc"); !ok || name != "Pepper" {
+				t.Errorf("%s got key for %q, %v want Pepper", s.Node().ID(), name, ok)
+			}
+		}
+
+		response := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/players/Pepper", nil)
+		request.Header.Set(gs.IdempotencyKeyHeader, "abc")
+		gs.NewServer(lagging).ServeHTTP(response, request)
+		if response.Code != http.StatusAccepted || response.Header().Get(gs.IdempotentReplayedHeader) != "true" {
+			t.Errorf("got status %d replayed %q, want a replayed win", response.Code, response.Header().Get(gs.IdempotentReplayedHeader))
+		}
+	})
+
+	t.Run("expires keys after the window of the proposer on every node", func(t *testing.T) {
+		_, stores := newClusterWith(t, 3, func(i int) []raftstore.Option {
+			if i == 0 {
+				return []raftstore.Option{raftstore.WithIdempotencyWindow(time.Nanosecond)}
+			}
+			return nil
+		})
+		defer closeAll(stores)
+		waitLeader(t, stores)
+
+		for _, key := range []string{"short", "later"} {
+			if _, recorded, err := stores[0].TryRecordWinOnce("Pepper", key); err != nil || !recorded {
+				t.Fatalf("got %v, %v recording a win with %q", recorded, err, key)
+			}
+		}
+		for _, s := range stores {
+			waitLeague(t, s, gs.League{{Name: "Pepper", Wins: 2}})
+			if _, ok := s.LookupWinKey("short"); ok {
+				t.Errorf("%s still remembers a key past the window it was proposed with", s.Node().ID())
+			}
+		}
+	})
+
+	t.Run("ranks players as wins are recorded", func(t *testing.T) {
+		_, stores := newCluster(t, 1)
+		defer closeAll(stores)
+		waitLeader(t, stores)
+		store := stores[0]
+
+		league := gs.League{{Name: "Cleo", Wins: 3}, {Name: "Apollo", Wins: 3}, {Name: "Chris", Wins: 1}}
+		if err := store.ReplaceLeague(league); err != nil {
+			t.Fatalf("problem replacing the league, %v", err)
+		}
+		for _, name := range []string{"Chris", "Pepper", "Chris", "Pepper"} {
+			if err := store.TryRecordWins([]string{name}); err != nil {
+				t.Fatalf("problem recording win, %v", err)
+			}
+		}
+
+		want := gs.League{{Name: "Cleo", Wins: 3}, {Name: "Apollo", Wins: 3}, {Name: "Chris", Wins: 3}, {Name: "Pepper", Wins: 2}}
+		waitLeague(t, store, want)
+		for _, mode := range []gs.RankMode{gs.CompetitionRank, gs.DenseRank} {
+			for _, r := range want.Ranks(mode) {
+				if got, ok := store.GetPlayerRank(r.Name, mode); !ok || got != r {
+					t.Errorf("got %s rank %+v want %+v", mode, got, r)
+				}
+			}
+			around, _ := store.GetLeagueAround("Chris", 1, mode)
+			if wantAround := want.Ranks(mode)[1:]; !reflect.DeepEqual(around, wantAround) {
+				t.Errorf("got %s ranks %v around Chris want %v", mode, around, wantAround)
+			}
+		}
+	})
+
+	t.Run("replaces the league on every node", func(t *testing.T) {
+		_, stores := newCluster(t, 3)
+		defer closeAll(stores)
+		waitLeader(t, stores)
+		stores[0].RecordWin("Pepper")
+
+		league := gs.League{{Name: "Cleo", Wins: 3}, {Name: "Apollo", Wins: 3}}
+		if err := stores[1].ReplaceLeague(league); err != nil {
+			t.Fatalf("problem replacing the league, %v", err)
+		}
+		for _, s := range stores {
+			waitLeague(t, s, league)
+		}
+	})
+}
+
+func newCluster(t *testing.T, size int) (*raft.Network, []*raftstore.Store) {
+	t.Helper()
+	return newClusterWith(t, size, nil)
+}
+
+// newClusterWith passes the options returned by options to the store of
+// node i
+func newClusterWith(t *testing.T, size int, options func(i int) []raftstore.Option) (*raft.Network, []*raftstore.Store) {
+	t.Helper()
+	network := raft.NewNetwork()
+	var ids []string
+	for i := 0; i < size; i++ {
+		ids = append(ids, fmt.Sprintf("node-%d", i))
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	var stores []*raftstore.Store
+	for i, id := range ids {
+		peers := append(append([]string(nil), ids[:i]...), ids[i+1:]...)
+		storeOptions := []raftstore.Option{raftstore.WithLogger(logger), raftstore.WithTimeout(time.Second)}
+		if options != nil {
+			storeOptions = append(storeOptions, options(i)...)
+		}
+		store, err := raftstore.New(raft.Config{
+			ID:                id,
+			Peers:             peers,
+			Transport:         network.Transport(id),
+			ElectionTimeout:   50 * time.Millisecond,
+			HeartbeatInterval: 10 * time.Millisecond,
+			SnapshotThreshold: 3,
+		}, storeOptions...)
+		if err != nil {
+			t.Fatalf("problem starting %s, %v", id, err)
+		}
+		network.Connect(id, store.Node())
+		stores = append(stores, store)
+	}
+	return network, stores
+}
+
+// waitLeader waits for every store to know the same leader, one of them
+func waitLeader(t *testing.T, stores []*raftstore.Store) int {
+	t.Helper()
+	var leader int
+	waitFor(t, "a leader", func() bool {
+		leader = -1
+		for i, s := range stores {
+			if s.Node().Status().Role == raft.Leader {
+				leader = i
+			}
+		}
+		if leader < 0 {
+			return false
+		}
+		for _, s := range stores {
+			if s.Node().Leader() != stores[leader].Node().ID() {
+				return false
+			}
+		}
+		return true
+	})
+	return leader
+}
+
+func waitLeague(t *testing.T, store *raftstore.Store, want gs.League) {
+	t.Helper()
+	waitFor(t, fmt.Sprintf("%s to serve %v", store.Node().ID(), want), func() bool {
+		return reflect.DeepEqual(store.GetLeague(), want)
+	})
+}
+
+func waitFor(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func closeAll(stores []*raftstore.Store) {
+	for _, s := range stores {
+		s.Close()
+	}
+}
@@ -0,0 +1,225 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKeyHeader identifies clients sharing an address, e.g. behind a NAT
+const APIKeyHeader = "X-API-Key"
+
+// Clock tells the time, tests replace it with a fake one
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// RealClock is the wall clock
+var RealClock Clock = realClock{}
+
+// Limiter is a set of token buckets: each key may spend Burst tokens at
+// once, which refill at Rate tokens per second
+type Limiter struct {
+	rate  float64
+	burst float64
+	clock Clock
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter ...
+func NewLimiter(rate float64, burst int, clock Clock) *Limiter {
+	if clock == nil {
+		clock = RealClock
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		clock:   clock,
+		buckets: make(map[string]*bucket),
+		swept:   clock.Now(),
+	}
+}
+
+// Allow takes a token for key. When there is none it returns false and the
+// time until the next token
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / l.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// sweep forgets buckets that have refilled, they are as good as new ones
+func (l *Limiter) sweep(now time.Time) {
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.swept) < full {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
+
+// Cooldown allows an action for a key at most once per period
+type Cooldown struct {
+	period time.Duration
+	clock  Clock
+
+	mu    sync.Mutex
+	last  map[string]time.Time
+	swept time.Time
+}
+
+// NewCooldown ...
+func NewCooldown(period time.Duration, clock Clock) *Cooldown {
+	if clock == nil {
+		clock = RealClock
+	}
+	return &Cooldown{period: period, clock: clock, last: make(map[string]time.Time), swept: clock.Now()}
+}
+
+// Allow records the action for key unless it happened less than a period
+// ago, in which case it returns false and the time left
+func (c *Cooldown) Allow(key string) (bool, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	if last, ok := c.last[key]; ok {
+		if left := c.period - now.Sub(last); left > 0 {
+			return false, left
+		}
+	}
+
+	if now.Sub(c.swept) >= c.period {
+		for k, last := range c.last {
+			if now.Sub(last) >= c.period {
+				delete(c.last, k)
+			}
+		}
+		c.swept = now
+	}
+	c.last[key] = now
+	return true, 0
+}
+
+// Release takes back an allowed action for key that didn't happen, e.g.
+// because it failed, so a retry is allowed right away
+func (c *Cooldown) Release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.last, key)
+}
+
+// KeyFunc names the client of a request
+type KeyFunc func(r *http.Request) string
+
+// ClientKey names clients by their API key when it is one of apiKeys and
+// otherwise by their IP address, so made up keys don't get fresh buckets.
+// Behind a trusted proxy the address is taken from X-Forwarded-For
+func ClientKey(trustProxy bool, apiKeys ...string) KeyFunc {
+	known := make(map[string]bool, len(apiKeys))
+	for _, key := range apiKeys {
+		if key != "" {
+			known[key] = true
+		}
+	}
+	return func(r *http.Request) string {
+		if key := r.Header.Get(APIKeyHeader); known[key] {
+			return "key:" + key
+		}
+		if trustProxy {
+			if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+				return "ip:" + strings.TrimSpace(strings.Split(forwarded, ",")[0])
+			}
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return "ip:" + host
+	}
+}
+
+// ExemptPaths are never limited, probes and scrapers call them on a schedule
+var ExemptPaths = []string{"/healthz", "/readyz", "/metrics"}
+
+// NewHandler rejects requests of clients that exceed the limiter, except
+// for requests to ExemptPaths
+func NewHandler(next http.Handler, limiter *Limiter, key KeyFunc) http.Handler {
+	exempt := make(map[string]bool, len(ExemptPaths))
+	for _, path := range ExemptPaths {
+		exempt[path] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok, wait := limiter.Allow(key(r)); !ok {
+			TooManyRequests(w, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LimitBody rejects request bodies larger than n bytes
+func LimitBody(next http.Handler, n int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > n {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TooManyRequests replies with 429 telling the client when to retry
+func TooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "too many requests", http.StatusTooManyRequests)
+}
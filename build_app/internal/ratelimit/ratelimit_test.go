@@ -0,0 +1,177 @@
+package ratelimit_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/windnow/edusrv/internal/ratelimit"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestLimiter(t *testing.T) {
+	clock := &fakeClock{time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)}
+	limiter := ratelimit.NewLimiter(2, 3, clock)
+
+	for i := 0; i < 3; i++ {
+		assertAllowed(t, limiter.Allow, "a")
+	}
+
+	ok, wait := limiter.Allow("a")
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("got %v, %v, want denied for 500ms", ok, wait)
+	}
+
+	t.Run("keys have own buckets", func(t *testing.T) {
+		assertAllowed(t, limiter.Allow, "b")
+	})
+
+	t.Run("tokens refill", func(t *testing.T) {
+		clock.Advance(500 * time.Millisecond)
+		assertAllowed(t, limiter.Allow, "a")
+		assertDenied(t, limiter.Allow, "a")
+
+		clock.Advance(time.Hour)
+		for i := 0; i < 3; i++ {
+			assertAllowed(t, limiter.Allow, "a")
+		}
+		assertDenied(t, limiter.Allow, "a")
+	})
+}
+
+func TestCooldown(t *testing.T) {
+	clock := &fakeClock{time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)}
+	cooldown := ratelimit.NewCooldown(time.Minute, clock)
+
+	assertAllowed(t, cooldown.Allow, "Cleo")
+	assertAllowed(t, cooldown.Allow, "Chris")
+
+	clock.Advance(20 * time.Second)
+	ok, wait := cooldown.Allow("Cleo")
+	if ok || wait != 40*time.Second {
+		t.Errorf("got %v, %v, want denied for 40s", ok, wait)
+	}
+
+	clock.Advance(40 * time.Second)
+	assertAllowed(t, cooldown.Allow, "Cleo")
+
+	cooldown.Release("Cleo")
+	assertAllowed(t, cooldown.Allow, "Cleo")
+}
+
+func TestHandler(t *testing.T) {
+	clock := &fakeClock{time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)}
+	limiter := ratelimit.NewLimiter(0.1, 1, clock)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := ratelimit.NewHandler(ok, limiter, ratelimit.ClientKey(false, "secret"))
+
+	request := func(addr, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/players/Cleo", nil)
+		req.RemoteAddr = addr
+		if key != "" {
+			req.Header.Set(ratelimit.APIKeyHeader, key)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, req)
+		return response
+	}
+
+	assertStatusCode(t, request("10.0.0.1:1234", "").Code, http.StatusOK)
+
+	response := request("10.0.0.1:4321", "")
+	assertStatusCode(t, response.Code, http.StatusTooManyRequests)
+	if got := response.Header().Get("Retry-After"); got != "10" {
+		t.Errorf("got Retry-After %q, want %q", got, "10")
+	}
+
+	assertStatusCode(t, request("10.0.0.2:1234", "").Code, http.StatusOK)
+	assertStatusCode(t, request("10.0.0.1:1234", "secret").Code, http.StatusOK)
+	assertStatusCode(t, request("10.0.0.3:1234", "secret").Code, http.StatusTooManyRequests)
+	assertStatusCode(t, request("10.0.0.1:1234", "made-up").Code, http.StatusTooManyRequests)
+
+	for _, path := range ratelimit.ExemptPaths {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, req)
+		assertStatusCode(t, response.Code, http.StatusOK)
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "192.168.1.1, 10.0.0.1")
+
+	if got := ratelimit.ClientKey(false)(req); got != "ip:10.0.0.1" {
+		t.Errorf("got %q, want %q", got, "ip:10.0.0.1")
+	}
+	if got := ratelimit.ClientKey(true)(req); got != "ip:192.168.1.1" {
+		t.Errorf("got %q, want %q", got, "ip:192.168.1.1")
+	}
+
+	req.Header.Set(ratelimit.APIKeyHeader, "secret")
+	if got := ratelimit.ClientKey(false)(req); got != "ip:10.0.0.1" {
+		t.Errorf("got %q, want %q", got, "ip:10.0.0.1")
+	}
+	if got := ratelimit.ClientKey(false, "secret")(req); got != "key:secret" {
+		t.Errorf("got %q, want %q", got, "key:secret")
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	handler := ratelimit.LimitBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	}), 4)
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("1234")))
+	assertStatusCode(t, response.Code, http.StatusOK)
+
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("12345")))
+	assertStatusCode(t, response.Code, http.StatusRequestEntityTooLarge)
+
+	req := httptest.NewRequest(http.MethodPost, "/", ioutil.NopCloser(strings.NewReader("12345")))
+	req.ContentLength = -1
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, req)
+	assertStatusCode(t, response.Code, http.StatusRequestEntityTooLarge)
+}
+
+func assertAllowed(t *testing.T, allow func(string) (bool, time.Duration), key string) {
+	t.Helper()
+	if ok, wait := allow(key); !ok {
+		t.Errorf("%s denied for %v", key, wait)
+	}
+}
+
+func assertDenied(t *testing.T, allow func(string) (bool, time.Duration), key string) {
+	t.Helper()
+	if ok, _ := allow(key); ok {
+		t.Errorf("%s allowed", key)
+	}
+}
+
+func assertStatusCode(t *testing.T, got, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("did not correct status code. got %d, want %d", got, want)
+	}
+}
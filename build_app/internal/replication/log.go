@@ -0,0 +1,105 @@
+// Package replication ships the changes of a player store to followers.
+//
+// Every node keeps the latest changes of its store in a Log. A follower
+// starts from a snapshot of the database of its leader and then streams
+// the changes that follow it, applying them to its own store. Followers
+// serve reads and redirect writes to the leader until they are promoted
+package replication
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+)
+
+// DefaultLogSize is the number of changes a Log keeps by default
+const DefaultLogSize = 10000
+
+// Entry is a change of a store, the wins recorded at once
+type Entry struct {
+	Seq  uint64     `json:"seq"`
+	Wins []gs.Delta `json:"wins"`
+}
+
+// Log keeps the latest changes of a store, it is a gs.ChangeLog. Entries
+// are numbered from 1 within a log, logs are told apart by their ID
+type Log struct {
+	id   string
+	size int
+
+	mu      sync.Mutex
+	seq     uint64
+	entries []Entry
+	changed chan struct{}
+}
+
+// NewLog returns a log keeping up to size entries
+func NewLog(size int) *Log {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &Log{id: hex.EncodeToString(b), size: size, changed: make(chan struct{})}
+}
+
+// ID tells the log apart from logs of other processes
+func (l *Log) ID() string {
+	return l.id
+}
+
+// Seq returns the number of the latest entry
+func (l *Log) Seq() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq
+}
+
+// Wins adds an entry
+func (l *Log) Wins(ds []gs.Delta) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	l.entries = append(l.entries, Entry{Seq: l.seq, Wins: append([]gs.Delta(nil), ds...)})
+	if len(l.entries) >= 2*l.size {
+		l.entries = append([]Entry(nil), l.entries[len(l.entries)-l.size:]...)
+	}
+	l.notify()
+}
+
+// Reset drops the entries, followers need a new snapshot of the database
+func (l *Log) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	l.entries = nil
+	l.notify()
+}
+
+// Changed returns a channel closed on the next change
+func (l *Log) Changed() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.changed
+}
+
+func (l *Log) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// since returns the entries following seq and a channel closed on the next
+// change. ok is false when some of the entries are gone
+func (l *Log) since(seq uint64) (entries []Entry, changed <-chan struct{}, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if seq == l.seq {
+		return nil, l.changed, true
+	}
+	if seq > l.seq || len(l.entries) == 0 || seq+1 < l.entries[0].Seq {
+		return nil, nil, false
+	}
+	return l.entries[seq+1-l.entries[0].Seq:], l.changed, true
+}
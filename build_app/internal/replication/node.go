@@ -0,0 +1,396 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	"github.com/windnow/edusrv/internal/metrics"
+)
+
+const (
+	defaultRetryInterval = time.Second
+	heartbeatInterval    = 15 * time.Second
+)
+
+// errGone is returned when the leader no longer has the changes a
+// follower needs, the follower takes a new snapshot
+var errGone = errors.New("changes are gone from the leader")
+
+// Store is a store that can be replicated, *infsstore.FileSystemPlayerStore
+// is one
+type Store interface {
+	Snapshot(fn func(db gs.Database))
+	Restore(db gs.Database) error
+	Apply(ds []gs.Delta)
+}
+
+// Config configures a Node
+type Config struct {
+	Store Store
+	// Log must be passed the changes of Store
+	Log *Log
+	// Leader is the base URL of the node to follow, empty for a leader
+	Leader string
+	// Token is required from followers and to promote the node, without
+	// one the node can't be followed nor promoted
+	Token         string
+	Client        *http.Client
+	RetryInterval time.Duration
+	Logger        *slog.Logger
+}
+
+// Snapshot is the database of a node as of an entry of its log
+type Snapshot struct {
+	Log      string      `json:"log"`
+	Seq      uint64      `json:"seq"`
+	Database gs.Database `json:"database"`
+}
+
+// Status describes the role of a node
+type Status struct {
+	Role   string `json:"role"`
+	Leader string `json:"leader,omitempty"`
+	Log    string `json:"log"`
+	Seq    uint64 `json:"seq"`
+	// Following is the log and the entry of the leader a follower applied
+	FollowingLog string `json:"following_log,omitempty"`
+	FollowingSeq uint64 `json:"following_seq,omitempty"`
+}
+
+// Node serves the changes of its store under /replication/ and, while it
+// has a leader, applies the changes of the leader to its store:
+//
+//	GET  /replication/snapshot  the database and the entry it was taken at
+//	GET  /replication/log       NDJSON stream of entries after the one in
+//	                            the after parameter of the log parameter
+//	GET  /replication/status    a Status
+//	POST /replication/promote   stops following the leader
+//
+// All but the status need the Token
+type Node struct {
+	config Config
+	http.Handler
+	route func(r *http.Request) string
+
+	closed chan struct{}
+
+	mu           sync.Mutex
+	leader       string
+	cancel       context.CancelFunc
+	following    sync.WaitGroup
+	followingLog string
+	followingSeq uint64
+}
+
+// NewNode starts following the leader, if any
+func NewNode(config Config) *Node {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.RetryInterval == 0 {
+		config.RetryInterval = defaultRetryInterval
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	n := &Node{config: config, closed: make(chan struct{})}
+
+	router := http.NewServeMux()
+	// the snapshot and the log hold the whole league, and anyone promoting
+	// a node would split the cluster in two leaders
+	router.Handle("/replication/snapshot", n.authorize(http.MethodGet, n.snapshotHandler))
+	router.Handle("/replication/log", n.authorize(http.MethodGet, n.logHandler))
+	router.Handle("/replication/status", http.HandlerFunc(n.statusHandler))
+	router.Handle("/replication/promote", n.authorize(http.MethodPost, n.promoteHandler))
+	n.Handler = router
+	n.route = metrics.MuxRoute(router)
+
+	if config.Leader != "" {
+		ctx, cancel := context.WithCancel(context.Background())
+		n.leader, n.cancel = strings.TrimSuffix(config.Leader, "/"), cancel
+		n.following.Add(1)
+		go n.follow(ctx)
+	}
+	return n
+}
+
+// Route names the route serving a request, see metrics.MuxRoute
+func (n *Node) Route(r *http.Request) string {
+	return n.route(r)
+}
+
+// Leader returns the base URL of the leader, empty when the node leads
+func (n *Node) Leader() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leader
+}
+
+// Promote stops following the leader, the node accepts writes once it
+// returns
+func (n *Node) Promote() {
+	n.mu.Lock()
+	cancel := n.cancel
+	n.leader, n.cancel = "", nil
+	n.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		n.following.Wait()
+		n.config.Logger.Info("promoted to leader", "log", n.config.Log.ID(), "seq", n.config.Log.Seq())
+	}
+}
+
+// Close stops following the leader and ends the streams of followers
+func (n *Node) Close() {
+	n.mu.Lock()
+	cancel := n.cancel
+	n.cancel = nil
+	n.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		n.following.Wait()
+	}
+	close(n.closed)
+}
+
+// Guard redirects requests that may write to the leader while the node
+// follows one, the other requests are passed to next
+func (n *Node) Guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leader := n.Leader()
+		switch {
+		case leader == "",
+			r.Method == http.MethodGet, r.Method == http.MethodHead, r.Method == http.MethodOptions,
+			strings.HasPrefix(r.URL.Path, "/replication/"):
+			next.ServeHTTP(w, r)
+		default:
+			http.Redirect(w, r, leader+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+		}
+	})
+}
+
+// authorize checks the method and the token of requests. Without a token
+// configured the requests are refused
+func (n *Node) authorize(method string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if n.config.Token == "" {
+			http.Error(w, "disabled, no replication token is configured", http.StatusForbidden)
+			return
+		}
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, []byte("Bearer "+n.config.Token)) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (n *Node) snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	var err error
+	n.config.Store.Snapshot(func(db gs.Database) {
+		body, err = json.Marshal(Snapshot{Log: n.config.Log.ID(), Seq: n.config.Log.Seq(), Database: db})
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(body)
+}
+
+func (n *Node) logHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	seq, err := strconv.ParseUint(query.Get("after"), 10, 64)
+	if err != nil {
+		http.Error(w, "after must be the number of an entry", http.StatusBadRequest)
+		return
+	}
+	if query.Get("log") != n.config.Log.ID() {
+		http.Error(w, "unknown log, take a new snapshot", http.StatusGone)
+		return
+	}
+	entries, changed, ok := n.config.Log.since(seq)
+	if !ok {
+		http.Error(w, errGone.Error(), http.StatusGone)
+		return
+	}
+
+	w.Header().Set("content-type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	// middleware wrapping w unwraps to the writer that flushes
+	response := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+			seq = e.Seq
+		}
+		if err := response.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			// a blank line keeps idle connections open
+			if _, err := w.Write([]byte("\n")); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-n.closed:
+			return
+		}
+		if entries, changed, ok = n.config.Log.since(seq); !ok {
+			// the follower finds out when it reconnects
+			return
+		}
+	}
+}
+
+func (n *Node) statusHandler(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	status := Status{
+		Role:         "leader",
+		Leader:       n.leader,
+		Log:          n.config.Log.ID(),
+		Seq:          n.config.Log.Seq(),
+		FollowingLog: n.followingLog,
+		FollowingSeq: n.followingSeq,
+	}
+	n.mu.Unlock()
+	if status.Leader != "" {
+		status.Role = "follower"
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+func (n *Node) promoteHandler(w http.ResponseWriter, r *http.Request) {
+	n.Promote()
+	n.statusHandler(w, r)
+}
+
+// follow applies the changes of the leader until ctx is cancelled
+func (n *Node) follow(ctx context.Context) {
+	defer n.following.Done()
+
+	for {
+		err := n.sync(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errGone) {
+			n.config.Logger.Info("taking a new snapshot from the leader", "leader", n.Leader())
+			continue
+		}
+		n.config.Logger.Warn("problem following the leader", "leader", n.Leader(), "retry_in", n.config.RetryInterval, "error", err)
+
+		select {
+		case <-time.After(n.config.RetryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sync takes a snapshot when the node has none, then streams the changes
+// following it
+func (n *Node) sync(ctx context.Context) error {
+	n.mu.Lock()
+	leader, log, seq := n.leader, n.followingLog, n.followingSeq
+	n.mu.Unlock()
+
+	if log == "" {
+		var snap Snapshot
+		if err := n.get(ctx, leader+"/replication/snapshot", func(res *http.Response) error {
+			return json.NewDecoder(res.Body).Decode(&snap)
+		}); err != nil {
+			return fmt.Errorf("problem taking a snapshot, %v", err)
+		}
+		if err := n.config.Store.Restore(snap.Database); err != nil {
+			return err
+		}
+		log, seq = snap.Log, snap.Seq
+		n.applied(log, seq)
+	}
+
+	query := url.Values{"log": {log}, "after": {strconv.FormatUint(seq, 10)}}
+	return n.get(ctx, leader+"/replication/log?"+query.Encode(), func(res *http.Response) error {
+		dec := json.NewDecoder(res.Body)
+		for {
+			var e Entry
+			if err := dec.Decode(&e); err != nil {
+				return fmt.Errorf("problem reading changes, %v", err)
+			}
+			if e.Seq != seq+1 {
+				n.applied("", 0)
+				return fmt.Errorf("%w: got entry %d after %d", errGone, e.Seq, seq)
+			}
+			n.config.Store.Apply(e.Wins)
+			seq = e.Seq
+			n.applied(log, seq)
+		}
+	})
+}
+
+func (n *Node) applied(log string, seq uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.followingLog, n.followingSeq = log, seq
+}
+
+// get requests url from the leader, passing a successful response to read
+func (n *Node) get(ctx context.Context, url string, read func(res *http.Response) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if n.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.config.Token)
+	}
+
+	res, err := n.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return read(res)
+	case http.StatusGone:
+		n.applied("", 0)
+		return errGone
+	}
+	body := new(bytes.Buffer)
+	body.ReadFrom(res.Body)
+	return fmt.Errorf("leader replied %s, %s", res.Status, strings.TrimSpace(body.String()))
+}
@@ -0,0 +1,248 @@
+package replication_test
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gs "github.com/windnow/edusrv/internal/gameserver"
+	. "github.com/windnow/edusrv/internal/helpers"
+	fs "github.com/windnow/edusrv/internal/infsstore"
+	"github.com/windnow/edusrv/internal/replication"
+)
+
+// node is a gamelogger process: a store, its server and its replication
+type node struct {
+	store  *fs.FileSystemPlayerStore
+	log    *replication.Log
+	repl   *replication.Node
+	server *httptest.Server
+}
+
+func newNode(t *testing.T, leader string, config replication.Config) *node {
+	t.Helper()
+	database, cleanDatabase := CreateTempFile(t, "")
+	t.Cleanup(cleanDatabase)
+
+	n := &node{log: replication.NewLog(replication.DefaultLogSize)}
+	if config.Log != nil {
+		n.log = config.Log
+	}
+	var err error
+	n.store, err = fs.NewFileSystemPlayerStore(database, fs.WithChangeLog(n.log))
+	assertNoError(t, err)
+
+	config.Store, config.Log, config.Leader = n.store, n.log, leader
+	config.RetryInterval = 10 * time.Millisecond
+	n.repl = replication.NewNode(config)
+
+	// mounted behind the middleware of gamelogger, which must let the log
+	// stream through
+	server := gs.NewServer(n.store)
+	router := http.NewServeMux()
+	router.Handle("/replication/", server.Instrument(n.repl, n.repl.Route))
+	router.Handle("/", server)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	n.server = httptest.NewServer(gs.NewLoggingHandler(n.repl.Guard(router), logger))
+	t.Cleanup(func() {
+		n.repl.Close()
+		n.server.Close()
+	})
+	return n
+}
+
+func TestReplication(t *testing.T) {
+	t.Run("followers catch up and keep up", func(t *testing.T) {
+		leader := newNode(t, "", replication.Config{Token: "secret"})
+		leader.store.RecordWin("Cleo")
+		leader.store.RecordWinOnce("Chris", "key-1")
+
+		follower := newNode(t, leader.server.URL, replication.Config{Token: "secret"})
+		other := newNode(t, leader.server.URL, replication.Config{Token: "secret"})
+
+		leader.store.RecordWins([]string{"Chris", "Pepper"})
+		leader.store.RecordWin("Chris")
+
+		want := []gs.Player{{Name: "Chris", Wins: 3}, {Name: "Cleo", Wins: 1}, {Name: "Pepper", Wins: 1}}
+		for _, n := range []*node{follower, other} {
+			waitForLeague(t, n, want)
+			if name, ok := n.store.LookupWinKey("key-1"); !ok || name != "Chris" {
+				t.Errorf("got key for %q, %v want Chris", name, ok)
+			}
+		}
+		if got := getLeague(t, follower.server.URL); !reflect.DeepEqual(got, want) {
+			t.Errorf("follower served league %v want %v", got, want)
+		}
+	})
+
+	t.Run("followers redirect writes to the leader", func(t *testing.T) {
+		leader := newNode(t, "", replication.Config{Token: "secret"})
+		follower := newNode(t, leader.server.URL, replication.Config{Token: "secret"})
+
+		noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		res, err := noRedirects.Post(follower.server.URL+"/players/Cleo", "", nil)
+		assertNoError(t, err)
+		res.Body.Close()
+		assertStatusCode(t, res.StatusCode, http.StatusTemporaryRedirect)
+		if got := res.Header.Get("Location"); got != leader.server.URL+"/players/Cleo" {
+			t.Errorf("got location %q", got)
+		}
+
+		res, err = http.Post(follower.server.URL+"/wins", "application/json", strings.NewReader(`[{"name": "Cleo"}, {"name": "Chris"}]`))
+		assertNoError(t, err)
+		res.Body.Close()
+		assertStatusCode(t, res.StatusCode, http.StatusOK)
+
+		if leader.store.GetPlayerScore("Cleo") != 1 {
+			t.Errorf("the win wasn't recorded by the leader")
+		}
+		waitForLeague(t, follower, []gs.Player{{Name: "Cleo", Wins: 1}, {Name: "Chris", Wins: 1}})
+	})
+
+	t.Run("resets take a new snapshot", func(t *testing.T) {
+		leader := newNode(t, "", replication.Config{Token: "secret"})
+		leader.store.RecordWin("Cleo")
+		follower := newNode(t, leader.server.URL, replication.Config{Token: "secret"})
+		waitForLeague(t, follower, []gs.Player{{Name: "Cleo", Wins: 1}})
+
+		assertNoError(t, leader.store.ReplaceLeague(gs.League{{Name: "Pepper", Wins: 20}, {Name: "Floyd", Wins: 10}}))
+		leader.store.RecordWin("Floyd")
+
+		waitForLeague(t, follower, []gs.Player{{Name: "Pepper", Wins: 20}, {Name: "Floyd", Wins: 11}})
+	})
+
+	t.Run("entries gone from a small log", func(t *testing.T) {
+		leader := newNode(t, "", replication.Config{Token: "secret", Log: replication.NewLog(2)})
+		for i := 0; i < 5; i++ {
+			leader.store.RecordWin("Cleo")
+		}
+
+		for _, query := range []string{"log=" + leader.log.ID() + "&after=0", "log=other&after=5"} {
+			req, _ := http.NewRequest(http.MethodGet, leader.server.URL+"/replication/log?"+query, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			res, err := http.DefaultClient.Do(req)
+			assertNoError(t, err)
+			res.Body.Close()
+			assertStatusCode(t, res.StatusCode, http.StatusGone)
+		}
+
+		follower := newNode(t, leader.server.URL, replication.Config{Token: "secret"})
+		waitForLeague(t, follower, []gs.Player{{Name: "Cleo", Wins: 5}})
+	})
+
+	t.Run("promotion", func(t *testing.T) {
+		leader := newNode(t, "", replication.Config{Token: "secret"})
+		leader.store.RecordWin("Cleo")
+		follower := newNode(t, leader.server.URL, replication.Config{Token: "secret"})
+		waitForLeague(t, follower, []gs.Player{{Name: "Cleo", Wins: 1}})
+
+		res, err := http.Post(follower.server.URL+"/replication/promote", "", nil)
+		assertNoError(t, err)
+		res.Body.Close()
+		assertStatusCode(t, res.StatusCode, http.StatusUnauthorized)
+
+		req, _ := http.NewRequest(http.MethodPost, follower.server.URL+"/replication/promote", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		res, err = http.DefaultClient.Do(req)
+		assertNoError(t, err)
+		var status replication.Status
+		json.NewDecoder(res.Body).Decode(&status)
+		res.Body.Close()
+		if status.Role != "leader" || follower.repl.Leader() != "" {
+			t.Errorf("got status %+v want a leader", status)
+		}
+
+		res, err = http.Post(follower.server.URL+"/players/Chris", "", nil)
+		assertNoError(t, err)
+		res.Body.Close()
+		assertStatusCode(t, res.StatusCode, http.StatusAccepted)
+		if leader.store.GetPlayerScore("Chris") != 0 || follower.store.GetPlayerScore("Chris") != 1 {
+			t.Errorf("the win wasn't recorded by the promoted node only")
+		}
+
+		// followers of the old leader can follow the new one
+		next := newNode(t, follower.server.URL, replication.Config{Token: "secret"})
+		waitForLeague(t, next, []gs.Player{{Name: "Cleo", Wins: 1}, {Name: "Chris", Wins: 1}})
+	})
+
+	t.Run("refuses replication without a token", func(t *testing.T) {
+		leader := newNode(t, "", replication.Config{})
+		follower := newNode(t, leader.server.URL, replication.Config{})
+
+		res, err := http.Post(follower.server.URL+"/replication/promote", "", nil)
+		assertNoError(t, err)
+		res.Body.Close()
+		assertStatusCode(t, res.StatusCode, http.StatusForbidden)
+		if follower.repl.Leader() == "" {
+			t.Error("promoted a node without a token")
+		}
+
+		for _, path := range []string{"/replication/snapshot", "/replication/log?after=0"} {
+			res, err := http.Get(leader.server.URL + path)
+			assertNoError(t, err)
+			res.Body.Close()
+			assertStatusCode(t, res.StatusCode, http.StatusForbidden)
+		}
+	})
+
+	t.Run("refuses followers with another token", func(t *testing.T) {
+		leader := newNode(t, "", replication.Config{Token: "secret"})
+
+		for _, path := range []string{"/replication/snapshot", "/replication/log?after=0"} {
+			req, _ := http.NewRequest(http.MethodGet, leader.server.URL+path, nil)
+			req.Header.Set("Authorization", "Bearer guess")
+			res, err := http.DefaultClient.Do(req)
+			assertNoError(t, err)
+			res.Body.Close()
+			assertStatusCode(t, res.StatusCode, http.StatusUnauthorized)
+		}
+	})
+}
+
+func getLeague(t *testing.T, url string) (league []gs.Player) {
+	t.Helper()
+	res, err := http.Get(url + "/league")
+	assertNoError(t, err)
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(&league); err != nil {
+		t.Fatalf("Unable to parse league, %v", err)
+	}
+	return league
+}
+
+func waitForLeague(t *testing.T, n *node, want []gs.Player) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := n.store.GetLeague()
+		if reflect.DeepEqual([]gs.Player(got), want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got league %v want %v", got, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func assertStatusCode(t testing.TB, got, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("did not get correct status, got %d, want %d", got, want)
+	}
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("didn't expect an error but got one, %v", err)
+	}
+}
@@ -1,6 +1,9 @@
 package tape
 
-import "os"
+import (
+	"io"
+	"os"
+)
 
 // Tape ...
 type Tape struct {
@@ -12,3 +15,15 @@ func (t *Tape) Write(p []byte) (n int, err error) {
 	t.File.Seek(0, 0)
 	return t.File.Write(p)
 }
+
+// Appender writes to the end of the file whatever its current offset is
+type Appender struct {
+	File *os.File
+}
+
+func (a *Appender) Write(p []byte) (n int, err error) {
+	if _, err := a.File.Seek(0, io.SeekEnd); err != nil {
+		return 0, err
+	}
+	return a.File.Write(p)
+}
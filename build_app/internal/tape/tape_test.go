@@ -24,3 +24,22 @@ func TestTape_Write(t *testing.T) {
 		t.Errorf("got %q, want %q", got, want)
 	}
 }
+
+func TestAppender_Write(t *testing.T) {
+	file, clean := CreateTempFile(t, "12345")
+	defer clean()
+
+	appender := &Appender{file}
+
+	file.Seek(0, 0)
+	appender.Write([]byte("abc"))
+	file.Seek(0, 0)
+	newFileContent, _ := ioutil.ReadAll(file)
+
+	got := string(newFileContent)
+	want := "12345abc"
+
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
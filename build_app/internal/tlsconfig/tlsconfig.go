@@ -0,0 +1,197 @@
+// Package tlsconfig builds the TLS configuration of the game server, from
+// certificate files reloaded when they change or from a self-signed
+// certificate for development
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Config describes where certificates come from
+type Config struct {
+	// CertFile and KeyFile hold a PEM encoded certificate and its key
+	CertFile, KeyFile string
+	// ReloadInterval is how often the files are checked for changes, at
+	// handshakes, zero checks at every handshake
+	ReloadInterval time.Duration
+	// Dev generates a self-signed certificate for Hosts instead of reading
+	// the files
+	Dev   bool
+	Hosts []string
+	// MinVersion is the oldest version accepted, TLS 1.2 by default
+	MinVersion uint16
+	Logger     *slog.Logger
+}
+
+// New returns a TLS configuration serving HTTP/2 and HTTP/1.1
+func New(c Config) (*tls.Config, error) {
+	if c.MinVersion == 0 {
+		c.MinVersion = tls.VersionTLS12
+	}
+	config := &tls.Config{
+		MinVersion: c.MinVersion,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	if c.Dev {
+		cert, err := SelfSigned(c.Hosts, 24*time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+		return config, nil
+	}
+
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("a certificate and a key file are required")
+	}
+	reloader, err := NewReloader(c.CertFile, c.KeyFile, c.ReloadInterval, c.Logger)
+	if err != nil {
+		return nil, err
+	}
+	config.GetCertificate = reloader.GetCertificate
+	return config, nil
+}
+
+// ParseVersion parses a TLS version such as 1.2
+func ParseVersion(s string) (uint16, error) {
+	switch s {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q, want 1.0, 1.1, 1.2 or 1.3", s)
+}
+
+// Reloader serves a certificate from files, loading it again when the
+// files are modified, so certificates can be renewed without a restart
+type Reloader struct {
+	certFile, keyFile string
+	interval          time.Duration
+	logger            *slog.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// NewReloader loads the certificate, failing when it can't be read. Later
+// failures keep the previous certificate and are logged
+func NewReloader(certFile, keyFile string, interval time.Duration, logger *slog.Logger) (*Reloader, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	r := &Reloader{certFile: certFile, keyFile: keyFile, interval: interval, logger: logger}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate is meant for tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.checked) >= r.interval {
+		r.checked = now
+		if modTime, err := r.lastModified(); err == nil && !modTime.Equal(r.modTime) {
+			if err := r.load(); err != nil {
+				r.logger.Error("problem reloading certificate", "cert", r.certFile, "error", err)
+			} else {
+				r.logger.Info("reloaded certificate", "cert", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+func (r *Reloader) load() error {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("problem loading certificate %s, %v", r.certFile, err)
+	}
+	r.cert, r.modTime = &cert, modTime
+	return nil
+}
+
+// lastModified returns the latest modification time of the files
+func (r *Reloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("problem getting file info from file %s, %v", name, err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// SelfSigned generates a certificate for hosts, names or IP addresses,
+// valid from now on for the given duration
+func SelfSigned(hosts []string, validFor time.Duration) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("problem generating key, %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("problem generating serial number, %v", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"gamelogger development"}},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("problem creating certificate, %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
@@ -0,0 +1,137 @@
+package tlsconfig_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/windnow/edusrv/internal/tlsconfig"
+)
+
+func TestTLS(t *testing.T) {
+	t.Run("dev mode serves HTTP/2 with a self-signed certificate", func(t *testing.T) {
+		config, err := tlsconfig.New(tlsconfig.Config{Dev: true, Hosts: []string{"127.0.0.1", "localhost"}})
+		assertNoError(t, err)
+		server := newTLSServer(config)
+		defer server.Close()
+
+		client := newClient(config.Certificates[0].Leaf, 0)
+		response, err := client.Get(server.URL)
+		assertNoError(t, err)
+		response.Body.Close()
+
+		if response.ProtoMajor != 2 {
+			t.Errorf("got protocol %s want HTTP/2", response.Proto)
+		}
+	})
+
+	t.Run("reloads changed certificate files", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		first := writeCertificate(t, certFile, keyFile, time.Now().Add(-time.Hour))
+
+		config, err := tlsconfig.New(tlsconfig.Config{CertFile: certFile, KeyFile: keyFile})
+		assertNoError(t, err)
+		server := newTLSServer(config)
+		defer server.Close()
+
+		assertServes(t, server.URL, first)
+
+		second := writeCertificate(t, certFile, keyFile, time.Now())
+		assertServes(t, server.URL, second)
+	})
+
+	t.Run("refuses versions older than the minimum", func(t *testing.T) {
+		config, err := tlsconfig.New(tlsconfig.Config{Dev: true, Hosts: []string{"127.0.0.1"}, MinVersion: tls.VersionTLS13})
+		assertNoError(t, err)
+		server := newTLSServer(config)
+		defer server.Close()
+
+		client := newClient(config.Certificates[0].Leaf, tls.VersionTLS12)
+		if _, err := client.Get(server.URL); err == nil {
+			t.Error("expected an error but didn't get one")
+		}
+	})
+
+	t.Run("needs certificate files", func(t *testing.T) {
+		_, err := tlsconfig.New(tlsconfig.Config{CertFile: "missing.pem", KeyFile: "missing.key"})
+		if err == nil {
+			t.Error("expected an error but didn't get one")
+		}
+	})
+}
+
+func TestParseVersion(t *testing.T) {
+	got, err := tlsconfig.ParseVersion("1.3")
+	assertNoError(t, err)
+	if got != tls.VersionTLS13 {
+		t.Errorf("got %x want %x", got, tls.VersionTLS13)
+	}
+
+	if _, err := tlsconfig.ParseVersion("3"); err == nil {
+		t.Error("expected an error but didn't get one")
+	}
+}
+
+func newTLSServer(config *tls.Config) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = true
+	server.TLS = config
+	server.StartTLS()
+	if config.GetCertificate != nil {
+		// StartTLS adds its own certificate when there are none, which
+		// takes precedence over GetCertificate
+		server.TLS.Certificates = nil
+	}
+	return server
+}
+
+func newClient(cert *x509.Certificate, maxVersion uint16) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool, MaxVersion: maxVersion},
+		ForceAttemptHTTP2: true,
+	}}
+}
+
+// writeCertificate writes a new self-signed certificate, modified at the
+// given time, and returns it
+func writeCertificate(t *testing.T, certFile, keyFile string, modTime time.Time) *x509.Certificate {
+	t.Helper()
+	cert, err := tlsconfig.SelfSigned([]string{"127.0.0.1"}, time.Hour)
+	assertNoError(t, err)
+	key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	assertNoError(t, err)
+
+	assertNoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600))
+	assertNoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600))
+	assertNoError(t, os.Chtimes(certFile, modTime, modTime))
+	assertNoError(t, os.Chtimes(keyFile, modTime, modTime))
+	return cert.Leaf
+}
+
+func assertServes(t *testing.T, url string, want *x509.Certificate) {
+	t.Helper()
+	response, err := newClient(want, 0).Get(url)
+	assertNoError(t, err)
+	response.Body.Close()
+
+	if got := response.TLS.PeerCertificates[0]; !got.Equal(want) {
+		t.Errorf("got certificate %v want %v", got.SerialNumber, want.SerialNumber)
+	}
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("didn't expect an error but got one, %v", err)
+	}
+}
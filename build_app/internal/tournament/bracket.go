@@ -0,0 +1,201 @@
+package tournament
+
+// seeding returns the seeds of the first round of a bracket of size players,
+// paired so the best seeds meet as late as possible
+func seeding(size int) []int {
+	order := []int{0}
+	for len(order) < size {
+		n := len(order) * 2
+		next := make([]int, 0, n)
+		for _, s := range order {
+			next = append(next, s, n-1-s)
+		}
+		order = next
+	}
+	return order
+}
+
+// winnersBracket creates the rounds of a knockout bracket big enough for
+// all players, the winner of each match plays the next round
+func (t *Tournament) winnersBracket() [][]*Match {
+	size := 2
+	for size < len(t.Players) {
+		size *= 2
+	}
+
+	var rounds [][]*Match
+	for n, round := size/2, 1; n >= 1; n, round = n/2, round+1 {
+		matches := make([]*Match, n)
+		for i := range matches {
+			matches[i] = t.newMatch(Winners, round)
+		}
+		if round > 1 {
+			for i, m := range rounds[len(rounds)-1] {
+				m.WinnerTo = &Slot{matches[i/2].ID, i % 2}
+			}
+		}
+		rounds = append(rounds, matches)
+	}
+	return rounds
+}
+
+// seed puts the players into the first round, seeds missing from a full
+// bracket are byes
+func (t *Tournament) seed(rounds [][]*Match) {
+	order := seeding(len(rounds[0]) * 2)
+	for i, m := range rounds[0] {
+		for side := 0; side < 2; side++ {
+			player := ""
+			if s := order[2*i+side]; s < len(t.Players) {
+				player = t.Players[s]
+			}
+			t.fill(&Slot{m.ID, side}, player)
+		}
+	}
+}
+
+// doubleElimination adds a losers bracket to the winners bracket. Losers
+// of the first round play each other, losers of later rounds drop into the
+// losers bracket in reverse order to put off rematches
+func (t *Tournament) doubleElimination() [][]*Match {
+	winners := t.winnersBracket()
+	final := winners[len(winners)-1][0]
+
+	grandFinal := t.newMatch(GrandFinal, 1)
+	t.newMatch(GrandFinal, 2)
+	final.WinnerTo = &Slot{grandFinal.ID, 0}
+	if len(winners) == 1 {
+		final.LoserTo = &Slot{grandFinal.ID, 1}
+		return winners
+	}
+
+	round := 1
+	losers := t.losersRound(round, len(winners[0])/2)
+	for i, m := range winners[0] {
+		m.LoserTo = &Slot{losers[i/2].ID, i % 2}
+	}
+	for j := 1; j < len(winners); j++ {
+		round++
+		drop := t.losersRound(round, len(winners[j]))
+		for i, m := range losers {
+			m.WinnerTo = &Slot{drop[i].ID, 0}
+		}
+		for i, m := range winners[j] {
+			m.LoserTo = &Slot{drop[len(drop)-1-i].ID, 1}
+		}
+		losers = drop
+
+		if j < len(winners)-1 {
+			round++
+			next := t.losersRound(round, len(losers)/2)
+			for i, m := range losers {
+				m.WinnerTo = &Slot{next[i/2].ID, i % 2}
+			}
+			losers = next
+		}
+	}
+	losers[0].WinnerTo = &Slot{grandFinal.ID, 1}
+	return winners
+}
+
+func (t *Tournament) losersRound(round, n int) []*Match {
+	matches := make([]*Match, n)
+	for i := range matches {
+		matches[i] = t.newMatch(Losers, round)
+	}
+	return matches
+}
+
+// roundRobin pairs every player with every other one using the circle
+// method, a player sits out each round when their number is odd
+func (t *Tournament) roundRobin() {
+	seats := make([]int, len(t.Players))
+	for i := range seats {
+		seats[i] = i
+	}
+	if len(seats)%2 == 1 {
+		seats = append(seats, -1)
+	}
+
+	n := len(seats)
+	for round := 1; round < n; round++ {
+		for i := 0; i < n/2; i++ {
+			a, b := seats[i], seats[n-1-i]
+			if a < 0 || b < 0 {
+				continue
+			}
+			m := t.newMatch("", round)
+			m.Players = [2]string{t.Players[a], t.Players[b]}
+			m.Decided = [2]bool{true, true}
+		}
+		seats = append([]int{seats[0], seats[n-1]}, seats[1:n-1]...)
+	}
+}
+
+// pairSwiss creates the next round of a Swiss tournament. The first round
+// pairs the top half of the seeds with the bottom half, later rounds pair
+// players with the next one by score they haven't played yet, falling back
+// to a rematch when no one is left. With an odd number of players the
+// lowest player without a bye gets one
+func (t *Tournament) pairSwiss() {
+	round := t.round() + 1
+
+	var order []string
+	if round == 1 {
+		order = append(order, t.Players...)
+	} else {
+		for _, s := range t.Standings() {
+			order = append(order, s.Player)
+		}
+	}
+
+	played := make(map[[2]string]bool)
+	byes := make(map[string]bool)
+	for _, m := range t.Matches {
+		if m.Players[1] == "" {
+			byes[m.Players[0]] = true
+		}
+		played[m.Players] = true
+		played[[2]string{m.Players[1], m.Players[0]}] = true
+	}
+
+	if len(order)%2 == 1 {
+		bye := len(order) - 1
+		for bye > 0 && byes[order[bye]] {
+			bye--
+		}
+		m := t.newMatch("", round)
+		m.Players, m.Decided = [2]string{order[bye], ""}, [2]bool{true, true}
+		m.Done, m.Winner = true, order[bye]
+		order = without(order, bye)
+	}
+
+	if round == 1 {
+		half := len(order) / 2
+		for i := 0; i < half; i++ {
+			t.pair(round, order[i], order[half+i])
+		}
+		return
+	}
+
+	for len(order) > 0 {
+		opponent := 1
+		for j := 1; j < len(order); j++ {
+			if !played[[2]string{order[0], order[j]}] {
+				opponent = j
+				break
+			}
+		}
+		t.pair(round, order[0], order[opponent])
+		order = without(without(order, opponent), 0)
+	}
+}
+
+func (t *Tournament) pair(round int, a, b string) {
+	m := t.newMatch("", round)
+	m.Players, m.Decided = [2]string{a, b}, [2]bool{true, true}
+}
+
+func without(players []string, i int) []string {
+	return append(append([]string(nil), players[:i]...), players[i+1:]...)
+}
@@ -0,0 +1,135 @@
+package tournament
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/windnow/edusrv/internal/metrics"
+)
+
+// Result is the body of a request recording the winner of a match
+type Result struct {
+	Winner string `json:"winner"`
+}
+
+// Handler serves /tournaments:
+//
+//	GET  /tournaments                      lists the tournaments
+//	POST /tournaments                      creates one from a Spec
+//	GET  /tournaments/{id}                 shows its matches and standings
+//	POST /tournaments/{id}/matches/{match} records a Result
+type Handler struct {
+	manager *Manager
+	http.Handler
+	route func(r *http.Request) string
+}
+
+// NewHandler ...
+func NewHandler(manager *Manager) *Handler {
+	h := new(Handler)
+	h.manager = manager
+
+	router := http.NewServeMux()
+	router.Handle("/tournaments", http.HandlerFunc(h.tournamentsHandler))
+	router.Handle("/tournaments/", http.HandlerFunc(h.tournamentHandler))
+
+	h.Handler = router
+	h.route = metrics.MuxRoute(router)
+
+	return h
+}
+
+// Route names the route serving a request, see metrics.MuxRoute
+func (h *Handler) Route(r *http.Request) string {
+	return h.route(r)
+}
+
+func (h *Handler) tournamentsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(h.manager.List())
+	case http.MethodPost:
+		var spec Spec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			http.Error(w, fmt.Sprintf("problem parsing tournament, %v", err), http.StatusBadRequest)
+			return
+		}
+		state, err := h.manager.Create(spec)
+		if errors.Is(err, ErrInvalidSpec) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if errors.Is(err, ErrTooManyOpen) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("content-type", "application/json")
+		w.Header().Set("Location", "/tournaments/"+state.ID)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(state)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) tournamentHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/tournaments/"), "/")
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		state, err := h.manager.Get(parts[0])
+		h.reply(w, http.StatusOK, state, err)
+	case len(parts) == 3 && parts[1] == "matches" && r.Method == http.MethodPost:
+		match, err := strconv.Atoi(parts[2])
+		if err != nil {
+			http.Error(w, ErrUnknownMatch.Error(), http.StatusNotFound)
+			return
+		}
+		var result Result
+		if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+			http.Error(w, fmt.Sprintf("problem parsing result, %v", err), http.StatusBadRequest)
+			return
+		}
+		state, err := h.manager.Record(parts[0], match, result.Winner)
+		h.reply(w, http.StatusOK, state, err)
+	case len(parts) == 1 || len(parts) == 3 && parts[1] == "matches":
+		allow := "GET"
+		if len(parts) == 3 {
+			allow = "POST"
+		}
+		w.Header().Set("Allow", allow)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) reply(w http.ResponseWriter, status int, state State, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownTournament), errors.Is(err, ErrUnknownMatch):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrMatchPlayed), errors.Is(err, ErrMatchNotReady):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrNotInMatch):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, ErrWinNotRecorded):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(state)
+	}
+}
@@ -0,0 +1,244 @@
+package tournament
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrUnknownTournament is returned for ids of no tournament
+var ErrUnknownTournament = errors.New("unknown tournament")
+
+// ErrTooManyOpen is returned by Create while MaxOpen tournaments are not
+// finished
+var ErrTooManyOpen = errors.New("too many open tournaments")
+
+// ErrWinNotRecorded is returned by Record when the recorder fails, the
+// match is left to be played
+var ErrWinNotRecorded = errors.New("problem recording win")
+
+// MaxOpen is the number of tournaments that may be played at once, all of
+// them are rewritten with every result
+const MaxOpen = 100
+
+// Recorder records the wins of players in the league, failing when the
+// store can't record them
+type Recorder interface {
+	RecordWin(name string) error
+}
+
+// RecorderFunc adapts a function to a Recorder
+type RecorderFunc func(name string) error
+
+// RecordWin calls fn(name)
+func (fn RecorderFunc) RecordWin(name string) error {
+	return fn(name)
+}
+
+// State is a tournament along with the standings of its players
+type State struct {
+	*Tournament
+	Standings []Standing `json:"standings"`
+}
+
+// Manager keeps the tournaments in a file and records the winners of their
+// matches
+type Manager struct {
+	mu          sync.Mutex
+	file        string
+	recorder    Recorder
+	tournaments []*Tournament
+	now         func() time.Time
+
+	// beat counts the matches a player won against another one. It has its
+	// own lock as stores read it while holding theirs
+	beatMu sync.RWMutex
+	beat   map[[2]string]int
+}
+
+// NewManager loads the tournaments kept in file, which is created with the
+// first tournament
+func NewManager(file string, recorder Recorder) (*Manager, error) {
+	m := &Manager{file: file, recorder: recorder, now: time.Now, beat: make(map[[2]string]int)}
+
+	content, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("problem reading tournaments, %v", err)
+	}
+	if err := json.Unmarshal(content, &m.tournaments); err != nil {
+		return nil, fmt.Errorf("problem parsing tournaments %s, %v", file, err)
+	}
+	for _, t := range m.tournaments {
+		for _, match := range t.Matches {
+			m.count(match)
+		}
+	}
+	return m, nil
+}
+
+// HeadToHead returns the matches a won against b minus the ones b won
+// against a, see gs.HeadToHeadRecord
+func (m *Manager) HeadToHead(a, b string) int {
+	m.beatMu.RLock()
+	defer m.beatMu.RUnlock()
+	return m.beat[[2]string{a, b}] - m.beat[[2]string{b, a}]
+}
+
+// count adds a played match to the head to head record
+func (m *Manager) count(match *Match) {
+	if !match.played() {
+		return
+	}
+	loser := match.Players[0]
+	if loser == match.Winner {
+		loser = match.Players[1]
+	}
+	m.beatMu.Lock()
+	m.beat[[2]string{match.Winner, loser}]++
+	m.beatMu.Unlock()
+}
+
+// Create starts a tournament
+func (m *Manager) Create(spec Spec) (State, error) {
+	t, err := New(spec)
+	if err != nil {
+		return State{}, err
+	}
+	t.ID, t.Created = newID(), m.now().UTC()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	open := 0
+	for _, t := range m.tournaments {
+		if !t.Finished {
+			open++
+		}
+	}
+	if open >= MaxOpen {
+		return State{}, fmt.Errorf("%w, finish one of the %d first", ErrTooManyOpen, open)
+	}
+	m.tournaments = append(m.tournaments, t)
+	if err := m.save(); err != nil {
+		m.tournaments = m.tournaments[:len(m.tournaments)-1]
+		return State{}, err
+	}
+	return state(t), nil
+}
+
+// List returns the tournaments by creation, without their matches
+func (m *Manager) List() []Tournament {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tournaments := make([]Tournament, len(m.tournaments))
+	for i, t := range m.tournaments {
+		tournaments[i] = *t
+		tournaments[i].Players = append([]string(nil), t.Players...)
+		tournaments[i].Matches = nil
+	}
+	return tournaments
+}
+
+// Get returns a tournament
+func (m *Manager) Get(id string) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.find(id)
+	if t == nil {
+		return State{}, ErrUnknownTournament
+	}
+	return state(t), nil
+}
+
+// Record sets the winner of a match and records the win in the league
+func (m *Manager) Record(id string, match int, winner string) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.find(id)
+	if t == nil {
+		return State{}, ErrUnknownTournament
+	}
+
+	previous := t.clone()
+	if err := t.Record(match, winner); err != nil {
+		return State{}, err
+	}
+	played := m.now().UTC()
+	t.Match(match).Played = &played
+	if err := m.save(); err != nil {
+		*t = *previous
+		return State{}, err
+	}
+	if err := m.recorder.RecordWin(winner); err != nil {
+		*t = *previous
+		if saveErr := m.save(); saveErr != nil {
+			err = fmt.Errorf("%v, and %v", err, saveErr)
+		}
+		return State{}, fmt.Errorf("%w, %v", ErrWinNotRecorded, err)
+	}
+	m.count(t.Match(match))
+	return state(t), nil
+}
+
+// PlayedSince returns the pairs of players who played a match of a
+// tournament since the given time, see gs.MatchHistory
+func (m *Manager) PlayedSince(since time.Time) [][2]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pairs [][2]string
+	for _, t := range m.tournaments {
+		for _, match := range t.Matches {
+			if match.played() && match.Played != nil && !match.Played.Before(since) {
+				pairs = append(pairs, match.Players)
+			}
+		}
+	}
+	return pairs
+}
+
+func (m *Manager) find(id string) *Tournament {
+	for _, t := range m.tournaments {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// save writes the tournaments, m.mu must be held
+func (m *Manager) save() error {
+	content, err := json.Marshal(m.tournaments)
+	if err != nil {
+		return err
+	}
+	tmp := m.file + ".tmp"
+	if err := os.WriteFile(tmp, content, 0666); err != nil {
+		return fmt.Errorf("problem writing tournaments, %v", err)
+	}
+	if err := os.Rename(tmp, m.file); err != nil {
+		return fmt.Errorf("problem writing tournaments, %v", err)
+	}
+	return nil
+}
+
+// state copies the tournament, so it can be encoded without holding m.mu
+func state(t *Tournament) State {
+	return State{Tournament: t.clone(), Standings: t.Standings()}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
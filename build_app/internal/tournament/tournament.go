@@ -0,0 +1,366 @@
+// Package tournament runs knockout, round-robin and Swiss tournaments
+// between players of the league
+package tournament
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format is the way players of a tournament are paired
+type Format string
+
+// Supported formats
+const (
+	SingleElimination Format = "single-elimination"
+	// DoubleElimination ends with a grand final, played twice when the
+	// winner of the losers bracket wins the first one
+	DoubleElimination Format = "double-elimination"
+	RoundRobin        Format = "round-robin"
+	Swiss             Format = "swiss"
+)
+
+// Formats lists the supported formats
+var Formats = []Format{SingleElimination, DoubleElimination, RoundRobin, Swiss}
+
+// Bracket tells the part of an elimination tournament a match belongs to
+type Bracket string
+
+// Brackets of elimination tournaments
+const (
+	Winners    Bracket = "winners"
+	Losers     Bracket = "losers"
+	GrandFinal Bracket = "grand-final"
+)
+
+const (
+	maxPlayers    = 1024
+	maxNameLength = 255
+	// every player of a round robin meets every other, 64 players play
+	// 2016 matches
+	maxRoundRobinPlayers = 64
+)
+
+// ErrInvalidSpec is returned by New for specs it can't create a tournament
+// from
+var ErrInvalidSpec = errors.New("invalid tournament")
+
+// Errors returned when recording a result
+var (
+	ErrUnknownMatch  = errors.New("unknown match")
+	ErrMatchPlayed   = errors.New("match already played")
+	ErrMatchNotReady = errors.New("players of the match are not known yet")
+	ErrNotInMatch    = errors.New("winner doesn't play in the match")
+)
+
+// Slot is a side of a match
+type Slot struct {
+	Match int `json:"match"`
+	Side  int `json:"side"`
+}
+
+// Match is a game between two players. A side that is decided without a
+// player is a bye, the other player goes through without playing
+type Match struct {
+	ID       int        `json:"id"`
+	Bracket  Bracket    `json:"bracket,omitempty"`
+	Round    int        `json:"round"`
+	Players  [2]string  `json:"players"`
+	Decided  [2]bool    `json:"decided"`
+	Done     bool       `json:"done"`
+	Winner   string     `json:"winner,omitempty"`
+	Played   *time.Time `json:"played,omitempty"`
+	WinnerTo *Slot      `json:"winner_to,omitempty"`
+	LoserTo  *Slot      `json:"loser_to,omitempty"`
+}
+
+// Ready tells whether the match waits for its result
+func (m *Match) Ready() bool {
+	return !m.Done && m.Decided[0] && m.Decided[1] && m.Players[0] != "" && m.Players[1] != ""
+}
+
+func (m *Match) loser() string {
+	if m.Winner == m.Players[0] {
+		return m.Players[1]
+	}
+	return m.Players[0]
+}
+
+// played tells whether the match was won over an opponent, not by a bye
+func (m *Match) played() bool {
+	return m.Done && m.Players[0] != "" && m.Players[1] != ""
+}
+
+// Spec describes a tournament to create. Players are listed by seed, the
+// best first
+type Spec struct {
+	Name    string   `json:"name"`
+	Format  Format   `json:"format"`
+	Players []string `json:"players"`
+	// Rounds of a Swiss tournament, enough to find a single winner by default
+	Rounds int `json:"rounds,omitempty"`
+}
+
+// Tournament is a set of matches between players
+type Tournament struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Format   Format    `json:"format"`
+	Players  []string  `json:"players"`
+	Rounds   int       `json:"rounds,omitempty"`
+	Created  time.Time `json:"created"`
+	Finished bool      `json:"finished"`
+	Matches  []*Match  `json:"matches"`
+}
+
+// Standing is the result of a player in a tournament
+type Standing struct {
+	Place  int    `json:"place"`
+	Player string `json:"player"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+	Byes   int    `json:"byes,omitempty"`
+}
+
+// New creates a tournament and the matches known from the start
+func New(spec Spec) (*Tournament, error) {
+	if err := validate(&spec); err != nil {
+		return nil, fmt.Errorf("%w, %v", ErrInvalidSpec, err)
+	}
+
+	t := &Tournament{
+		Name:    spec.Name,
+		Format:  spec.Format,
+		Players: spec.Players,
+		Rounds:  spec.Rounds,
+	}
+	switch t.Format {
+	case SingleElimination:
+		t.seed(t.winnersBracket())
+	case DoubleElimination:
+		t.seed(t.doubleElimination())
+	case RoundRobin:
+		t.roundRobin()
+	case Swiss:
+		t.pairSwiss()
+	}
+	return t, nil
+}
+
+func validate(spec *Spec) error {
+	if strings.TrimSpace(spec.Name) == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+
+	known := false
+	for _, f := range Formats {
+		known = known || spec.Format == f
+	}
+	if !known {
+		return fmt.Errorf("unknown format %q, want one of %v", spec.Format, Formats)
+	}
+
+	if len(spec.Players) < 2 || len(spec.Players) > maxPlayers {
+		return fmt.Errorf("a tournament needs from 2 to %d players", maxPlayers)
+	}
+	if spec.Format == RoundRobin && len(spec.Players) > maxRoundRobinPlayers {
+		return fmt.Errorf("a %s tournament takes at most %d players", RoundRobin, maxRoundRobinPlayers)
+	}
+	seen := make(map[string]bool, len(spec.Players))
+	for _, p := range spec.Players {
+		if p == "" || len(p) > maxNameLength {
+			return fmt.Errorf("player names must have from 1 to %d bytes", maxNameLength)
+		}
+		if seen[p] {
+			return fmt.Errorf("player %q is listed twice", p)
+		}
+		seen[p] = true
+	}
+
+	if spec.Format != Swiss {
+		if spec.Rounds != 0 {
+			return fmt.Errorf("rounds can only be set for %s tournaments", Swiss)
+		}
+		return nil
+	}
+	if spec.Rounds == 0 {
+		for n := 1; n < len(spec.Players); n *= 2 {
+			spec.Rounds++
+		}
+	}
+	if spec.Rounds < 1 || spec.Rounds >= len(spec.Players) {
+		return fmt.Errorf("rounds must be from 1 to %d", len(spec.Players)-1)
+	}
+	return nil
+}
+
+// Match returns the match with the given id
+func (t *Tournament) Match(id int) *Match {
+	if id < 1 || id > len(t.Matches) {
+		return nil
+	}
+	return t.Matches[id-1]
+}
+
+// Record sets the winner of a match, moving players on in the bracket
+func (t *Tournament) Record(id int, winner string) error {
+	m := t.Match(id)
+	switch {
+	case m == nil:
+		return ErrUnknownMatch
+	case m.Done:
+		return ErrMatchPlayed
+	case !m.Ready():
+		return ErrMatchNotReady
+	case winner == "" || (winner != m.Players[0] && winner != m.Players[1]):
+		return ErrNotInMatch
+	}
+
+	m.Done, m.Winner = true, winner
+	t.advance(m)
+
+	done := true
+	for _, m := range t.Matches {
+		done = done && m.Done
+	}
+	if done && t.Format == Swiss && t.round() < t.Rounds {
+		t.pairSwiss()
+		done = false
+	}
+	t.Finished = done
+	return nil
+}
+
+func (t *Tournament) newMatch(bracket Bracket, round int) *Match {
+	m := &Match{ID: len(t.Matches) + 1, Bracket: bracket, Round: round}
+	t.Matches = append(t.Matches, m)
+	return m
+}
+
+// fill puts a player, or nobody for a bye, on a side of a match
+func (t *Tournament) fill(slot *Slot, player string) {
+	m := t.Match(slot.Match)
+	m.Players[slot.Side], m.Decided[slot.Side] = player, true
+	if m.Done || !m.Decided[0] || !m.Decided[1] || (m.Players[0] != "" && m.Players[1] != "") {
+		return
+	}
+
+	// one of the sides is a bye, or both are
+	m.Done, m.Winner = true, m.Players[0]+m.Players[1]
+	t.advance(m)
+}
+
+// advance moves the players of a finished match on
+func (t *Tournament) advance(m *Match) {
+	if m.Bracket == GrandFinal && m.Round == 1 {
+		reset := t.Match(m.ID + 1)
+		if m.Winner == m.Players[0] {
+			// the winner of the winners bracket hasn't lost yet
+			t.fill(&Slot{reset.ID, 0}, "")
+			t.fill(&Slot{reset.ID, 1}, "")
+		} else {
+			t.fill(&Slot{reset.ID, 0}, m.Players[0])
+			t.fill(&Slot{reset.ID, 1}, m.Players[1])
+		}
+		return
+	}
+
+	if m.WinnerTo != nil {
+		t.fill(m.WinnerTo, m.Winner)
+	}
+	if m.LoserTo != nil {
+		t.fill(m.LoserTo, m.loser())
+	}
+}
+
+// round returns the latest round with matches
+func (t *Tournament) round() int {
+	if len(t.Matches) == 0 {
+		return 0
+	}
+	return t.Matches[len(t.Matches)-1].Round
+}
+
+// Standings returns the players by their place. Players knocked out in the
+// same round share a place, as do players with as many wins in round-robin
+// and Swiss tournaments, byes counting as wins. Ties are listed by seed
+func (t *Tournament) Standings() []Standing {
+	seed := make(map[string]int, len(t.Players))
+	standings := make([]Standing, len(t.Players))
+	for i, p := range t.Players {
+		seed[p] = i
+		standings[i].Player = p
+	}
+
+	// key orders standings, the higher the better
+	key := make([]int, len(t.Players))
+	lives := 1
+	if t.Format == DoubleElimination {
+		lives = 2
+	}
+	for _, m := range t.Matches {
+		if !m.Done || m.Winner == "" {
+			continue
+		}
+		winner := &standings[seed[m.Winner]]
+		if !m.played() {
+			winner.Byes++
+			continue
+		}
+		winner.Wins++
+		loser := &standings[seed[m.loser()]]
+		loser.Losses++
+
+		if t.Format == SingleElimination || t.Format == DoubleElimination {
+			if loser.Losses == lives {
+				key[seed[loser.Player]] = stage(m) - 1<<20
+			}
+		}
+	}
+	if t.Format == RoundRobin || t.Format == Swiss {
+		for i, s := range standings {
+			key[i] = s.Wins + s.Byes
+		}
+	}
+
+	order := make([]int, len(standings))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return key[order[i]] > key[order[j]]
+	})
+
+	sorted := make([]Standing, len(standings))
+	for i, s := range order {
+		sorted[i] = standings[s]
+		sorted[i].Place = i + 1
+		if i > 0 && key[s] == key[order[i-1]] {
+			sorted[i].Place = sorted[i-1].Place
+		}
+	}
+	return sorted
+}
+
+// stage orders the rounds of elimination tournaments, players knocked out
+// in a later stage take a better place
+func stage(m *Match) int {
+	if m.Bracket == GrandFinal {
+		return 1<<16 + m.Round
+	}
+	return m.Round
+}
+
+func (t *Tournament) clone() *Tournament {
+	c := *t
+	c.Players = append([]string(nil), t.Players...)
+	c.Matches = make([]*Match, len(t.Matches))
+	for i, m := range t.Matches {
+		copied := *m
+		c.Matches[i] = &copied
+	}
+	return &c
+}
@@ -0,0 +1,444 @@
+package tournament_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/windnow/edusrv/internal/tournament"
+)
+
+var eight = []string{"Cleo", "Chris", "Pepper", "Floyd", "Ann", "Bob", "Dan", "Eve"}
+
+func TestSingleElimination(t *testing.T) {
+	t.Run("favourites win", func(t *testing.T) {
+		tour := newTournament(t, tournament.Spec{Name: "Cup", Format: tournament.SingleElimination, Players: eight})
+		if len(tour.Matches) != 7 {
+			t.Fatalf("got %d matches want 7", len(tour.Matches))
+		}
+		first := tour.Matches[0].Players
+		if first != [2]string{"Cleo", "Eve"} {
+			t.Errorf("got first match %v want the best seed against the worst", first)
+		}
+
+		playAll(t, tour, favourite(eight))
+
+		assertFinished(t, tour, true)
+		assertPlaces(t, tour.Standings(), map[string]int{
+			"Cleo": 1, "Chris": 2, "Pepper": 3, "Floyd": 3,
+			"Ann": 5, "Bob": 5, "Dan": 5, "Eve": 5,
+		})
+	})
+
+	t.Run("byes", func(t *testing.T) {
+		players := eight[:5]
+		tour := newTournament(t, tournament.Spec{Name: "Cup", Format: tournament.SingleElimination, Players: players})
+
+		ready := 0
+		for _, m := range tour.Matches {
+			if m.Ready() {
+				ready++
+			}
+		}
+		// Floyd meets Ann, Chris and Pepper go through to meet each other
+		if ready != 2 {
+			t.Errorf("got %d matches to play want 2", ready)
+		}
+
+		played := playAll(t, tour, favourite(players))
+		if played != 4 {
+			t.Errorf("played %d matches want 4", played)
+		}
+		assertFinished(t, tour, true)
+		assertPlaces(t, tour.Standings(), map[string]int{"Cleo": 1, "Chris": 2, "Pepper": 3, "Floyd": 3, "Ann": 5})
+	})
+}
+
+func TestDoubleElimination(t *testing.T) {
+	players := eight[:4]
+
+	t.Run("winners bracket champion", func(t *testing.T) {
+		tour := newTournament(t, tournament.Spec{Name: "Cup", Format: tournament.DoubleElimination, Players: players})
+
+		played := playAll(t, tour, favourite(players))
+
+		// 3 in the winners bracket, 2 in the losers one and the grand final
+		if played != 6 {
+			t.Errorf("played %d matches want 6", played)
+		}
+		assertFinished(t, tour, true)
+		assertPlaces(t, tour.Standings(), map[string]int{"Cleo": 1, "Chris": 2, "Pepper": 3, "Floyd": 4})
+	})
+
+	t.Run("losers bracket champion forces a reset", func(t *testing.T) {
+		tour := newTournament(t, tournament.Spec{Name: "Cup", Format: tournament.DoubleElimination, Players: players})
+
+		// Chris loses to Cleo in the winners bracket and beats her twice in
+		// the grand final
+		played := playAll(t, tour, func(m *tournament.Match) string {
+			if m.Bracket == tournament.GrandFinal {
+				return "Chris"
+			}
+			return favourite(players)(m)
+		})
+
+		if played != 7 {
+			t.Errorf("played %d matches want 7", played)
+		}
+		assertFinished(t, tour, true)
+		standings := tour.Standings()
+		assertPlaces(t, standings, map[string]int{"Chris": 1, "Cleo": 2, "Pepper": 3, "Floyd": 4})
+		if standings[0].Wins != 4 || standings[0].Losses != 1 {
+			t.Errorf("got champion %+v want 4 wins and a loss", standings[0])
+		}
+	})
+
+	t.Run("byes", func(t *testing.T) {
+		tour := newTournament(t, tournament.Spec{Name: "Cup", Format: tournament.DoubleElimination, Players: eight[:5]})
+		playAll(t, tour, favourite(eight))
+
+		assertFinished(t, tour, true)
+		if champion := tour.Standings()[0]; champion.Player != "Cleo" || champion.Place != 1 {
+			t.Errorf("got champion %+v want Cleo", champion)
+		}
+	})
+}
+
+func TestRoundRobin(t *testing.T) {
+	players := eight[:5]
+	tour := newTournament(t, tournament.Spec{Name: "League", Format: tournament.RoundRobin, Players: players})
+
+	if len(tour.Matches) != 10 {
+		t.Fatalf("got %d matches want 10", len(tour.Matches))
+	}
+	pairs := map[[2]string]bool{}
+	rounds := map[int]map[string]bool{}
+	for _, m := range tour.Matches {
+		a, b := m.Players[0], m.Players[1]
+		if a > b {
+			a, b = b, a
+		}
+		if pairs[[2]string{a, b}] {
+			t.Errorf("%s and %s play twice", a, b)
+		}
+		pairs[[2]string{a, b}] = true
+
+		if rounds[m.Round] == nil {
+			rounds[m.Round] = map[string]bool{}
+		}
+		for _, p := range m.Players {
+			if rounds[m.Round][p] {
+				t.Errorf("%s plays twice in round %d", p, m.Round)
+			}
+			rounds[m.Round][p] = true
+		}
+	}
+
+	playAll(t, tour, favourite(players))
+	assertFinished(t, tour, true)
+	standings := tour.Standings()
+	for i, s := range standings {
+		if s.Player != players[i] || s.Wins != len(players)-1-i {
+			t.Errorf("got standing %+v at %d", s, i)
+		}
+	}
+
+	var many []string
+	for i := 0; i < 65; i++ {
+		many = append(many, "Player "+strconv.Itoa(i))
+	}
+	if _, err := tournament.New(tournament.Spec{Name: "Huge", Format: tournament.RoundRobin, Players: many}); !errors.Is(err, tournament.ErrInvalidSpec) {
+		t.Errorf("got error %v for 65 players want %v", err, tournament.ErrInvalidSpec)
+	}
+}
+
+func TestSwiss(t *testing.T) {
+	t.Run("no rematches", func(t *testing.T) {
+		tour := newTournament(t, tournament.Spec{Name: "Open", Format: tournament.Swiss, Players: eight})
+		if tour.Rounds != 3 {
+			t.Errorf("got %d rounds want 3", tour.Rounds)
+		}
+
+		playAll(t, tour, favourite(eight))
+
+		assertFinished(t, tour, true)
+		if len(tour.Matches) != 12 {
+			t.Errorf("got %d matches want 12", len(tour.Matches))
+		}
+		pairs := map[[2]string]bool{}
+		for _, m := range tour.Matches {
+			if pairs[m.Players] || pairs[[2]string{m.Players[1], m.Players[0]}] {
+				t.Errorf("rematch of %v", m.Players)
+			}
+			pairs[m.Players] = true
+		}
+		if s := tour.Standings()[0]; s.Player != "Cleo" || s.Wins != 3 {
+			t.Errorf("got leader %+v want Cleo with 3 wins", s)
+		}
+	})
+
+	t.Run("byes go to different players", func(t *testing.T) {
+		players := eight[:5]
+		tour := newTournament(t, tournament.Spec{Name: "Open", Format: tournament.Swiss, Players: players, Rounds: 3})
+		playAll(t, tour, favourite(players))
+
+		byes := map[string]int{}
+		for _, m := range tour.Matches {
+			if m.Players[1] == "" {
+				byes[m.Players[0]]++
+			}
+		}
+		if len(byes) != 3 {
+			t.Errorf("got byes %v want one for each of 3 players", byes)
+		}
+	})
+}
+
+func TestRecordErrors(t *testing.T) {
+	tour := newTournament(t, tournament.Spec{Name: "Cup", Format: tournament.SingleElimination, Players: eight[:4]})
+	final := tour.Matches[len(tour.Matches)-1]
+
+	cases := []struct {
+		name   string
+		match  int
+		winner string
+		want   error
+	}{
+		{"unknown match", 42, "Cleo", tournament.ErrUnknownMatch},
+		{"not ready", final.ID, "Cleo", tournament.ErrMatchNotReady},
+		{"not in match", 1, "Chris", tournament.ErrNotInMatch},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := tour.Record(c.match, c.winner); !errors.Is(err, c.want) {
+				t.Errorf("got error %v want %v", err, c.want)
+			}
+		})
+	}
+
+	assertNoError(t, tour.Record(1, "Cleo"))
+	if err := tour.Record(1, "Cleo"); !errors.Is(err, tournament.ErrMatchPlayed) {
+		t.Errorf("got error %v want %v", err, tournament.ErrMatchPlayed)
+	}
+
+	for _, spec := range []tournament.Spec{
+		{Name: "Cup", Format: "ladder", Players: eight},
+		{Name: "Cup", Format: tournament.RoundRobin, Players: eight[:1]},
+		{Name: "Cup", Format: tournament.RoundRobin, Players: []string{"Cleo", "Cleo"}},
+		{Name: "", Format: tournament.RoundRobin, Players: eight},
+		{Name: "Cup", Format: tournament.Swiss, Players: eight, Rounds: 8},
+	} {
+		if _, err := tournament.New(spec); !errors.Is(err, tournament.ErrInvalidSpec) {
+			t.Errorf("got error %v for %+v want %v", err, spec, tournament.ErrInvalidSpec)
+		}
+	}
+}
+
+type StubRecorder struct {
+	wins []string
+	err  error
+}
+
+func (s *StubRecorder) RecordWin(name string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.wins = append(s.wins, name)
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tournaments.json")
+	recorder := &StubRecorder{}
+	manager, err := tournament.NewManager(file, recorder)
+	assertNoError(t, err)
+	handler := tournament.NewHandler(manager)
+
+	body, _ := json.Marshal(tournament.Spec{Name: "Cup", Format: tournament.SingleElimination, Players: eight[:4]})
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/tournaments", bytes.NewReader(body)))
+	assertStatusCode(t, response.Code, http.StatusCreated)
+
+	var state tournament.State
+	if err := json.NewDecoder(response.Body).Decode(&state); err != nil {
+		t.Fatalf("Unable to parse tournament, %v", err)
+	}
+	if got := response.Header().Get("Location"); got != "/tournaments/"+state.ID {
+		t.Errorf("got location %q", got)
+	}
+
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, newResultRequest(state.ID, 1, "Cleo"))
+	assertStatusCode(t, response.Code, http.StatusOK)
+	if !reflect.DeepEqual(recorder.wins, []string{"Cleo"}) {
+		t.Errorf("got wins %v recorded want Cleo", recorder.wins)
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			request *http.Request
+			want    int
+		}{
+			{newResultRequest(state.ID, 1, "Cleo"), http.StatusConflict},
+			{newResultRequest(state.ID, 3, "Cleo"), http.StatusConflict},
+			{newResultRequest(state.ID, 2, "Cleo"), http.StatusUnprocessableEntity},
+			{newResultRequest(state.ID, 9, "Cleo"), http.StatusNotFound},
+			{newResultRequest("nope", 1, "Cleo"), http.StatusNotFound},
+			{httptest.NewRequest(http.MethodPost, "/tournaments", bytes.NewReader([]byte(`{"name": "Cup", "format": "ladder"}`))), http.StatusUnprocessableEntity},
+			{httptest.NewRequest(http.MethodPost, "/tournaments", bytes.NewReader([]byte(`{`))), http.StatusBadRequest},
+			{httptest.NewRequest(http.MethodDelete, "/tournaments/"+state.ID, nil), http.StatusMethodNotAllowed},
+		}
+		for _, c := range cases {
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, c.request)
+			if response.Code != c.want {
+				t.Errorf("%s %s replied %d want %d", c.request.Method, c.request.URL, response.Code, c.want)
+			}
+		}
+	})
+
+	t.Run("leaves the match to play when the win isn't recorded", func(t *testing.T) {
+		recorder.err = errors.New("no raft leader")
+		defer func() { recorder.err = nil }()
+
+		winner := state.Match(2).Players[0]
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, newResultRequest(state.ID, 2, winner))
+		assertStatusCode(t, response.Code, http.StatusServiceUnavailable)
+
+		got, err := manager.Get(state.ID)
+		assertNoError(t, err)
+		if m := got.Match(2); m.Done || m.Played != nil {
+			t.Errorf("got match %+v want it left to play", m)
+		}
+		if got := manager.HeadToHead(winner, state.Match(2).Players[1]); got != 0 {
+			t.Errorf("got %s %d in head to head want 0", winner, got)
+		}
+	})
+
+	t.Run("reloads tournaments", func(t *testing.T) {
+		reloaded, err := tournament.NewManager(file, recorder)
+		assertNoError(t, err)
+
+		got, err := reloaded.Get(state.ID)
+		assertNoError(t, err)
+		if m := got.Match(1); !m.Done || m.Winner != "Cleo" {
+			t.Errorf("got first match %+v want won by Cleo", m)
+		}
+		if final := got.Matches[2]; final.Players[0] != "Cleo" {
+			t.Errorf("got final %+v want Cleo in it", final)
+		}
+		if list := reloaded.List(); len(list) != 1 || list[0].Matches != nil {
+			t.Errorf("got list %+v want the tournament without matches", list)
+		}
+
+		want := [][2]string{{"Cleo", "Floyd"}}
+		if got := reloaded.PlayedSince(time.Now().Add(-time.Hour)); !reflect.DeepEqual(got, want) {
+			t.Errorf("got pairs %v played want %v", got, want)
+		}
+		if got := reloaded.PlayedSince(time.Now().Add(time.Hour)); len(got) != 0 {
+			t.Errorf("got pairs %v played in the future", got)
+		}
+
+		for _, m := range []*tournament.Manager{manager, reloaded} {
+			if got := m.HeadToHead("Cleo", "Floyd"); got != 1 {
+				t.Errorf("got Cleo %d against Floyd want 1", got)
+			}
+			if got := m.HeadToHead("Floyd", "Cleo"); got != -1 {
+				t.Errorf("got Floyd %d against Cleo want -1", got)
+			}
+		}
+	})
+
+	t.Run("limits open tournaments", func(t *testing.T) {
+		for open := len(manager.List()); open < tournament.MaxOpen; open++ {
+			_, err := manager.Create(tournament.Spec{Name: "Cup", Format: tournament.SingleElimination, Players: eight[:2]})
+			assertNoError(t, err)
+		}
+
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/tournaments", bytes.NewReader(body)))
+		assertStatusCode(t, response.Code, http.StatusConflict)
+	})
+}
+
+func newTournament(t *testing.T, spec tournament.Spec) *tournament.Tournament {
+	t.Helper()
+	tour, err := tournament.New(spec)
+	assertNoError(t, err)
+	return tour
+}
+
+func newResultRequest(id string, match int, winner string) *http.Request {
+	body, _ := json.Marshal(tournament.Result{Winner: winner})
+	return httptest.NewRequest(http.MethodPost, "/tournaments/"+id+"/matches/"+strconv.Itoa(match), bytes.NewReader(body))
+}
+
+// favourite picks the better seed of the players
+func favourite(players []string) func(m *tournament.Match) string {
+	return func(m *tournament.Match) string {
+		for _, p := range players {
+			if p == m.Players[0] || p == m.Players[1] {
+				return p
+			}
+		}
+		return ""
+	}
+}
+
+// playAll records the winners of matches until none is ready, returning
+// the number of matches played
+func playAll(t *testing.T, tour *tournament.Tournament, winner func(m *tournament.Match) string) int {
+	t.Helper()
+	played := 0
+	for progress := true; progress; {
+		progress = false
+		for _, m := range tour.Matches {
+			if m.Ready() {
+				assertNoError(t, tour.Record(m.ID, winner(m)))
+				played++
+				progress = true
+			}
+		}
+	}
+	return played
+}
+
+func assertFinished(t testing.TB, tour *tournament.Tournament, want bool) {
+	t.Helper()
+	if tour.Finished != want {
+		t.Errorf("got finished %v want %v", tour.Finished, want)
+	}
+}
+
+func assertPlaces(t testing.TB, standings []tournament.Standing, want map[string]int) {
+	t.Helper()
+	got := map[string]int{}
+	for _, s := range standings {
+		got[s.Player] = s.Place
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got places %v want %v", got, want)
+	}
+}
+
+func assertStatusCode(t testing.TB, got, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("did not get correct status, got %d, want %d", got, want)
+	}
+}
+
+func assertNoError(t testing.TB, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("didn't expect an error but got one, %v", err)
+	}
+}